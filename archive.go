@@ -0,0 +1,29 @@
+package stream
+
+import "io"
+
+// archive copies the Stream from r to a File with the same name in s.archiveTo.
+func (s *Stream) archive(r *Reader) {
+	err := s.copyFile(s.archiveTo, r)
+	r.Close()
+	s.archiveDone(err)
+}
+
+func (s *Stream) copyFile(dst FileSystem, r *Reader) error {
+	f, err := dst.Create(s.Name())
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// archiveDone reports the result of archiving, once the Reader used has been Closed.
+func (s *Stream) archiveDone(err error) {
+	if s.archived != nil {
+		s.archived(err)
+	}
+}
@@ -0,0 +1,64 @@
+package stream
+
+import "time"
+
+// AuditEventKind is the kind of an AuditEvent.
+type AuditEventKind int
+
+// The kinds of AuditEvents.
+const (
+	AuditReaderOpened AuditEventKind = iota // a Reader was created
+	AuditReaderClosed                       // a Reader was Closed, Read has the ranges it read
+	AuditWrite                              // a Write, at Off for Len bytes
+	AuditClose                              // the Stream was Closed
+	AuditCancel                             // the Stream was Canceled, Err is the cause
+	AuditShutdown                           // ShutdownWithErr (or Remove) was called, Err is its error
+)
+
+var auditEventKinds = [...]string{"reader opened", "reader closed", "write", "close", "cancel", "shutdown"}
+
+func (k AuditEventKind) String() string {
+	if k < 0 || int(k) >= len(auditEventKinds) {
+		return "unknown"
+	}
+	return auditEventKinds[k]
+}
+
+// AuditEvent is an operation on a Stream, see WithAudit.
+type AuditEvent struct {
+	Kind   AuditEventKind
+	Time   time.Time
+	Stream string   // the Name of the Stream
+	Reader *Reader  // the Reader, for AuditReaderOpened and AuditReaderClosed
+	Off    int64    // the offset of an AuditWrite
+	Len    int64    // the bytes written by an AuditWrite
+	Read   []Extent // the ranges of the Stream read by the Reader, for AuditReaderClosed
+	Err    error    // the error of an AuditWrite, or the cause of an AuditCancel or AuditShutdown
+}
+
+// audit sends an event to the audit hook, if there's one.
+func (s *Stream) audit(e AuditEvent) {
+	if s.onAudit == nil {
+		return
+	}
+	e.Time = time.Now()
+	e.Stream = s.Name()
+	s.onAudit(e)
+}
+
+// readRange records that r read n bytes at off, for AuditReaderClosed.
+func (r *Reader) readRange(off, n int64) {
+	if r.s.onAudit == nil || n <= 0 {
+		return
+	}
+	r.ranges.mu.Lock()
+	r.ranges.add(Extent{Off: off, Len: n})
+	r.ranges.mu.Unlock()
+}
+
+// rangesRead returns the ranges r has read.
+func (r *Reader) rangesRead() []Extent {
+	r.ranges.mu.RLock()
+	defer r.ranges.mu.RUnlock()
+	return append([]Extent(nil), r.ranges.extents...)
+}
@@ -53,3 +53,18 @@ func benchmarkStream(fs FileSystem, b *testing.B) {
 		}
 	})
 }
+
+func BenchmarkWriteTo(b *testing.B) {
+	b.ReportAllocs()
+	w := NewMemStream()
+	w.Write(make([]byte, 1024*1024))
+	w.Close()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			r, _ := w.NextReader()
+			r.WriteTo(ioutil.Discard)
+			r.Close()
+		}
+	})
+}
@@ -0,0 +1,421 @@
+package stream
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+)
+
+type blockFS struct {
+	inner     FileSystem
+	blockSize int
+	codec     Codec
+	seekTable bool // index is a zstd seek table at the end of the File, instead of in name.idx
+
+	mu      sync.Mutex
+	indexes map[string]*blockIndex
+}
+
+func indexName(name string) string { return name + ".idx" }
+
+func (fs *blockFS) Create(name string) (File, error) {
+	return fs.CreateContext(context.Background(), name)
+}
+
+func (fs *blockFS) CreateContext(ctx context.Context, name string) (File, error) {
+	f, err := createContext(ctx, fs.inner, name)
+	if err != nil {
+		return nil, err
+	}
+	idx := &blockIndex{codec: fs.codec}
+	fs.mu.Lock()
+	fs.indexes[name] = idx
+	fs.mu.Unlock()
+	return &blockWriter{File: f, fs: fs, idx: idx}, nil
+}
+
+func (fs *blockFS) Open(name string) (File, error) {
+	return fs.OpenContext(context.Background(), name)
+}
+
+func (fs *blockFS) OpenContext(ctx context.Context, name string) (File, error) {
+	idx, err := fs.index(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := openContext(ctx, fs.inner, name)
+	if err != nil {
+		return nil, err
+	}
+	return &blockReader{File: f, codec: idx.codec, idx: idx}, nil
+}
+
+func (fs *blockFS) Remove(name string) error {
+	return fs.RemoveContext(context.Background(), name)
+}
+
+func (fs *blockFS) RemoveContext(ctx context.Context, name string) error {
+	fs.mu.Lock()
+	delete(fs.indexes, name)
+	fs.mu.Unlock()
+
+	err := removeContext(ctx, fs.inner, name)
+	if fs.seekTable {
+		return err
+	}
+	if ierr := removeContext(ctx, fs.inner, indexName(name)); err == nil && !os.IsNotExist(ierr) {
+		err = ierr
+	}
+	return err
+}
+
+func (fs *blockFS) Rename(oldname, newname string) error {
+	inner, ok := fs.inner.(Renamer)
+	if !ok {
+		return ErrUnsupported
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if err := inner.Rename(oldname, newname); err != nil {
+		return err
+	}
+	if !fs.seekTable {
+		if err := inner.Rename(indexName(oldname), indexName(newname)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if idx, ok := fs.indexes[oldname]; ok {
+		delete(fs.indexes, oldname)
+		fs.indexes[newname] = idx
+	}
+	return nil
+}
+
+func (fs *blockFS) canRename() bool { return canRename(fs.inner) }
+
+func (fs *blockFS) syncDir(name string) error { return syncDir(fs.inner, name) }
+
+// index returns the index of a File written through fs, or loads it from its index file / seek table.
+func (fs *blockFS) index(ctx context.Context, name string) (*blockIndex, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if idx, ok := fs.indexes[name]; ok {
+		return idx, nil
+	}
+
+	var idx *blockIndex
+	if fs.seekTable {
+		f, err := openContext(ctx, fs.inner, name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		if idx, err = readSeekTable(f); err != nil {
+			return nil, err
+		}
+		idx.codec = fs.codec
+	} else {
+		f, err := openContext(ctx, fs.inner, indexName(name))
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		if idx, err = readBlockIndex(f, fs.codec); err != nil {
+			return nil, err
+		}
+	}
+	fs.indexes[name] = idx
+	return idx, nil
+}
+
+type block struct {
+	off  int64 // uncompressed offset
+	n    int64 // uncompressed length
+	coff int64 // compressed offset
+	clen int64 // compressed length
+}
+
+// blockIndex locates the compressed blocks of a File.
+type blockIndex struct {
+	codec   Codec // the Codec the blocks are compressed with
+	mu      sync.RWMutex
+	blocks  []block
+	pending []byte // written bytes following the last block, not yet compressed
+	size    int64  // uncompressed size
+}
+
+// indexMagic starts the header of an index file, followed by the length of the Name of the Codec
+// (1 byte) and the Name. Index files written before Codecs had names have no header.
+const indexMagic = "\x00stream\x00"
+
+// readBlockIndex reads an index file, whose blocks are compressed by codec if it has no header.
+func readBlockIndex(r io.Reader, codec Codec) (*blockIndex, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) >= len(indexMagic)+1 && string(data[:len(indexMagic)]) == indexMagic {
+		data = data[len(indexMagic):]
+		n := int(data[0])
+		if len(data) < 1+n {
+			return nil, io.ErrUnexpectedEOF
+		}
+		name := string(data[1 : 1+n])
+		data = data[1+n:]
+		if name != codec.Name() {
+			var ok bool
+			if codec, ok = lookupCodec(name); !ok {
+				return nil, fmt.Errorf("%w %q", ErrUnknownCodec, name)
+			}
+		}
+	}
+
+	idx := &blockIndex{codec: codec}
+	for ; len(data) >= 16; data = data[16:] {
+		n := int64(binary.LittleEndian.Uint64(data))        // uncompressed length
+		clen := int64(binary.LittleEndian.Uint64(data[8:])) // compressed length
+		idx.add(n, clen)
+	}
+	if len(data) > 0 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return idx, nil
+}
+
+func (idx *blockIndex) writeTo(w io.Writer) error {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	name := idx.codec.Name()
+	if len(name) > 255 {
+		return fmt.Errorf("codec name %q is too long", name)
+	}
+	if _, err := io.WriteString(w, indexMagic+string([]byte{byte(len(name))})+name); err != nil {
+		return err
+	}
+	for _, b := range idx.blocks {
+		if err := binary.Write(w, binary.LittleEndian, [2]int64{b.n, b.clen}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// add appends a block of n uncompressed bytes stored in clen bytes, idx.mu must be held.
+func (idx *blockIndex) add(n, clen int64) {
+	var b block
+	if len(idx.blocks) > 0 {
+		last := idx.blocks[len(idx.blocks)-1]
+		b.off, b.coff = last.off+last.n, last.coff+last.clen
+	}
+	b.n, b.clen = n, clen
+	idx.blocks = append(idx.blocks, b)
+	if end := b.off + b.n; end > idx.size {
+		idx.size = end
+	}
+}
+
+// find returns the block containing off, or false if off is in pending.
+func (idx *blockIndex) find(off int64) (block, bool) {
+	i := sort.Search(len(idx.blocks), func(i int) bool {
+		b := idx.blocks[i]
+		return off < b.off+b.n
+	})
+	if i == len(idx.blocks) {
+		return block{}, false
+	}
+	return idx.blocks[i], true
+}
+
+type blockWriter struct {
+	File
+	fs     *blockFS
+	idx    *blockIndex
+	closed bool
+	synced bool // Sync was called, so the index is synced on Close as well
+}
+
+func (w *blockWriter) Write(p []byte) (int, error) {
+	return w.WriteContext(context.Background(), p)
+}
+
+func (w *blockWriter) WriteContext(ctx context.Context, p []byte) (int, error) {
+	if w.closed {
+		return 0, os.ErrClosed
+	}
+
+	w.idx.mu.Lock()
+	w.idx.pending = append(w.idx.pending, p...)
+	w.idx.size += int64(len(p))
+	w.idx.mu.Unlock()
+
+	for w.pendingLen() >= w.fs.blockSize {
+		if err := w.flush(ctx, w.fs.blockSize); err != nil {
+			return len(p), err
+		}
+	}
+	return len(p), nil
+}
+
+// Sync flushes the pending bytes into a block, and syncs the underlying File if it supports it.
+// Once Sync has been called, Close syncs the index too.
+func (w *blockWriter) Sync() error {
+	if w.closed {
+		return os.ErrClosed
+	}
+	w.synced = true
+
+	if n := w.pendingLen(); n > 0 {
+		if err := w.flush(context.Background(), n); err != nil {
+			return err
+		}
+	}
+	return syncFile(w.File)
+}
+
+func (w *blockWriter) pendingLen() int {
+	w.idx.mu.RLock()
+	defer w.idx.mu.RUnlock()
+	return len(w.idx.pending)
+}
+
+// flush compresses the first n pending bytes into a block.
+// The pending bytes are only replaced by the block once it's readable from the File.
+func (w *blockWriter) flush(ctx context.Context, n int) error {
+	w.idx.mu.RLock()
+	p := w.idx.pending[:n]
+	w.idx.mu.RUnlock()
+
+	c, err := w.idx.codec.Compress(p)
+	if err != nil {
+		return err
+	}
+	if _, err := writeContext(ctx, w.File, c); err != nil {
+		return err
+	}
+
+	w.idx.mu.Lock()
+	w.idx.pending = w.idx.pending[n:]
+	w.idx.add(int64(n), int64(len(c)))
+	w.idx.mu.Unlock()
+	return nil
+}
+
+func (w *blockWriter) Close() error {
+	if w.closed {
+		return os.ErrClosed
+	}
+	w.closed = true
+
+	if n := w.pendingLen(); n > 0 {
+		if err := w.flush(context.Background(), n); err != nil {
+			w.File.Close()
+			return err
+		}
+	}
+	if w.fs.seekTable {
+		if err := w.idx.writeSeekTable(w.File); err != nil {
+			w.File.Close()
+			return err
+		}
+		if w.synced {
+			if err := syncFile(w.File); err != nil {
+				w.File.Close()
+				return err
+			}
+		}
+		return w.File.Close()
+	}
+	if err := w.File.Close(); err != nil {
+		return err
+	}
+
+	f, err := w.fs.inner.Create(indexName(w.Name()))
+	if err != nil {
+		return err
+	}
+	if err := w.idx.writeTo(f); err != nil {
+		f.Close()
+		return err
+	}
+	if w.synced {
+		if err := syncFile(f); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
+
+type blockReader struct {
+	File
+	codec Codec
+	idx   *blockIndex
+
+	mu     sync.Mutex
+	off    int64  // offset for Read
+	cached block  // last decompressed block
+	data   []byte // uncompressed contents of cached
+}
+
+func (r *blockReader) Read(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n, err := r.readAt(p, r.off)
+	r.off += int64(n)
+	return n, err
+}
+
+func (r *blockReader) ReadAt(p []byte, off int64) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.readAt(p, off)
+}
+
+func (r *blockReader) readAt(p []byte, off int64) (n int, err error) {
+	for n < len(p) {
+		m, err := r.readBlock(p[n:], off+int64(n))
+		n += m
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// readBlock reads from the single block (or pending bytes) containing off.
+func (r *blockReader) readBlock(p []byte, off int64) (int, error) {
+	r.idx.mu.RLock()
+	if off >= r.idx.size {
+		r.idx.mu.RUnlock()
+		return 0, io.EOF
+	}
+	b, ok := r.idx.find(off)
+	if !ok {
+		defer r.idx.mu.RUnlock()
+		start := r.idx.size - int64(len(r.idx.pending))
+		return copy(p, r.idx.pending[off-start:]), nil
+	}
+	r.idx.mu.RUnlock()
+
+	if r.data == nil || r.cached != b {
+		c := make([]byte, b.clen)
+		if _, err := r.File.ReadAt(c, b.coff); err != nil && err != io.EOF {
+			return 0, err
+		}
+		data, err := r.codec.Decompress(c)
+		if err != nil {
+			return 0, err
+		}
+		r.cached, r.data = b, data
+	}
+	if off-b.off >= int64(len(r.data)) {
+		return 0, io.ErrUnexpectedEOF
+	}
+	return copy(p, r.data[off-b.off:]), nil
+}
@@ -0,0 +1,56 @@
+package stream
+
+import (
+	"io"
+	"sync"
+)
+
+// Chain returns a ReadCloser of the Streams back-to-back, ex. to serve the parts of a multi-part
+// upload, cached as separate Streams, as one body. Reads block until the current Stream is Closed
+// before moving on to the next, and return io.EOF after the last. A Reader of each Stream is taken
+// up front, so none can be Removed until the chain is Closed, which Closes them.
+func Chain(streams ...*Stream) io.ReadCloser {
+	c := &chain{readers: make([]*Reader, len(streams)), errs: make([]error, len(streams))}
+	for i, s := range streams {
+		c.readers[i], c.errs[i] = s.NextReader()
+	}
+	return c
+}
+
+type chain struct {
+	mu      sync.Mutex
+	readers []*Reader
+	errs    []error // from NextReader, returned when the chain gets to the Stream
+}
+
+func (c *chain) Read(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.readers) > 0 {
+		if err := c.errs[0]; err != nil {
+			return 0, err
+		}
+		n, err := c.readers[0].Read(p)
+		if err == io.EOF {
+			c.readers[0].Close()
+			c.readers, c.errs = c.readers[1:], c.errs[1:]
+			err = nil
+		}
+		if n > 0 || err != nil {
+			return n, err
+		}
+	}
+	return 0, io.EOF
+}
+
+func (c *chain) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, r := range c.readers {
+		if r != nil {
+			r.Close()
+		}
+	}
+	c.readers, c.errs = nil, nil
+	return nil
+}
@@ -0,0 +1,244 @@
+package stream
+
+import (
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"os"
+	"path"
+	"sync"
+)
+
+// NewChecksumFS returns a FileSystem which records the CRC-32C of every chunkSize bytes of the Files it
+// Creates in a sidecar File in inner (name.crc), and verifies the chunks read by ReadAt against it, so bit rot
+// or torn writes in long-lived Files fail Reads with a *CorruptError (see ErrCorrupt) instead of being served.
+// A chunk's checksum is recorded once it's complete, or the File is Closed: chunks still being written are read
+// without verification. Files without a sidecar can't be Opened.
+func NewChecksumFS(inner FileSystem, chunkSize int) FileSystem {
+	return &checksumFS{inner: inner, chunkSize: chunkSize}
+}
+
+func checksumName(name string) string { return name + ".crc" }
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+type checksumFS struct {
+	inner     FileSystem
+	chunkSize int
+}
+
+func (fs *checksumFS) Create(name string) (File, error) {
+	return fs.CreateContext(context.Background(), name)
+}
+
+func (fs *checksumFS) CreateContext(ctx context.Context, name string) (File, error) {
+	f, err := createContext(ctx, fs.inner, name)
+	if err != nil {
+		return nil, err
+	}
+	sums, err := createContext(ctx, fs.inner, checksumName(name))
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &checksumWriter{File: f, sums: sums, chunkSize: fs.chunkSize}, nil
+}
+
+func (fs *checksumFS) Open(name string) (File, error) {
+	return fs.OpenContext(context.Background(), name)
+}
+
+func (fs *checksumFS) OpenContext(ctx context.Context, name string) (File, error) {
+	f, err := openContext(ctx, fs.inner, name)
+	if err != nil {
+		return nil, err
+	}
+	sums, err := openContext(ctx, fs.inner, checksumName(name))
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &checksumReader{File: f, sums: sums, chunkSize: fs.chunkSize}, nil
+}
+
+func (fs *checksumFS) Remove(name string) error {
+	return fs.RemoveContext(context.Background(), name)
+}
+
+func (fs *checksumFS) RemoveContext(ctx context.Context, name string) error {
+	err := removeContext(ctx, fs.inner, name)
+	if serr := removeContext(ctx, fs.inner, checksumName(name)); err == nil && !os.IsNotExist(serr) {
+		err = serr
+	}
+	return err
+}
+
+func (fs *checksumFS) Rename(oldname, newname string) error {
+	inner, ok := fs.inner.(Renamer)
+	if !ok {
+		return ErrUnsupported
+	}
+	if err := inner.Rename(oldname, newname); err != nil {
+		return err
+	}
+	if err := inner.Rename(checksumName(oldname), checksumName(newname)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (fs *checksumFS) canRename() bool { return canRename(fs.inner) }
+
+func (fs *checksumFS) syncDir(name string) error { return syncDir(fs.inner, name) }
+
+// checksumWriter appends the checksum of each chunk written to File to sums, once the chunk is complete.
+type checksumWriter struct {
+	File
+	sums      File
+	chunkSize int
+	crc       uint32 // of the chunk being written
+	n         int    // bytes of the chunk being written
+	closed    bool
+}
+
+func (w *checksumWriter) Write(p []byte) (int, error) {
+	return w.WriteContext(context.Background(), p)
+}
+
+func (w *checksumWriter) WriteContext(ctx context.Context, p []byte) (int, error) {
+	if w.closed {
+		return 0, os.ErrClosed
+	}
+	n, err := writeContext(ctx, w.File, p)
+	for q := p[:n]; len(q) > 0; {
+		m := w.chunkSize - w.n
+		if m > len(q) {
+			m = len(q)
+		}
+		w.crc = crc32.Update(w.crc, castagnoli, q[:m])
+		w.n += m
+		q = q[m:]
+		if w.n == w.chunkSize {
+			if serr := w.writeSum(ctx); err == nil {
+				err = serr
+			}
+		}
+	}
+	return n, err
+}
+
+// writeSum records the checksum of the chunk being written, and starts the next one.
+func (w *checksumWriter) writeSum(ctx context.Context) error {
+	var sum [4]byte
+	binary.LittleEndian.PutUint32(sum[:], w.crc)
+	w.crc, w.n = 0, 0
+	_, err := writeContext(ctx, w.sums, sum[:])
+	return err
+}
+
+// Sync syncs the File and its checksums, if they support it.
+func (w *checksumWriter) Sync() error {
+	if err := syncFile(w.File); err != nil {
+		return err
+	}
+	return syncFile(w.sums)
+}
+
+// Close records the checksum of the last, partial, chunk and Closes the File and its checksums.
+func (w *checksumWriter) Close() error {
+	if w.closed {
+		return os.ErrClosed
+	}
+	w.closed = true
+
+	var err error
+	if w.n > 0 {
+		err = w.writeSum(context.Background())
+	}
+	if cerr := w.File.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := w.sums.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// checksumReader verifies the chunks it reads from File against sums.
+type checksumReader struct {
+	File
+	sums      File
+	chunkSize int
+
+	mu  sync.Mutex
+	off int64 // offset for Read
+}
+
+func (r *checksumReader) Read(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n, err := r.ReadAt(p, r.off)
+	r.off += int64(n)
+	return n, err
+}
+
+// Close Closes the File and its checksums.
+func (r *checksumReader) Close() error {
+	err := r.File.Close()
+	if serr := r.sums.Close(); err == nil {
+		err = serr
+	}
+	return err
+}
+
+// Stat returns the size of the File, which isn't verified.
+func (r *checksumReader) Stat() (os.FileInfo, error) {
+	size, err := fileSize(r.File)
+	if err != nil {
+		return nil, err
+	}
+	return readerInfo{name: path.Base(r.Name()), size: size}, nil
+}
+
+// ReadAt reads the chunks which overlap p one at a time, into a pooled buffer of a chunk,
+// and verifies those which have a checksum.
+func (r *checksumReader) ReadAt(p []byte, off int64) (n int, err error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	pool := bufferPool(r.chunkSize)
+	buf := pool.Get().(*[]byte)
+	defer pool.Put(buf)
+
+	size := int64(r.chunkSize)
+	var sum [4]byte
+	for n < len(p) {
+		pos := off + int64(n)
+		i := pos / size
+
+		// read the checksum first, so that the chunk it covers is complete when read
+		m, err := r.sums.ReadAt(sum[:], 4*i)
+		if err != nil && err != io.EOF {
+			return n, err
+		}
+		c, err := r.File.ReadAt(*buf, i*size)
+		if err != nil && err != io.EOF {
+			return n, err
+		}
+		chunk := (*buf)[:c]
+		if m == len(sum) && crc32.Checksum(chunk, castagnoli) != binary.LittleEndian.Uint32(sum[:]) {
+			return n, &CorruptError{Name: r.Name(), Off: i * size, Len: int64(c)}
+		}
+
+		skip := pos - i*size
+		if skip >= int64(c) {
+			return n, io.EOF
+		}
+		n += copy(p[n:], chunk[skip:])
+		if int64(c) < size && n < len(p) {
+			return n, io.EOF
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,141 @@
+package stream
+
+import (
+	"context"
+	"crypto/rand"
+	"io"
+	"sync"
+)
+
+// Cipher is a length-preserving cipher which can encrypt and decrypt at any offset of a File, like
+// a stream cipher (ex. AES-CTR, see NewAESCTRCipher, or ChaCha20 with its counter set from off),
+// so NewCipherFS can serve ReadAt without reading from the start of the File. Implementations
+// can wrap keys held by a KMS or in hardware.
+type Cipher interface {
+	// NonceSize is the size of the random nonce which starts each File.
+	NonceSize() int
+	// SealAt encrypts src, the data at offset off of the File with nonce, into dst, which is as long as src.
+	SealAt(dst, src, nonce []byte, off int64) error
+	// OpenAt decrypts src, the data at offset off of the File with nonce, into dst, which is as long as src.
+	OpenAt(dst, src, nonce []byte, off int64) error
+}
+
+// NewCipherFS returns a FileSystem which encrypts Files stored in inner with c. Each File starts
+// with a random nonce of c.NonceSize() bytes.
+func NewCipherFS(inner FileSystem, c Cipher) FileSystem {
+	return &cipherFS{inner: inner, c: c}
+}
+
+type cipherFS struct {
+	inner FileSystem
+	c     Cipher
+}
+
+func (fs *cipherFS) Create(name string) (File, error) {
+	return fs.CreateContext(context.Background(), name)
+}
+
+func (fs *cipherFS) CreateContext(ctx context.Context, name string) (File, error) {
+	f, err := createContext(ctx, fs.inner, name)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, fs.c.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := writeContext(ctx, f, nonce); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &cipherFile{File: f, c: fs.c, nonce: nonce}, nil
+}
+
+func (fs *cipherFS) Open(name string) (File, error) {
+	return fs.OpenContext(context.Background(), name)
+}
+
+func (fs *cipherFS) OpenContext(ctx context.Context, name string) (File, error) {
+	f, err := openContext(ctx, fs.inner, name)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, fs.c.NonceSize())
+	if _, err := f.ReadAt(nonce, 0); err != nil {
+		f.Close()
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return &cipherFile{File: f, c: fs.c, nonce: nonce}, nil
+}
+
+func (fs *cipherFS) Remove(name string) error { return fs.inner.Remove(name) }
+
+func (fs *cipherFS) RemoveContext(ctx context.Context, name string) error {
+	return removeContext(ctx, fs.inner, name)
+}
+
+func (fs *cipherFS) Rename(oldname, newname string) error {
+	inner, ok := fs.inner.(Renamer)
+	if !ok {
+		return ErrUnsupported
+	}
+	return inner.Rename(oldname, newname)
+}
+
+func (fs *cipherFS) canRename() bool { return canRename(fs.inner) }
+
+func (fs *cipherFS) syncDir(name string) error { return syncDir(fs.inner, name) }
+
+// cipherFile encrypts/decrypts the contents of File following its nonce.
+type cipherFile struct {
+	File
+	c     Cipher
+	nonce []byte
+
+	mu   sync.Mutex
+	rOff int64 // offset for Read
+	wOff int64 // offset for Write
+	buf  []byte
+}
+
+// Sync syncs the underlying File, if it supports it.
+func (f *cipherFile) Sync() error { return syncFile(f.File) }
+
+func (f *cipherFile) Write(p []byte) (int, error) {
+	return f.WriteContext(context.Background(), p)
+}
+
+func (f *cipherFile) WriteContext(ctx context.Context, p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if cap(f.buf) < len(p) {
+		f.buf = make([]byte, len(p))
+	}
+	c := f.buf[:len(p)]
+	if err := f.c.SealAt(c, p, f.nonce, f.wOff); err != nil {
+		return 0, err
+	}
+	n, err := writeContext(ctx, f.File, c)
+	f.wOff += int64(n)
+	return n, err
+}
+
+func (f *cipherFile) Read(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n, err := f.ReadAt(p, f.rOff)
+	f.rOff += int64(n)
+	return n, err
+}
+
+func (f *cipherFile) ReadAt(p []byte, off int64) (int, error) {
+	n, err := f.File.ReadAt(p, off+int64(len(f.nonce)))
+	if oerr := f.c.OpenAt(p[:n], p[:n], f.nonce, off); oerr != nil {
+		return 0, oerr
+	}
+	return n, err
+}
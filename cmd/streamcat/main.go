@@ -0,0 +1,108 @@
+// Command streamcat writes and reads Files with the stream package, to debug deployments and
+// to show how it's used across processes.
+//
+// Usage:
+//
+//	streamcat write [-atomic] <name>
+//	streamcat read [-follow] [-offset n] [-length n] <name>
+//
+// write copies stdin into a Stream of the File name, with a state file so other processes can
+// follow it. With -atomic, it's written as name.tmp and renamed to name once stdin is done.
+//
+// read copies the File name to stdout. With -follow, it reads the File while another streamcat
+// writes it, until the writer is done (follow name.tmp for an -atomic writer). -offset and
+// -length read only that range of the File.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/djherbis/stream"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	var err error
+	switch os.Args[1] {
+	case "write":
+		err = write(os.Args[2:])
+	case "read":
+		err = read(os.Args[2:])
+	default:
+		usage()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "streamcat:", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: streamcat write [-atomic] <name>")
+	fmt.Fprintln(os.Stderr, "       streamcat read [-follow] [-offset n] [-length n] <name>")
+	os.Exit(2)
+}
+
+func write(args []string) error {
+	flags := flag.NewFlagSet("write", flag.ExitOnError)
+	atomic := flags.Bool("atomic", false, "write to name.tmp, and rename it to name when done")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		usage()
+	}
+
+	opts := []stream.Option{stream.WithStateFile()}
+	if *atomic {
+		opts = append(opts, stream.WithAtomicCreate())
+	}
+	s, err := stream.New(flags.Arg(0), opts...)
+	if err != nil {
+		return err
+	}
+	return stream.Fill(s, os.Stdin)
+}
+
+func read(args []string) error {
+	flags := flag.NewFlagSet("read", flag.ExitOnError)
+	follow := flags.Bool("follow", false, "read while another process writes the File, until it's done")
+	offset := flags.Int64("offset", 0, "the offset to start reading at")
+	length := flags.Int64("length", -1, "the bytes to read, -1 for the rest of the File")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		usage()
+	}
+	name := flags.Arg(0)
+
+	var s *stream.Stream
+	var err error
+	if *follow {
+		s, err = stream.Attach(name, stream.StdFileSystem)
+	} else {
+		s, err = stream.OpenStream(name, stream.StdFileSystem)
+	}
+	if err != nil {
+		return err
+	}
+	r, err := s.NextReader()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	var src io.Reader = r
+	if *offset > 0 {
+		if _, err := r.Seek(*offset, io.SeekStart); err != nil {
+			return err
+		}
+	}
+	if *length >= 0 {
+		src = io.LimitReader(r, *length)
+	}
+	_, err = io.Copy(os.Stdout, src)
+	return err
+}
@@ -0,0 +1,51 @@
+package stream
+
+import (
+	"errors"
+	"sync"
+)
+
+// Codec compresses the independent blocks of a File stored by NewCodecFS, ex. with zstd, lz4 or snappy.
+type Codec interface {
+	// Name identifies the Codec in the index of the Files it compressed, ex. "gzip", so they
+	// can be decompressed with the right Codec (see RegisterCodec).
+	Name() string
+	Compress(p []byte) ([]byte, error)
+	Decompress(p []byte) ([]byte, error)
+}
+
+// ErrUnknownCodec is returned when Opening a File compressed by a Codec which isn't registered, see RegisterCodec.
+var ErrUnknownCodec = errors.New("unknown codec")
+
+var codecs = struct {
+	sync.RWMutex
+	byName map[string]Codec
+}{byName: map[string]Codec{gzipCodec{}.Name(): gzipCodec{}}}
+
+// RegisterCodec makes c available to decompress Files it compressed, by its Name, to any FileSystem
+// from NewCodecFS or NewGzipFS. The gzip Codec is always registered.
+func RegisterCodec(c Codec) {
+	codecs.Lock()
+	defer codecs.Unlock()
+	codecs.byName[c.Name()] = c
+}
+
+func lookupCodec(name string) (Codec, bool) {
+	codecs.RLock()
+	defer codecs.RUnlock()
+	c, ok := codecs.byName[name]
+	return c, ok
+}
+
+// NewCodecFS returns a FileSystem which stores Files compressed by c in inner, while still supporting
+// ReadAt (and so Reader.Seek) on the uncompressed content, like NewGzipFS. The Name of c is stored
+// in the index of each File, so Files are decompressed with the Codec they were compressed with,
+// which must be c or registered with RegisterCodec, even if they're Opened through another FileSystem.
+func NewCodecFS(inner FileSystem, blockSize int, c Codec) FileSystem {
+	return &blockFS{
+		inner:     inner,
+		blockSize: blockSize,
+		codec:     c,
+		indexes:   make(map[string]*blockIndex),
+	}
+}
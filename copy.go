@@ -0,0 +1,38 @@
+package stream
+
+import "io"
+
+// CopyWithProgress copies from r to dst until the Stream is Closed, blocking for new
+// writes like Reader.Read. fn is called with the total number of bytes copied so far
+// after each chunk is written to dst. It returns the number of bytes copied and the
+// first error encountered, if any.
+func CopyWithProgress(dst io.Writer, r *Reader, fn func(copied int64)) (int64, error) {
+	return r.WriteTo(&progressWriter{w: dst, fn: fn})
+}
+
+type progressWriter struct {
+	w      io.Writer
+	fn     func(copied int64)
+	copied int64
+}
+
+func (pw *progressWriter) Write(p []byte) (int, error) {
+	n, err := pw.w.Write(p)
+	if n > 0 {
+		pw.copied += int64(n)
+		pw.fn(pw.copied)
+	}
+	return n, err
+}
+
+// Fill is the producer side of a Stream fed by r, ex. os.Stdin or a pipe: it Writes everything
+// read from r to s until io.EOF, and then Closes s. If reading or writing fails, s is Canceled
+// with the error as the cause instead (see Abort), so Readers fail rather than see a short Stream.
+// It returns the error, or the error from Close.
+func Fill(s *Stream, r io.Reader) error {
+	if _, err := s.ReadFrom(r); err != nil {
+		s.cancel(err)
+		return err
+	}
+	return s.Close()
+}
@@ -0,0 +1,70 @@
+package stream
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+)
+
+// NewAESCTRFS returns a FileSystem which encrypts Files stored in inner with AES-CTR.
+// key must be 16, 24 or 32 bytes to select AES-128, AES-192 or AES-256.
+//
+// Each File starts with a random nonce, and since CTR mode is a stream cipher, ReadAt at any
+// offset decrypts only the bytes requested with no block alignment. CTR mode does not
+// authenticate the contents, so it doesn't detect tampering with the stored Files.
+func NewAESCTRFS(inner FileSystem, key []byte) (FileSystem, error) {
+	c, err := NewAESCTRCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return NewCipherFS(inner, c), nil
+}
+
+// NewAESCTRCipher returns the AES-CTR Cipher used by NewAESCTRFS, its nonce is the initial counter block.
+func NewAESCTRCipher(key []byte) (Cipher, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return aesCTR{block}, nil
+}
+
+type aesCTR struct{ block cipher.Block }
+
+func (c aesCTR) NonceSize() int { return c.block.BlockSize() }
+
+func (c aesCTR) SealAt(dst, src, nonce []byte, off int64) error {
+	c.xorKeyStreamAt(dst, src, nonce, off)
+	return nil
+}
+
+func (c aesCTR) OpenAt(dst, src, nonce []byte, off int64) error {
+	c.xorKeyStreamAt(dst, src, nonce, off)
+	return nil
+}
+
+// xorKeyStreamAt XORs src with the key stream starting at off into dst.
+func (c aesCTR) xorKeyStreamAt(dst, src, iv []byte, off int64) {
+	size := int64(c.block.BlockSize())
+
+	// counter = iv + off/size, as a big-endian integer
+	ctr := make([]byte, len(iv))
+	copy(ctr, iv)
+	carry := uint64(off / size)
+	for i := len(ctr); i > 0 && carry > 0; i -= 8 {
+		word := binary.BigEndian.Uint64(ctr[i-8 : i])
+		sum := word + carry
+		binary.BigEndian.PutUint64(ctr[i-8:i], sum)
+		carry = 0
+		if sum < word {
+			carry = 1
+		}
+	}
+
+	stream := cipher.NewCTR(c.block, ctr)
+	if skip := off % size; skip > 0 {
+		discard := make([]byte, skip)
+		stream.XORKeyStream(discard, discard)
+	}
+	stream.XORKeyStream(dst, src)
+}
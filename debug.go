@@ -0,0 +1,126 @@
+package stream
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// DebugDump writes the state of the Stream to w, with each open Reader's Read offset and whether
+// it's blocked waiting for data (and for how long), reading from the File, or idle. This helps
+// debug a Remove which hangs, waiting for Readers which were never Closed.
+func (s *Stream) DebugDump(w io.Writer) error {
+	size, _ := s.b.Size()
+	readers, writerOpen := s.b.Handles()
+	if _, err := fmt.Fprintf(w, "stream %q: %s, size %d, %d readers, writer open: %t\n",
+		s.Name(), s.b.State(), size, readers, writerOpen); err != nil {
+		return err
+	}
+
+	rs := s.b.Readers()
+	sort.Slice(rs, func(i, j int) bool {
+		return atomic.LoadInt64(&rs[i].stats.off) < atomic.LoadInt64(&rs[j].stats.off)
+	})
+	now := time.Now()
+	for _, r := range rs {
+		if _, err := fmt.Fprintf(w, "  reader %s: offset %d, %s\n",
+			r.id(), atomic.LoadInt64(&r.stats.off), r.stats.state(now)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReaderInfo describes an open Reader of a Stream, see Stream.Readers.
+type ReaderInfo struct {
+	Reader     *Reader
+	Label      string        // see Stream.NextReaderLabeled
+	Offset     int64         // the offset of the next Read, see Reader.Offset
+	Opened     time.Time     // when NextReader created the Reader
+	Blocked    bool          // whether the Reader is waiting for data to be written
+	BlockedFor time.Duration // how long the Reader has been Blocked
+	WaitingFor int64         // the offset the Reader is Blocked waiting for
+}
+
+// Readers returns the open Readers of the Stream, in the order they were opened, so admin
+// endpoints can show who is attached to it and whether they're keeping up.
+func (s *Stream) Readers() []ReaderInfo {
+	rs := s.b.Readers()
+	now := time.Now()
+	infos := make([]ReaderInfo, len(rs))
+	for i, r := range rs {
+		infos[i] = ReaderInfo{Reader: r, Label: r.label, Offset: r.Offset(), Opened: r.opened}
+		if since := atomic.LoadInt64(&r.stats.waitingSince); since != 0 {
+			infos[i].Blocked = true
+			infos[i].BlockedFor = now.Sub(time.Unix(0, since))
+			infos[i].WaitingFor = atomic.LoadInt64(&r.stats.waitingFor)
+		}
+	}
+	sort.SliceStable(infos, func(i, j int) bool { return infos[i].Opened.Before(infos[j].Opened) })
+	return infos
+}
+
+// state describes what the Reader is doing, for DebugDump.
+func (s *readerStats) state(now time.Time) string {
+	if since := atomic.LoadInt64(&s.waitingSince); since != 0 {
+		return fmt.Sprintf("blocked for %v waiting for offset %d",
+			now.Sub(time.Unix(0, since)).Round(time.Millisecond), atomic.LoadInt64(&s.waitingFor))
+	}
+	if since := atomic.LoadInt64(&s.readingSince); since != 0 {
+		return fmt.Sprintf("reading for %v", now.Sub(time.Unix(0, since)).Round(time.Millisecond))
+	}
+	return "idle"
+}
+
+// String describes the Stream by its name, state, size and open Readers, ex. for logging with %v.
+func (s *Stream) String() string {
+	size, _ := s.b.Size()
+	readers, _ := s.b.Handles()
+	return fmt.Sprintf("stream %q (%s, %d bytes, %d readers)", s.Name(), s.b.State(), size, readers)
+}
+
+// GoString is like String, for %#v.
+func (s *Stream) GoString() string {
+	size, _ := s.b.Size()
+	readers, _ := s.b.Handles()
+	return fmt.Sprintf("&stream.Stream{Name: %q, State: %q, Size: %d, Readers: %d}", s.Name(), s.b.State(), size, readers)
+}
+
+// String describes the Reader by its label (see Stream.NextReaderLabeled), the name of its Stream,
+// its Read offset, and what it's doing (see DebugDump).
+func (r *Reader) String() string {
+	if r.label != "" {
+		return fmt.Sprintf("reader %q of %q at offset %d (%s)", r.label, r.s.Name(), atomic.LoadInt64(&r.stats.off), r.stats.state(time.Now()))
+	}
+	return fmt.Sprintf("reader of %q at offset %d (%s)", r.s.Name(), atomic.LoadInt64(&r.stats.off), r.stats.state(time.Now()))
+}
+
+// GoString is like String, for %#v.
+func (r *Reader) GoString() string {
+	return fmt.Sprintf("&stream.Reader{Label: %q, Stream: %q, Offset: %d}", r.label, r.s.Name(), atomic.LoadInt64(&r.stats.off))
+}
+
+// id identifies the Reader in DebugDump, by its label or else its address.
+func (r *Reader) id() string {
+	if r.label != "" {
+		return r.label
+	}
+	return fmt.Sprintf("%p", r)
+}
+
+// reportLeaks reports the Readers which are still open, see WithLeakDetection.
+func (s *Stream) reportLeaks() {
+	for _, r := range s.b.Readers() {
+		s.onLeak(r, r.created)
+	}
+}
+
+// closeLeaks Closes the Readers which are still open, see WithReaderAutoClose.
+func (s *Stream) closeLeaks() {
+	for _, r := range s.b.Readers() {
+		s.onClosed(r)
+		r.Close()
+	}
+}
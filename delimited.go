@@ -0,0 +1,63 @@
+package stream
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// maxDelimitedSize is the largest record ReadDelimited accepts, so a corrupt length can't allocate unbounded memory.
+const maxDelimitedSize = 64 << 20
+
+// ErrRecordTooLarge is returned by ReadDelimited for a record larger than 64MB.
+var ErrRecordTooLarge = errors.New("stream: record too large")
+
+// WriteDelimited Writes p to the Stream prefixed with its length as a uvarint, in a single Write.
+// This is the framing of protodelim (and of protobuf's writeDelimitedTo in other languages),
+// so a stream of messages can be written with WriteDelimited(proto.Marshal(m)) and read back
+// by protodelim.UnmarshalFrom, or ReadDelimited.
+func (s *Stream) WriteDelimited(p []byte) error {
+	buf := make([]byte, binary.MaxVarintLen64+len(p))
+	n := binary.PutUvarint(buf, uint64(len(p)))
+	n += copy(buf[n:], p)
+	_, err := s.Write(buf[:n])
+	return err
+}
+
+// ReadDelimited reads the next record Written with WriteDelimited, blocking until all of it is
+// written. It returns io.EOF once the Stream is Closed and every record has been read, or
+// io.ErrUnexpectedEOF if the Stream ends within a record. ReadDelimited doesn't read ahead,
+// so it can be mixed with other Reads.
+func (r *Reader) ReadDelimited() ([]byte, error) {
+	size, err := binary.ReadUvarint(byteReader{r})
+	switch {
+	case err == io.EOF:
+		return nil, io.EOF
+
+	case err != nil:
+		return nil, err
+
+	case size > maxDelimitedSize:
+		return nil, ErrRecordTooLarge
+	}
+
+	p := make([]byte, size)
+	if _, err := io.ReadFull(r, p); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return p, nil
+}
+
+// byteReader reads one byte at a time, so nothing is read past the end of a uvarint.
+type byteReader struct {
+	io.Reader
+}
+
+func (b byteReader) ReadByte() (byte, error) {
+	var p [1]byte
+	_, err := io.ReadFull(b.Reader, p[:])
+	return p[0], err
+}
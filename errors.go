@@ -0,0 +1,64 @@
+package stream
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Error records a failed operation on a Stream, its Reader, or the File backing it.
+// Read, Write, Seek, and the FileSystem calls made for a Stream return their failures as an *Error,
+// so callers can use errors.As to find out which operation failed where, and errors.Is on the cause.
+// io.EOF, ErrCanceled and ErrWriterClosed are returned as is, since they report the state of the Stream.
+type Error struct {
+	Op   string // the operation, ex. "read", "write", "seek", "open", "create" or "remove"
+	Name string // the name of the Stream
+	Off  int64  // the offset of the operation, or -1 if it isn't at an offset
+	Err  error  // the cause
+}
+
+func (e *Error) Error() string {
+	if e.Off < 0 {
+		return fmt.Sprintf("stream: %s %s: %v", e.Op, e.Name, e.Err)
+	}
+	return fmt.Sprintf("stream: %s %s at offset %d: %v", e.Op, e.Name, e.Off, e.Err)
+}
+
+// Unwrap returns the cause of the Error.
+func (e *Error) Unwrap() error { return e.Err }
+
+// SizeError reports that the size of a Stream isn't the size it was declared to be, see CloseWithSize.
+type SizeError struct {
+	Want int64 // the declared size
+	Got  int64 // the size written
+}
+
+func (e *SizeError) Error() string {
+	return fmt.Sprintf("stream: wrote %d bytes, want %d", e.Got, e.Want)
+}
+
+// ErrCorrupt is matched (see errors.Is) by a *CorruptError.
+var ErrCorrupt = errors.New("corrupt data")
+
+// CorruptError reports that a chunk of a File doesn't match the checksum it was written with, see NewChecksumFS.
+type CorruptError struct {
+	Name string // the name of the File
+	Off  int64  // the offset of the chunk
+	Len  int64  // the length of the chunk
+}
+
+func (e *CorruptError) Error() string {
+	return fmt.Sprintf("stream: %s: %d bytes at offset %d don't match their checksum", e.Name, e.Len, e.Off)
+}
+
+// Is reports ErrCorrupt as the cause of a CorruptError.
+func (e *CorruptError) Is(target error) bool { return target == ErrCorrupt }
+
+// wrapErr returns err as an *Error with the operation, the name of the Stream and the offset (or -1).
+// io.EOF is never wrapped, since it's expected to be compared with ==.
+func wrapErr(op, name string, off int64, err error) error {
+	if err == nil || err == io.EOF {
+		return err
+	}
+	return &Error{Op: op, Name: name, Off: off, Err: err}
+}
@@ -0,0 +1,108 @@
+package stream
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+var errRange = errors.New("invalid range")
+
+// Extent is a range of a Stream.
+type Extent struct {
+	Off int64
+	Len int64
+}
+
+// extentSet is a set of ranges of a Stream, ex. those deallocated by PunchHole.
+type extentSet struct {
+	some    int32 // 1 once there are extents, to skip the lock otherwise
+	mu      sync.RWMutex
+	extents []Extent // sorted and merged
+}
+
+// Extents returns the ranges of the Stream which have been written and not discarded with PunchHole.
+// Holes are only tracked in memory, by the Stream which punched them: a Stream reopened with OpenStream
+// reports them as written, and reads them as zeros.
+func (s *Stream) Extents() []Extent {
+	size, _ := s.b.Size()
+	s.holes.mu.RLock()
+	defer s.holes.mu.RUnlock()
+	var extents []Extent
+	var off int64
+	for _, h := range s.holes.extents {
+		if h.Off > off {
+			extents = append(extents, Extent{Off: off, Len: h.Off - off})
+		}
+		off = h.Off + h.Len
+	}
+	if size > off {
+		extents = append(extents, Extent{Off: off, Len: size - off})
+	}
+	return extents
+}
+
+// PunchHole discards the n written bytes of the Stream starting at off, deallocating them from
+// the File so they no longer take disk space, ex. once every Reader is past them. Reads of the
+// discarded range return ErrTrimmed. It returns ErrUnsupported unless the File supports it, as an
+// *os.File of StdFileSystem does on Linux (on most filesystems). Holes can only be punched while the
+// Stream is being written: once it's Closed (or Canceled), PunchHole returns ErrWriterClosed.
+func (s *Stream) PunchHole(off, n int64) error {
+	if size, _ := s.b.Size(); off < 0 || n < 0 || off+n > size {
+		return &Error{Op: "punch", Name: s.Name(), Off: off, Err: errRange}
+	}
+	if n == 0 {
+		return nil
+	}
+
+	// s.mu keeps Close from closing s.file while it's in use
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.b.IsOpen() {
+		return wrapErr("punch", s.Name(), off, ErrWriterClosed)
+	}
+	s.holes.mu.Lock()
+	defer s.holes.mu.Unlock()
+	if err := punchHole(s.file, off, n); err != nil {
+		if err == ErrUnsupported {
+			return err
+		}
+		return wrapErr("punch", s.Name(), off, err)
+	}
+	s.holes.add(Extent{Off: off, Len: n})
+	return nil
+}
+
+// add merges e into the set, h.mu must be held.
+func (h *extentSet) add(e Extent) {
+	atomic.StoreInt32(&h.some, 1)
+	all := append(h.extents, e)
+	sort.Slice(all, func(i, j int) bool { return all[i].Off < all[j].Off })
+	merged := all[:0]
+	for _, x := range all {
+		if last := len(merged) - 1; last >= 0 && x.Off <= merged[last].Off+merged[last].Len {
+			if end := x.Off + x.Len; end > merged[last].Off+merged[last].Len {
+				merged[last].Len = end - merged[last].Off
+			}
+			continue
+		}
+		merged = append(merged, x)
+	}
+	h.extents = merged
+}
+
+// overlaps reports whether [off, off+n) overlaps an extent of the set.
+func (h *extentSet) overlaps(off, n int64) bool {
+	if atomic.LoadInt32(&h.some) == 0 {
+		return false
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for _, x := range h.extents {
+		if x.Off < off+n && off < x.Off+x.Len {
+			return true
+		}
+	}
+	return false
+}
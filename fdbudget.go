@@ -0,0 +1,168 @@
+package stream
+
+import (
+	"container/list"
+	"io"
+	"os"
+	"sync"
+)
+
+// FDBudget caps how many Files the Readers of the Streams using it (see WithFDBudget) hold open
+// at once. A Reader only Opens its File when it's first read from, and if the budget is used up,
+// the File of the least recently used idle Reader is Closed, to be transparently reopened when
+// that Reader is next read from. If every open File is in use, reads wait for one to be free.
+// This lets a process hold many more Readers than it can hold file descriptors.
+type FDBudget struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+	max  int
+	open int
+	idle *list.List // of *lazyFile, open but not in use, least recently used first
+}
+
+// NewFDBudget returns an FDBudget of max open Files, which can be shared by many Streams.
+func NewFDBudget(max int) *FDBudget {
+	b := &FDBudget{max: max, idle: list.New()}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+// Open returns the number of Files currently open within the budget.
+func (b *FDBudget) Open() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.open
+}
+
+// lazyFile is a Reader's File within an FDBudget. Its fields are guarded by budget.mu.
+type lazyFile struct {
+	budget *FDBudget
+	fs     FileSystem
+	name   func() string // the File's current name, which changes if it's renamed
+
+	file    File          // nil if not open
+	elem    *list.Element // in budget.idle, nil if not idle
+	inUse   int
+	opening bool
+	closed  bool
+
+	mu  sync.Mutex // guards off
+	off int64      // offset for Read
+}
+
+func (b *FDBudget) newFile(fs FileSystem, name func() string) *lazyFile {
+	return &lazyFile{budget: b, fs: fs, name: name}
+}
+
+// use returns the open File, opening it if needed, and pins it until done is called.
+func (f *lazyFile) use() (File, error) {
+	b := f.budget
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for {
+		switch {
+		case f.closed:
+			return nil, os.ErrClosed
+
+		case f.file != nil:
+			if f.elem != nil {
+				b.idle.Remove(f.elem)
+				f.elem = nil
+			}
+			f.inUse++
+			return f.file, nil
+
+		case f.opening:
+			b.cond.Wait()
+
+		case b.open < b.max:
+			b.open++
+			f.opening = true
+			b.mu.Unlock()
+			file, err := f.fs.Open(f.name())
+			b.mu.Lock()
+			f.opening = false
+			b.cond.Broadcast()
+			if err != nil {
+				b.open--
+				return nil, err
+			}
+			f.file = file
+
+		case b.idle.Len() > 0:
+			victim := b.idle.Remove(b.idle.Front()).(*lazyFile)
+			victim.elem = nil
+			vf := victim.file
+			victim.file = nil
+			b.open--
+			b.mu.Unlock()
+			vf.Close()
+			b.mu.Lock()
+
+		default:
+			b.cond.Wait()
+		}
+	}
+}
+
+// done unpins the File, making it evictable once no read is using it.
+func (f *lazyFile) done() {
+	b := f.budget
+	b.mu.Lock()
+	f.inUse--
+	if f.inUse == 0 && f.file != nil && !f.closed {
+		f.elem = b.idle.PushBack(f)
+	}
+	b.mu.Unlock()
+	b.cond.Broadcast()
+}
+
+func (f *lazyFile) Name() string { return f.name() }
+
+func (f *lazyFile) ReadAt(p []byte, off int64) (int, error) {
+	file, err := f.use()
+	if err != nil {
+		return 0, err
+	}
+	defer f.done()
+	return file.ReadAt(p, off)
+}
+
+func (f *lazyFile) Read(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n, err := f.ReadAt(p, f.off)
+	f.off += int64(n)
+	if n > 0 && err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+func (f *lazyFile) Write(p []byte) (int, error) { return 0, ErrUnsupported }
+
+func (f *lazyFile) Close() error {
+	b := f.budget
+	b.mu.Lock()
+	if f.closed {
+		b.mu.Unlock()
+		return os.ErrClosed
+	}
+	f.closed = true
+	if f.elem != nil {
+		b.idle.Remove(f.elem)
+		f.elem = nil
+	}
+	file := f.file
+	if file != nil {
+		f.file = nil
+		b.open--
+	}
+	b.mu.Unlock()
+	b.cond.Broadcast()
+
+	if file == nil {
+		return nil
+	}
+	return file.Close()
+}
@@ -0,0 +1,128 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package stream
+
+import (
+	"io"
+	"os"
+	"sync"
+	"syscall"
+)
+
+// NewFIFOFS returns a FileSystem backed by named pipes (FIFOs), for low-latency Streams with
+// a single Reader which don't need to persist their data. The Stream API (Close, Cancel, and
+// their errors) works as usual, but:
+//
+// - Only one Reader can be Opened per File, NextReader returns ErrUnsupported after that.
+// - The Reader can only read sequentially, ReadAt at any other offset returns ErrUnsupported.
+// - Data is held in the pipe's buffer, so Writes block while it's full, until the Reader catches up.
+func NewFIFOFS() FileSystem {
+	return &fifoFS{opened: make(map[string]bool)}
+}
+
+type fifoFS struct {
+	mu     sync.Mutex
+	opened map[string]bool
+}
+
+func (fs *fifoFS) Create(name string) (File, error) {
+	if err := syscall.Mkfifo(name, 0600); err != nil {
+		return nil, &os.PathError{Op: "mkfifo", Path: name, Err: err}
+	}
+	// opening for reading too means this doesn't block until the Reader opens the FIFO
+	f, err := os.OpenFile(name, os.O_RDWR, 0)
+	if err != nil {
+		os.Remove(name)
+		return nil, err
+	}
+	fs.mu.Lock()
+	fs.opened[name] = false
+	fs.mu.Unlock()
+	return &fifoWriter{File: f}, nil
+}
+
+func (fs *fifoFS) Open(name string) (File, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.opened[name] {
+		return nil, ErrUnsupported
+	}
+	f, err := os.OpenFile(name, os.O_RDONLY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := f.SyscallConn()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	fs.opened[name] = true
+	return &fifoReader{File: f, raw: raw}, nil
+}
+
+func (fs *fifoFS) Remove(name string) error {
+	fs.mu.Lock()
+	delete(fs.opened, name)
+	fs.mu.Unlock()
+	return os.Remove(name)
+}
+
+// fifoWriter is the writing end of a FIFO, it can't be read from.
+type fifoWriter struct {
+	*os.File
+}
+
+func (w *fifoWriter) Read(p []byte) (int, error) { return 0, ErrUnsupported }
+
+func (w *fifoWriter) ReadAt(p []byte, off int64) (int, error) { return 0, ErrUnsupported }
+
+// fifoReader is the reading end of a FIFO. A read with no data available returns io.EOF
+// instead of waiting, so that the Stream waits for Writes like with any other File.
+type fifoReader struct {
+	*os.File
+	raw syscall.RawConn
+
+	mu  sync.Mutex
+	off int64 // bytes read from the FIFO
+}
+
+func (r *fifoReader) Write(p []byte) (int, error) { return 0, ErrUnsupported }
+
+func (r *fifoReader) Read(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.read(p)
+}
+
+func (r *fifoReader) ReadAt(p []byte, off int64) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if off != r.off {
+		return 0, ErrUnsupported
+	}
+	return r.read(p)
+}
+
+func (r *fifoReader) read(p []byte) (n int, err error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	rerr := r.raw.Read(func(fd uintptr) bool {
+		n, err = syscall.Read(int(fd), p)
+		return true // never wait for the poller
+	})
+	if rerr != nil {
+		return 0, rerr
+	}
+	switch {
+	case err == syscall.EAGAIN || err == syscall.EINTR:
+		return 0, io.EOF
+	case err != nil:
+		return 0, &os.PathError{Op: "read", Path: r.Name(), Err: err}
+	case n <= 0:
+		return 0, io.EOF
+	}
+	r.off += int64(n)
+	return n, nil
+}
@@ -0,0 +1,55 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package stream
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFIFOFS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fs := NewFIFOFS()
+	f, err := NewStream(filepath.Join(dir, "fifo"), fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Remove()
+	r, err := f.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if _, err := f.NextReader(); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("expected a second Reader to be unsupported, got %v", err)
+	}
+
+	go func() {
+		f.Write(testdata[:5])
+		time.Sleep(10 * time.Millisecond)
+		f.Write(testdata[5:])
+		f.Close()
+	}()
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, testdata) {
+		t.Errorf("Want/got: %q/%q", testdata, data)
+	}
+	if _, err := r.ReadAt(make([]byte, 1), 0); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("expected ReadAt behind the Reader to be unsupported, got %v", err)
+	}
+}
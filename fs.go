@@ -1,6 +1,7 @@
 package stream
 
 import (
+	"context"
 	"io"
 	"os"
 )
@@ -21,19 +22,172 @@ type FileSystem interface {
 	Remove(name string) error         // Remove deletes an existing File
 }
 
+// FileSystemContext is implemented by FileSystems whose operations can be canceled, or traced, through
+// a context.Context, like those of cloud storage backends. Streams use it when given a context (see
+// NewStreamContext, Stream.NextReaderContext and Stream.RemoveContext), and use the FileSystem methods
+// otherwise. The context only applies to the operation, not to the use of the File it returns.
+// The FileSystems of this package which wrap another one pass the context on to it.
+type FileSystemContext interface {
+	FileSystem
+	CreateContext(ctx context.Context, name string) (File, error)
+	OpenContext(ctx context.Context, name string) (File, error)
+	RemoveContext(ctx context.Context, name string) error
+}
+
+// createContext Creates name in fs, with ctx if fs is a FileSystemContext.
+func createContext(ctx context.Context, fs FileSystem, name string) (File, error) {
+	if fc, ok := fs.(FileSystemContext); ok {
+		return fc.CreateContext(ctx, name)
+	}
+	return fs.Create(name)
+}
+
+// openContext Opens name in fs, with ctx if fs is a FileSystemContext.
+func openContext(ctx context.Context, fs FileSystem, name string) (File, error) {
+	if fc, ok := fs.(FileSystemContext); ok {
+		return fc.OpenContext(ctx, name)
+	}
+	return fs.Open(name)
+}
+
+// removeContext Removes name from fs, with ctx if fs is a FileSystemContext.
+func removeContext(ctx context.Context, fs FileSystem, name string) error {
+	if fc, ok := fs.(FileSystemContext); ok {
+		return fc.RemoveContext(ctx, name)
+	}
+	return fs.Remove(name)
+}
+
+// WriterContext is implemented by Files whose Writes can be canceled, or traced, through a context.Context.
+// Streams use it for Stream.WriteContext, and Writes with a deadline (see Stream.SetWriteDeadline).
+// The Files of this package which wrap another one pass the context on to it.
+type WriterContext interface {
+	WriteContext(ctx context.Context, p []byte) (int, error)
+}
+
+// writeContext Writes p to f, with ctx if f is a WriterContext.
+func writeContext(ctx context.Context, f io.Writer, p []byte) (int, error) {
+	if wc, ok := f.(WriterContext); ok {
+		return wc.WriteContext(ctx, p)
+	}
+	return f.Write(p)
+}
+
+// contextWriter Writes to w with ctx, see writeContext.
+type contextWriter struct {
+	ctx context.Context
+	w   io.Writer
+}
+
+func (w contextWriter) Write(p []byte) (int, error) { return writeContext(w.ctx, w.w, p) }
+
+// Renamer is implemented by FileSystems which can rename Files, which is required by
+// options which finalize a Stream under a new name.
+type Renamer interface {
+	Rename(oldname, newname string) error // Rename must keep already Opened Files readable
+}
+
+// canRename reports whether fs can Rename Files. FileSystems wrapping another one implement
+// Renamer, but can only Rename if the wrapped FileSystem can.
+func canRename(fs FileSystem) bool {
+	if w, ok := fs.(interface{ canRename() bool }); ok {
+		return w.canRename()
+	}
+	_, ok := fs.(Renamer)
+	return ok
+}
+
+// syncFile commits f to stable storage, if it supports Sync (like *os.File).
+func syncFile(f File) error {
+	if s, ok := f.(interface{ Sync() error }); ok {
+		return s.Sync()
+	}
+	return nil
+}
+
+// syncDir commits the directory entry of name to stable storage, if fs supports it (like StdFileSystem).
+func syncDir(fs FileSystem, name string) error {
+	if d, ok := fs.(interface{ syncDir(name string) error }); ok {
+		return d.syncDir(name)
+	}
+	return nil
+}
+
 // StdFileSystem is backed by the os package.
+// On Windows, Files are opened with FILE_SHARE_DELETE so that a File can be removed while
+// it's still open, and open Readers keep working. Unlike on Unix, depending on the version of
+// Windows, the name may stay in use until every handle is closed, and Creating a File with
+// the same name fails until then.
 var StdFileSystem FileSystem = stdFS{}
 
 type stdFS struct{}
 
 func (fs stdFS) Create(name string) (File, error) {
-	return os.Create(name)
+	return createFile(name)
 }
 
 func (fs stdFS) Open(name string) (File, error) {
-	return os.Open(name)
+	return openFile(name)
 }
 
 func (fs stdFS) Remove(name string) error {
 	return os.Remove(name)
 }
+
+func (fs stdFS) Rename(oldname, newname string) error {
+	return os.Rename(oldname, newname)
+}
+
+func (fs stdFS) syncDir(name string) error {
+	return syncParentDir(name)
+}
+
+// fileSize returns the current size of f, using Stat if f supports it (like *os.File),
+// and otherwise searching for the end of f with ReadAt.
+func fileSize(f File) (int64, error) {
+	if s, ok := f.(interface{ Stat() (os.FileInfo, error) }); ok {
+		info, err := s.Stat()
+		if err != nil {
+			return 0, err
+		}
+		return info.Size(), nil
+	}
+
+	exists := func(off int64) (bool, error) {
+		n, err := f.ReadAt(make([]byte, 1), off)
+		if n == 1 {
+			return true, nil
+		}
+		if err == io.EOF || err == nil {
+			return false, nil
+		}
+		return false, err
+	}
+
+	// find an upper bound, then binary search for the last byte
+	hi := int64(1)
+	for {
+		ok, err := exists(hi - 1)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			break
+		}
+		hi *= 2
+	}
+	lo := hi / 2 // size >= lo, size < hi
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		ok, err := exists(mid)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	return lo, nil
+}
@@ -0,0 +1,26 @@
+//go:build !windows
+// +build !windows
+
+package stream
+
+import (
+	"os"
+	"path/filepath"
+)
+
+func createFile(name string) (*os.File, error) { return os.Create(name) }
+
+func openFile(name string) (*os.File, error) { return os.Open(name) }
+
+// syncParentDir syncs the directory containing name, so that its creation or rename is durable.
+func syncParentDir(name string) error {
+	d, err := os.Open(filepath.Dir(name))
+	if err != nil {
+		return err
+	}
+	err = d.Sync()
+	if cerr := d.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
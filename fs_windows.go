@@ -0,0 +1,35 @@
+//go:build windows
+// +build windows
+
+package stream
+
+import (
+	"os"
+	"syscall"
+)
+
+// createFile is os.Create, except the File is shared with FILE_SHARE_DELETE.
+func createFile(name string) (*os.File, error) {
+	return openShared(name, syscall.GENERIC_READ|syscall.GENERIC_WRITE, syscall.CREATE_ALWAYS)
+}
+
+// openFile is os.Open, except the File is shared with FILE_SHARE_DELETE.
+func openFile(name string) (*os.File, error) {
+	return openShared(name, syscall.GENERIC_READ, syscall.OPEN_EXISTING)
+}
+
+func openShared(name string, access, mode uint32) (*os.File, error) {
+	path, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: name, Err: err}
+	}
+	const share = syscall.FILE_SHARE_READ | syscall.FILE_SHARE_WRITE | syscall.FILE_SHARE_DELETE
+	h, err := syscall.CreateFile(path, access, share, nil, mode, syscall.FILE_ATTRIBUTE_NORMAL, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: name, Err: err}
+	}
+	return os.NewFile(uintptr(h), name), nil
+}
+
+// syncParentDir is a no-op, Windows doesn't support syncing directories.
+func syncParentDir(name string) error { return nil }
@@ -0,0 +1,44 @@
+//go:build windows
+// +build windows
+
+package stream
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestStdRemoveWhileOpenWindows(t *testing.T) {
+	name := t.Name() + ".txt"
+	w, err := StdFileSystem.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := StdFileSystem.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := StdFileSystem.Remove(name); err != nil {
+		t.Fatalf("expected Remove to succeed with open Files, got %v", err)
+	}
+
+	w.Write(testdata)
+	buf := make([]byte, len(testdata))
+	if _, err := r.ReadAt(buf, 0); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf, testdata) {
+		t.Errorf("expected %q, got %q", testdata, buf)
+	}
+
+	w.Close()
+	r.Close()
+
+	f, err := StdFileSystem.Create(name)
+	if err != nil {
+		t.Fatalf("expected Create to succeed once every handle is closed, got %v", err)
+	}
+	f.Close()
+	StdFileSystem.Remove(name)
+}
@@ -0,0 +1,54 @@
+package stream
+
+import (
+	"encoding/gob"
+	"io"
+)
+
+// EncodeGob Writes v to the Stream with encoding/gob, in a single Write. The Stream has one
+// gob.Encoder, so type information is only sent before the first value of each type, and
+// every Reader must decode the Stream from the start, with DecodeGob.
+func (s *Stream) EncodeGob(v interface{}) error {
+	s.gobMu.Lock()
+	defer s.gobMu.Unlock()
+	if s.gobEnc == nil {
+		s.gobEnc = gob.NewEncoder(&s.gobBuf)
+	}
+	s.gobBuf.Reset()
+	if err := s.gobEnc.Encode(v); err != nil {
+		return err
+	}
+	_, err := s.Write(s.gobBuf.Bytes())
+	return err
+}
+
+// DecodeGob decodes the next value Written with EncodeGob into v, blocking until all of it is
+// written. It returns io.EOF once the Stream is Closed and every value has been read.
+// Each Reader has its own gob.Decoder, which reads ahead, so DecodeGob shouldn't be mixed with other Reads.
+func (r *Reader) DecodeGob(v interface{}) error {
+	r.decMu.Lock()
+	defer r.decMu.Unlock()
+	if r.gobDec == nil {
+		r.gobDec = gob.NewDecoder(r)
+	}
+	return r.gobDec.Decode(v)
+}
+
+// GobCodec is a RecordCodec using encoding/gob, for Typed Streams.
+type GobCodec[T any] struct{}
+
+func (GobCodec[T]) NewEncoder(w io.Writer) RecordEncoder[T] {
+	return gobEncoder[T]{gob.NewEncoder(w)}
+}
+
+func (GobCodec[T]) NewDecoder(r io.Reader) RecordDecoder[T] {
+	return gobDecoder[T]{gob.NewDecoder(r)}
+}
+
+type gobEncoder[T any] struct{ enc *gob.Encoder }
+
+func (e gobEncoder[T]) Encode(v T) error { return e.enc.Encode(v) }
+
+type gobDecoder[T any] struct{ dec *gob.Decoder }
+
+func (d gobDecoder[T]) Decode(v *T) error { return d.dec.Decode(v) }
@@ -0,0 +1,44 @@
+package stream
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+)
+
+// NewGzipFS returns a FileSystem which stores Files gzip-compressed in inner, while still
+// supporting ReadAt (and so Reader.Seek) on the uncompressed content.
+//
+// Files are written as a series of independent gzip members of blockSize uncompressed bytes,
+// so the stored file is still a valid gzip file. The offsets of the members are indexed in
+// name + ".idx" on Close, so a ReadAt only has to decompress the members it covers.
+// Bytes which have been written but not yet compressed into a member are readable from memory
+// by Files Opened through the same FileSystem.
+func NewGzipFS(inner FileSystem, blockSize int) FileSystem {
+	return NewCodecFS(inner, blockSize, gzipCodec{})
+}
+
+type gzipCodec struct{}
+
+func (gzipCodec) Name() string { return "gzip" }
+
+func (gzipCodec) Compress(p []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(p); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gzipCodec) Decompress(p []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(p))
+	if err != nil {
+		return nil, err
+	}
+	r.Multistream(false)
+	return ioutil.ReadAll(r)
+}
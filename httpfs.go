@@ -0,0 +1,156 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync/atomic"
+)
+
+// NewHTTPRangeFS returns a read-only FileSystem of remote objects, whose Files are read with HTTP Range
+// requests to the URL made by replacing "{name}" in urlTemplate (ex. "https://cdn.example.com/objects/{name}")
+// with the escaped name of the File, using client (http.DefaultClient if nil). A Stream Opened from it
+// (see OpenStream) is a local view of the remote object, which only fetches what its Readers read.
+// Create and Remove return ErrUnsupported. It's a FileSystemContext, whose OpenContext cancels the request
+// checking that the object exists when ctx is done.
+func NewHTTPRangeFS(urlTemplate string, client *http.Client) FileSystem {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return httpRangeFS{template: urlTemplate, client: client}
+}
+
+type httpRangeFS struct {
+	template string
+	client   *http.Client
+}
+
+func (fs httpRangeFS) Create(name string) (File, error) {
+	return nil, &os.PathError{Op: "create", Path: name, Err: ErrUnsupported}
+}
+
+func (fs httpRangeFS) CreateContext(ctx context.Context, name string) (File, error) {
+	return fs.Create(name)
+}
+
+func (fs httpRangeFS) Open(name string) (File, error) {
+	return fs.OpenContext(context.Background(), name)
+}
+
+func (fs httpRangeFS) OpenContext(ctx context.Context, name string) (File, error) {
+	u := strings.ReplaceAll(fs.template, "{name}", url.PathEscape(name))
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, u, nil)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: name, Err: err}
+	}
+	resp, err := fs.client.Do(req)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: name, Err: err}
+	}
+	resp.Body.Close()
+	if err := statusErr("open", name, resp); err != nil {
+		return nil, err
+	}
+	return &httpFile{client: fs.client, url: u, name: name}, nil
+}
+
+func (fs httpRangeFS) Remove(name string) error {
+	return &os.PathError{Op: "remove", Path: name, Err: ErrUnsupported}
+}
+
+func (fs httpRangeFS) RemoveContext(ctx context.Context, name string) error {
+	return fs.Remove(name)
+}
+
+// httpFile is a File read with HTTP Range requests.
+type httpFile struct {
+	client *http.Client
+	url    string
+	name   string
+	off    int64 // for Read
+	closed int32
+}
+
+func (f *httpFile) Name() string { return f.name }
+
+func (f *httpFile) ReadAt(p []byte, off int64) (int, error) {
+	if atomic.LoadInt32(&f.closed) == 1 {
+		return 0, os.ErrClosed
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	req, err := http.NewRequest(http.MethodGet, f.url, nil)
+	if err != nil {
+		return 0, &os.PathError{Op: "read", Path: f.name, Err: err}
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", off, off+int64(len(p))-1))
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return 0, &os.PathError{Op: "read", Path: f.name, Err: err}
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusRequestedRangeNotSatisfiable:
+		return 0, io.EOF
+	case http.StatusOK: // the server ignored the Range
+		if _, err := io.CopyN(ioutil.Discard, resp.Body, off); err == io.EOF {
+			return 0, io.EOF
+		} else if err != nil {
+			return 0, &os.PathError{Op: "read", Path: f.name, Err: err}
+		}
+	case http.StatusPartialContent:
+	default:
+		return 0, statusErr("read", f.name, resp)
+	}
+
+	n, err := io.ReadFull(resp.Body, p)
+	switch err {
+	case nil:
+	case io.ErrUnexpectedEOF, io.EOF:
+		err = io.EOF
+	default:
+		err = &os.PathError{Op: "read", Path: f.name, Err: err}
+	}
+	return n, err
+}
+
+// Read reads from where the last Read stopped, and Reads again after io.EOF once more is uploaded.
+func (f *httpFile) Read(p []byte) (int, error) {
+	n, err := f.ReadAt(p, f.off)
+	f.off += int64(n)
+	if n > 0 && err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+// Stat returns the size the server reports for the File.
+func (f *httpFile) Stat() (os.FileInfo, error) {
+	resp, err := f.client.Head(f.url)
+	if err != nil {
+		return nil, &os.PathError{Op: "stat", Path: f.name, Err: err}
+	}
+	resp.Body.Close()
+	if err := statusErr("stat", f.name, resp); err != nil {
+		return nil, err
+	}
+	if resp.ContentLength < 0 {
+		return nil, &os.PathError{Op: "stat", Path: f.name, Err: ErrUnsupported}
+	}
+	return readerInfo{name: path.Base(f.name), size: resp.ContentLength}, nil
+}
+
+func (f *httpFile) Write(p []byte) (int, error) { return 0, ErrUnsupported }
+
+func (f *httpFile) Close() error {
+	atomic.StoreInt32(&f.closed, 1)
+	return nil
+}
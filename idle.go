@@ -0,0 +1,71 @@
+package stream
+
+import (
+	"sync"
+	"time"
+)
+
+// idleTimer calls a func once there has been no activity for a duration.
+// Activity spans from busy() until the func it returns is called, so a blocked Read is not idle.
+type idleTimer struct {
+	mu     sync.Mutex
+	d      time.Duration
+	active int
+	timer  *time.Timer
+}
+
+func newIdleTimer(d time.Duration) *idleTimer {
+	return &idleTimer{d: d}
+}
+
+// start starts the timer, which calls onIdle once it expires.
+func (t *idleTimer) start(onIdle func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.timer = time.AfterFunc(t.d, func() {
+		if t.expired() {
+			onIdle()
+		}
+	})
+}
+
+// busy marks the start of activity, and returns a func marking its end.
+// It's safe to call on a nil *idleTimer.
+func (t *idleTimer) busy() (done func()) {
+	if t == nil {
+		return func() {}
+	}
+
+	t.mu.Lock()
+	t.active++
+	t.timer.Stop()
+	t.mu.Unlock()
+
+	return func() {
+		t.mu.Lock()
+		t.active--
+		if t.active == 0 {
+			t.timer.Reset(t.d)
+		}
+		t.mu.Unlock()
+	}
+}
+
+// expired reports if the timer fired while there was no activity, since Stop
+// cannot prevent a timer which has already fired from calling its func.
+func (t *idleTimer) expired() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.active == 0
+}
+
+// stop stops the timer for good. It's safe to call on a nil *idleTimer.
+func (t *idleTimer) stop() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.active++ // never idle again
+	t.timer.Stop()
+	t.mu.Unlock()
+}
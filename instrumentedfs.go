@@ -0,0 +1,121 @@
+package stream
+
+import (
+	"context"
+	"time"
+)
+
+// FSMetrics receives the measurements of a FileSystem from NewInstrumentedFS, ex. to export them
+// to a metrics system. Record is called after every call, so it must be safe for concurrent use
+// and shouldn't block.
+type FSMetrics interface {
+	// Record is called with the operation ("create", "open", "remove", "rename", "read", "write" or "close"),
+	// the name of the File, the bytes read or written, how long the call took, and the error it returned.
+	Record(op, name string, n int, d time.Duration, err error)
+}
+
+// NewInstrumentedFS returns a FileSystem which records the latency and result of every call on
+// inner, and on its Files, to sink, so a slow or failing backend shows up in metrics rather than as
+// Streams which mysteriously stall. io.EOF from a Read isn't a failure, but is passed on as is.
+func NewInstrumentedFS(inner FileSystem, sink FSMetrics) FileSystem {
+	return &instrumentedFS{inner: inner, sink: sink}
+}
+
+type instrumentedFS struct {
+	inner FileSystem
+	sink  FSMetrics
+}
+
+func (fs *instrumentedFS) Create(name string) (File, error) {
+	return fs.CreateContext(context.Background(), name)
+}
+
+func (fs *instrumentedFS) CreateContext(ctx context.Context, name string) (File, error) {
+	start := time.Now()
+	f, err := createContext(ctx, fs.inner, name)
+	fs.sink.Record("create", name, 0, time.Since(start), err)
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedFile{File: f, name: name, sink: fs.sink}, nil
+}
+
+func (fs *instrumentedFS) Open(name string) (File, error) {
+	return fs.OpenContext(context.Background(), name)
+}
+
+func (fs *instrumentedFS) OpenContext(ctx context.Context, name string) (File, error) {
+	start := time.Now()
+	f, err := openContext(ctx, fs.inner, name)
+	fs.sink.Record("open", name, 0, time.Since(start), err)
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedFile{File: f, name: name, sink: fs.sink}, nil
+}
+
+func (fs *instrumentedFS) Remove(name string) error {
+	return fs.RemoveContext(context.Background(), name)
+}
+
+func (fs *instrumentedFS) RemoveContext(ctx context.Context, name string) error {
+	start := time.Now()
+	err := removeContext(ctx, fs.inner, name)
+	fs.sink.Record("remove", name, 0, time.Since(start), err)
+	return err
+}
+
+func (fs *instrumentedFS) Rename(oldname, newname string) error {
+	inner, ok := fs.inner.(Renamer)
+	if !ok {
+		return ErrUnsupported
+	}
+	start := time.Now()
+	err := inner.Rename(oldname, newname)
+	fs.sink.Record("rename", oldname, 0, time.Since(start), err)
+	return err
+}
+
+func (fs *instrumentedFS) canRename() bool { return canRename(fs.inner) }
+
+func (fs *instrumentedFS) syncDir(name string) error { return syncDir(fs.inner, name) }
+
+type instrumentedFile struct {
+	File
+	name string
+	sink FSMetrics
+}
+
+func (f *instrumentedFile) Read(p []byte) (int, error) {
+	start := time.Now()
+	n, err := f.File.Read(p)
+	f.sink.Record("read", f.name, n, time.Since(start), err)
+	return n, err
+}
+
+func (f *instrumentedFile) ReadAt(p []byte, off int64) (int, error) {
+	start := time.Now()
+	n, err := f.File.ReadAt(p, off)
+	f.sink.Record("read", f.name, n, time.Since(start), err)
+	return n, err
+}
+
+func (f *instrumentedFile) Write(p []byte) (int, error) {
+	return f.WriteContext(context.Background(), p)
+}
+
+func (f *instrumentedFile) WriteContext(ctx context.Context, p []byte) (int, error) {
+	start := time.Now()
+	n, err := writeContext(ctx, f.File, p)
+	f.sink.Record("write", f.name, n, time.Since(start), err)
+	return n, err
+}
+
+func (f *instrumentedFile) Close() error {
+	start := time.Now()
+	err := f.File.Close()
+	f.sink.Record("close", f.name, 0, time.Since(start), err)
+	return err
+}
+
+func (f *instrumentedFile) Sync() error { return syncFile(f.File) }
@@ -0,0 +1,50 @@
+//go:build go1.23
+// +build go1.23
+
+package stream
+
+import (
+	"io"
+	"iter"
+)
+
+// Chunks returns an iterator of the Stream from the Reader's Read offset, in chunks of up to size
+// bytes, for use with for-range. It blocks for more data until the Stream is Closed, and ends after
+// yielding the error the Stream ended with, if it isn't io.EOF. The chunk is only valid until the
+// next iteration, as its buffer is reused.
+func (r *Reader) Chunks(size int) iter.Seq2[[]byte, error] {
+	return func(yield func([]byte, error) bool) {
+		buf := make([]byte, size)
+		for {
+			n, err := r.Read(buf)
+			if n > 0 && !yield(buf[:n], nil) {
+				return
+			}
+			switch {
+			case err == io.EOF:
+				return
+
+			case err != nil:
+				yield(nil, err)
+				return
+			}
+		}
+	}
+}
+
+// LinesSeq returns an iterator of the lines of the Stream from the Reader's Read offset, without
+// their line endings, see Scanner. It blocks for each line until it's written, and ends after
+// yielding the error the Stream ended with, if it isn't io.EOF.
+func (r *Reader) LinesSeq() iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		sc := r.Scanner(nil)
+		for sc.Scan() {
+			if !yield(sc.Text(), nil) {
+				return
+			}
+		}
+		if err := sc.Err(); err != nil {
+			yield("", err)
+		}
+	}
+}
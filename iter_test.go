@@ -0,0 +1,78 @@
+//go:build go1.23
+// +build go1.23
+
+package stream
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestChunks(t *testing.T) {
+	f := NewMemStream()
+	r, err := f.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	go func() {
+		for i := 0; i < 3; i++ {
+			f.Write(testdata)
+		}
+		f.Close()
+	}()
+
+	var got []byte
+	for chunk, err := range r.Chunks(4) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(chunk) > 4 {
+			t.Errorf("expected chunks of up to 4 bytes, got %d", len(chunk))
+		}
+		got = append(got, chunk...)
+	}
+	if want := bytes.Repeat(testdata, 3); !bytes.Equal(got, want) {
+		t.Errorf("Want/got: %q/%q", want, got)
+	}
+}
+
+func TestLinesSeq(t *testing.T) {
+	f := NewMemStream()
+	r, err := f.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	f.Write([]byte("one\ntwo\nthree"))
+	f.Close()
+
+	var lines []string
+	for line, err := range r.LinesSeq() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) != 3 || lines[2] != "three" {
+		t.Errorf("unexpected lines: %q", lines)
+	}
+
+	f2 := NewMemStream()
+	r2, err := f2.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r2.Close()
+	f2.Cancel()
+	var last error
+	for _, err := range r2.LinesSeq() {
+		last = err
+	}
+	if !errors.Is(last, ErrCanceled) {
+		t.Errorf("expected ErrCanceled, got %v", last)
+	}
+}
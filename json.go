@@ -0,0 +1,47 @@
+package stream
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// WriteJSON Writes v to the Stream as a line of newline-delimited JSON, in a single Write,
+// so Readers using DecodeJSON never wait on half a document.
+func (s *Stream) WriteJSON(v interface{}) error {
+	p, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = s.Write(append(p, '\n'))
+	return err
+}
+
+// DecodeJSON decodes the next JSON document of the Stream into v, blocking until all of it is
+// written. It returns io.EOF once the Stream is Closed and every document has been read.
+// DecodeJSON reads ahead of the document it returns, so it shouldn't be mixed with other Reads.
+func (r *Reader) DecodeJSON(v interface{}) error {
+	r.decMu.Lock()
+	defer r.decMu.Unlock()
+	if r.jsonDec == nil {
+		r.jsonDec = json.NewDecoder(r)
+	}
+	return r.jsonDec.Decode(v)
+}
+
+// JSONCodec is a RecordCodec of newline-delimited JSON, for Typed Streams.
+type JSONCodec[T any] struct{}
+
+func (JSONCodec[T]) NewEncoder(w io.Writer) RecordEncoder[T] {
+	return jsonEncoder[T]{json.NewEncoder(w)}
+}
+func (JSONCodec[T]) NewDecoder(r io.Reader) RecordDecoder[T] {
+	return jsonDecoder[T]{json.NewDecoder(r)}
+}
+
+type jsonEncoder[T any] struct{ enc *json.Encoder }
+
+func (e jsonEncoder[T]) Encode(v T) error { return e.enc.Encode(v) }
+
+type jsonDecoder[T any] struct{ dec *json.Decoder }
+
+func (d jsonDecoder[T]) Decode(v *T) error { return d.dec.Decode(v) }
@@ -1,7 +1,6 @@
 package stream
 
 import (
-	"bytes"
 	"errors"
 	"io"
 	"os"
@@ -12,32 +11,50 @@ import (
 // ErrNotFoundInMem is returned when an in-memory FileSystem cannot find a file.
 var ErrNotFoundInMem = errors.New("not found")
 
+// ErrFileTooLarge is returned by Write to an in-memory File which would grow past the max size (see MemFSMaxFileSize).
+var ErrFileTooLarge = errors.New("file too large")
+
 type memfs struct {
-	mu    sync.RWMutex
-	files map[string]*memFile
+	mu      sync.RWMutex
+	files   map[string]*memFile
+	maxSize int64
+}
+
+// MemFSOption configures an in-memory FileSystem, see NewMemFS.
+type MemFSOption func(*memfs)
+
+// MemFSMaxFileSize caps each File at size bytes, so a single runaway Stream can't use up all memory.
+// A Write past the cap writes what fits and returns ErrFileTooLarge.
+func MemFSMaxFileSize(size int64) MemFSOption {
+	return func(fs *memfs) { fs.maxSize = size }
 }
 
 // NewMemFS returns a New in-memory FileSystem
-func NewMemFS() FileSystem {
-	return &memfs{
+func NewMemFS(opts ...MemFSOption) FileSystem {
+	fs := &memfs{
 		files: make(map[string]*memFile),
 	}
+	for _, opt := range opts {
+		opt(fs)
+	}
+	return fs
 }
 
 func (fs *memfs) Create(key string) (File, error) {
 	fs.mu.Lock()
 	defer fs.mu.Unlock()
 	file := newMemFile(key)
+	file.maxSize = fs.maxSize
+	if old, ok := fs.files[key]; ok {
+		old.release()
+	}
 	fs.files[key] = file
 	return file, nil
 }
 
 func newMemFile(name string) *memFile {
-	file := &memFile{
-		name: name,
-		r:    bytes.NewBuffer(nil),
-	}
-	file.buf.Store([]byte(nil))
+	file := &memFile{name: name, refs: 1}
+	file.data.Store(memData{})
 	file.memReader.memFile = file
 	return file
 }
@@ -47,48 +64,166 @@ func (fs *memfs) Open(key string) (File, error) {
 	defer fs.mu.RUnlock()
 
 	if f, ok := fs.files[key]; ok {
-		return &memReader{memFile: f}, nil
+		return f.open(), nil
 	}
 	return nil, ErrNotFoundInMem
 }
 
+// Remove removes the File, whose chunks are recycled for other Files once the Readers Opened on it are Closed.
 func (fs *memfs) Remove(key string) error {
 	fs.mu.Lock()
 	defer fs.mu.Unlock()
-	delete(fs.files, key)
+	if f, ok := fs.files[key]; ok {
+		delete(fs.files, key)
+		f.release()
+	}
 	return nil
 }
 
+func (fs *memfs) Rename(oldkey, newkey string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	f, ok := fs.files[oldkey]
+	if !ok {
+		return ErrNotFoundInMem
+	}
+	delete(fs.files, oldkey)
+	if old, ok := fs.files[newkey]; ok && old != f {
+		old.release()
+	}
+	fs.files[newkey] = f
+	f.rename(newkey)
+	return nil
+}
+
+// memChunkSize is the size of the chunks holding the data of an in-memory File.
+// Appending never copies what's already written, and a snapshot doesn't pin one large allocation.
+const memChunkSize = 64 << 10
+
+type memChunk = [memChunkSize]byte
+
+// memChunks recycles the chunks of Removed Files.
+var memChunks = sync.Pool{
+	New: func() interface{} { return new(memChunk) },
+}
+
+// memData is a snapshot of the data of a memFile. The chunks are never modified below size,
+// so it can be read without locking while the File is written.
+type memData struct {
+	chunks []*memChunk
+	size   int64
+}
+
+func (d memData) ReadAt(p []byte, off int64) (n int, err error) {
+	if off >= d.size {
+		return 0, io.EOF
+	}
+	if max := d.size - off; int64(len(p)) > max {
+		p, err = p[:max], io.EOF
+	}
+	for n < len(p) {
+		pos := off + int64(n)
+		n += copy(p[n:], d.chunks[pos/memChunkSize][pos%memChunkSize:])
+	}
+	return n, err
+}
+
 type memFile struct {
 	mu           sync.Mutex
 	name         string
-	r            *bytes.Buffer
-	buf          atomic.Value
+	chunks       []*memChunk
+	size         int64
+	refs         int          // the File in the memfs, and each memReader Opened on it
+	data         atomic.Value // memData
+	maxSize      int64        // 0 for no max
 	writerClosed int32
 	memReader
 }
 
 func (f *memFile) Name() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
 	return f.name
 }
 
+func (f *memFile) rename(name string) {
+	f.mu.Lock()
+	f.name = name
+	f.mu.Unlock()
+}
+
 func (f *memFile) Write(p []byte) (int, error) {
+	return f.write(len(p), func(dst []byte, off int) int { return copy(dst, p[off:]) })
+}
+
+// WriteString is like Write, without copying s to a []byte first.
+func (f *memFile) WriteString(s string) (int, error) {
+	return f.write(len(s), func(dst []byte, off int) int { return copy(dst, s[off:]) })
+}
+
+// write appends size bytes, which copyAt copies to dst starting from offset off of the data.
+func (f *memFile) write(size int, copyAt func(dst []byte, off int) int) (int, error) {
 	if atomic.LoadInt32(&f.writerClosed) == 1 {
 		return 0, os.ErrClosed
 	}
 
-	if len(p) > 0 {
+	if size > 0 {
 		f.mu.Lock()
-		n, err := f.r.Write(p)
-		f.buf.Store(f.r.Bytes())
+		var err error
+		if f.maxSize > 0 {
+			if room := f.maxSize - f.size; int64(size) > room {
+				size, err = int(room), ErrFileTooLarge
+			}
+		}
+		n := 0
+		for n < size {
+			if f.size == int64(len(f.chunks))*memChunkSize {
+				f.chunks = append(f.chunks, memChunks.Get().(*memChunk))
+			}
+			dst := f.chunks[len(f.chunks)-1][f.size%memChunkSize:]
+			if len(dst) > size-n {
+				dst = dst[:size-n]
+			}
+			k := copyAt(dst, n)
+			n += k
+			f.size += int64(k)
+		}
+		f.data.Store(memData{chunks: f.chunks, size: f.size})
 		f.mu.Unlock()
 		return n, err
 	}
-	return len(p), nil
+	return size, nil
 }
 
-func (f *memFile) Bytes() []byte {
-	return f.buf.Load().([]byte)
+// open returns a memReader of the File, which holds a reference to its chunks until it's Closed.
+func (f *memFile) open() *memReader {
+	f.mu.Lock()
+	f.refs++
+	f.mu.Unlock()
+	return &memReader{memFile: f}
+}
+
+// release drops a reference to the chunks of the File, recycling them if it was the last.
+func (f *memFile) release() {
+	f.mu.Lock()
+	f.refs--
+	if f.refs > 0 {
+		f.mu.Unlock()
+		return
+	}
+	chunks := f.chunks
+	f.chunks, f.size = nil, 0
+	f.data.Store(memData{})
+	f.mu.Unlock()
+
+	for _, c := range chunks {
+		memChunks.Put(c)
+	}
+}
+
+// snapshot returns the data written so far.
+func (f *memFile) snapshot() memData {
+	return f.data.Load().(memData)
 }
 
 func (f *memFile) Close() error {
@@ -98,7 +233,7 @@ func (f *memFile) Close() error {
 
 type memReader struct {
 	*memFile
-	n            int
+	n            int64
 	readerClosed int32
 }
 
@@ -106,26 +241,32 @@ func (r *memReader) ReadAt(p []byte, off int64) (n int, err error) {
 	if atomic.LoadInt32(&r.readerClosed) == 1 {
 		return 0, os.ErrClosed
 	}
-
-	data := r.Bytes()
-	if int64(len(data)) < off {
-		return 0, io.EOF
-	}
-	n, err = bytes.NewReader(data[off:]).ReadAt(p, 0)
-	return n, err
+	return r.snapshot().ReadAt(p, off)
 }
 
+// Read reads like an *os.File: it returns io.EOF at the end of the data written so far, whether
+// or not the writer is Closed, and Reads again once more is written, so memfs Files can be used
+// outside of a Stream. While the writer is open, it can't block or return 0, nil instead, as the
+// File contract relies on io.EOF to tell a Stream to wait for more Writes.
 func (r *memReader) Read(p []byte) (n int, err error) {
 	if atomic.LoadInt32(&r.readerClosed) == 1 {
 		return 0, os.ErrClosed
 	}
+	if len(p) == 0 {
+		return 0, nil
+	}
 
-	n, err = bytes.NewReader(r.Bytes()[r.n:]).Read(p)
-	r.n += n
+	n, err = r.snapshot().ReadAt(p, r.n)
+	r.n += int64(n)
+	if n > 0 {
+		err = nil
+	}
 	return n, err
 }
 
 func (r *memReader) Close() error {
-	atomic.SwapInt32(&r.readerClosed, 1)
+	if atomic.SwapInt32(&r.readerClosed, 1) == 0 {
+		r.release()
+	}
 	return nil
 }
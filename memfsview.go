@@ -0,0 +1,133 @@
+package stream
+
+import (
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MemFSView returns a read-only fs.FS of the Files in fsys, which must be from NewMemFS,
+// so its contents can be passed to anything accepting an fs.FS (it passes testing/fstest.TestFS).
+// Names containing "/" are Files in directories, which exist while they contain Files.
+// Files which are still being written are read as of when they're Opened.
+// Names which aren't valid fs.FS paths (see fs.ValidPath) are left out.
+func MemFSView(fsys FileSystem) (fs.FS, error) {
+	m, ok := fsys.(*memfs)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	return memfsView{m}, nil
+}
+
+type memfsView struct {
+	m *memfs
+}
+
+func (v memfsView) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	v.m.mu.RLock()
+	defer v.m.mu.RUnlock()
+	if f, ok := v.m.files[name]; ok {
+		r := f.open()
+		data := r.snapshot()
+		info := memInfo{name: path.Base(name), size: data.size}
+		return &memViewFile{SectionReader: io.NewSectionReader(data, 0, data.size), r: r, info: info}, nil
+	}
+
+	entries := v.readDir(name)
+	if name != "." && len(entries) == 0 {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return &memViewDir{info: memInfo{name: path.Base(name), dir: true}, entries: entries}, nil
+}
+
+// readDir lists the directory dir, v.m.mu must be held.
+func (v memfsView) readDir(dir string) []fs.DirEntry {
+	prefix := dir + "/"
+	if dir == "." {
+		prefix = ""
+	}
+
+	seen := make(map[string]bool)
+	var entries []fs.DirEntry
+	for name, f := range v.m.files {
+		if !fs.ValidPath(name) || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		rest := name[len(prefix):]
+		child, _, isDir := strings.Cut(rest, "/")
+		if seen[child] {
+			continue
+		}
+		seen[child] = true
+		if isDir {
+			entries = append(entries, fs.FileInfoToDirEntry(memInfo{name: child, dir: true}))
+		} else {
+			entries = append(entries, fs.FileInfoToDirEntry(memInfo{name: child, size: f.snapshot().size}))
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries
+}
+
+type memInfo struct {
+	name string
+	size int64
+	dir  bool
+}
+
+func (fi memInfo) Name() string       { return fi.name }
+func (fi memInfo) Size() int64        { return fi.size }
+func (fi memInfo) ModTime() time.Time { return time.Time{} }
+func (fi memInfo) IsDir() bool        { return fi.dir }
+func (fi memInfo) Sys() interface{}   { return nil }
+func (fi memInfo) Mode() fs.FileMode {
+	if fi.dir {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+
+type memViewFile struct {
+	*io.SectionReader
+	r    *memReader // holds the chunks until Closed
+	info memInfo
+}
+
+func (f *memViewFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *memViewFile) Close() error               { return f.r.Close() }
+
+type memViewDir struct {
+	info    memInfo
+	entries []fs.DirEntry
+	off     int
+}
+
+func (d *memViewDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *memViewDir) Close() error               { return nil }
+
+func (d *memViewDir) Read(p []byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.name, Err: fs.ErrInvalid}
+}
+
+func (d *memViewDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	rest := d.entries[d.off:]
+	if n <= 0 {
+		d.off = len(d.entries)
+		return rest, nil
+	}
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(rest) {
+		n = len(rest)
+	}
+	d.off += n
+	return rest[:n], nil
+}
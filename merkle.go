@@ -0,0 +1,110 @@
+package stream
+
+import (
+	"hash"
+	"sync"
+)
+
+// MerkleTree incrementally hashes the data written to it as a Merkle tree of chunkSize chunks, like
+// RFC 6962 (Certificate Transparency): a leaf is the hash of 0x00 and a chunk, a node the hash of 0x01
+// and its children, and a tree of n leaves has the largest power of 2 less than n leaves on its left.
+// Its roots let clients verify a prefix of a Stream which is still being written, see WithMerkleTree.
+// It's safe for concurrent use.
+type MerkleTree struct {
+	newHash   func() hash.Hash
+	chunkSize int
+
+	mu     sync.Mutex
+	leaf   hash.Hash // of the chunk being written
+	n      int       // bytes of the chunk being written
+	size   int64     // bytes in the complete chunks
+	peaks  []merklePeak
+	closed bool
+}
+
+// merklePeak is the root of a perfect subtree of 2^height leaves.
+type merklePeak struct {
+	sum    []byte
+	height int
+}
+
+// NewMerkleTree returns an empty MerkleTree of chunkSize chunks, hashed by newHash (ex. sha256.New).
+func NewMerkleTree(chunkSize int, newHash func() hash.Hash) *MerkleTree {
+	t := &MerkleTree{newHash: newHash, chunkSize: chunkSize}
+	t.leaf = t.newLeaf()
+	return t
+}
+
+func (t *MerkleTree) newLeaf() hash.Hash {
+	h := t.newHash()
+	h.Write([]byte{0})
+	return h
+}
+
+// Write adds p to the tree. It returns ErrWriterClosed once the tree has been Closed.
+func (t *MerkleTree) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return 0, ErrWriterClosed
+	}
+	n := len(p)
+	for len(p) > 0 {
+		m := t.chunkSize - t.n
+		if m > len(p) {
+			m = len(p)
+		}
+		t.leaf.Write(p[:m])
+		t.n += m
+		p = p[m:]
+		if t.n == t.chunkSize {
+			t.addLeaf()
+		}
+	}
+	return n, nil
+}
+
+// Close ends the data written to the tree, so its last (partial) chunk becomes a leaf.
+func (t *MerkleTree) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.closed && t.n > 0 {
+		t.addLeaf()
+	}
+	t.closed = true
+	return nil
+}
+
+// addLeaf adds the chunk being written as a leaf, merging the perfect subtrees it completes. t.mu must be held.
+func (t *MerkleTree) addLeaf() {
+	t.peaks = append(t.peaks, merklePeak{sum: t.leaf.Sum(nil)})
+	for k := len(t.peaks); k >= 2 && t.peaks[k-2].height == t.peaks[k-1].height; k-- {
+		left, right := t.peaks[k-2], t.peaks[k-1]
+		t.peaks = append(t.peaks[:k-2], merklePeak{sum: t.node(left.sum, right.sum), height: left.height + 1})
+	}
+	t.size += int64(t.n)
+	t.leaf, t.n = t.newLeaf(), 0
+}
+
+func (t *MerkleTree) node(left, right []byte) []byte {
+	h := t.newHash()
+	h.Write([]byte{1})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// Root returns the root of the tree over its leaves, and the bytes they cover: the complete chunks
+// written, and the last partial one once the tree is Closed. The root of an empty tree is the hash of nothing.
+func (t *MerkleTree) Root() (root []byte, size int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.peaks) == 0 {
+		return t.newHash().Sum(nil), 0
+	}
+	root = t.peaks[len(t.peaks)-1].sum
+	for i := len(t.peaks) - 2; i >= 0; i-- {
+		root = t.node(t.peaks[i].sum, root)
+	}
+	return root, t.size
+}
@@ -0,0 +1,213 @@
+package stream
+
+import (
+	"hash"
+	"io"
+	"time"
+)
+
+// Option configures optional behavior of a Stream created by New, NewStream or NewMemStream.
+type Option func(*Stream)
+
+// WithBackpressure turns the Stream into a bounded pipe: Write blocks while the slowest
+// open Reader is more than window bytes behind the writer. A Reader's position is
+// where its next Read will start, ReadAt does not move it.
+// Writes still block for Readers which are never read from, so Close Readers when done.
+func WithBackpressure(window int64) Option {
+	return func(s *Stream) { s.b.window = window }
+}
+
+// WithLagWatermark calls fn with behind=true when a Reader falls more than n bytes behind
+// the writer, and with behind=false once it has caught back up. A Reader's position is
+// where its next Read will start. fn is called synchronously from Write or Read, so it must
+// not call Write on the Stream, or Read on the Reader.
+func WithLagWatermark(n int64, fn func(r *Reader, behind bool)) Option {
+	return func(s *Stream) {
+		s.b.lagMark = n
+		s.b.onLag = fn
+	}
+}
+
+// WithLeakDetection records the stack which creates each Reader, and if Remove (or ShutdownWithErr)
+// is still waiting for Readers to be Closed after d, calls report with each open Reader and the stack
+// which created it, to track down Readers which were leaked instead of Closed. This is a debugging aid,
+// as recording stacks makes NextReader much slower.
+func WithLeakDetection(d time.Duration, report func(r *Reader, created []byte)) Option {
+	return func(s *Stream) {
+		s.leakAfter = d
+		s.onLeak = report
+	}
+}
+
+// WithReaderAutoClose makes Remove (and ShutdownWithErr) Close the Readers which are still open after
+// it has waited d for them, calling warn (if non-nil) with each first, so a long-running service
+// recovers from a Reader which was leaked instead of Closed, rather than hanging. Reads of an auto-Closed
+// Reader fail with os.ErrClosed. A Reader is only Closed once it's blocking a Remove, since it's reachable
+// from its Stream until then, and so can't be detected by the garbage collector.
+func WithReaderAutoClose(d time.Duration, warn func(r *Reader)) Option {
+	return func(s *Stream) {
+		s.autoClose = d
+		s.onClosed = warn
+		if warn == nil {
+			s.onClosed = func(*Reader) {}
+		}
+	}
+}
+
+// WithNonBlockingReadAt makes ReadAt of every Reader return right away with the bytes written so
+// far, and io.EOF if that's less than requested, like an *os.File, for integrations which expect
+// that of an io.ReaderAt (ex. archive/zip). Read still blocks for more data.
+func WithNonBlockingReadAt() Option {
+	return func(s *Stream) { s.noWaitAt = true }
+}
+
+// WithStrictSize makes Write reject data past the size declared with SetSeekEnd, returning a *SizeError
+// without writing any of it, to protect Readers which allocated for the declared size.
+func WithStrictSize() Option {
+	return func(s *Stream) { s.strict = true }
+}
+
+// WithReadahead makes each Reader asynchronously read up to size bytes past its Read offset
+// while the caller handles the previous Read, hiding the latency of slow FileSystems.
+// WriteTo (and so io.Copy) reads ahead too, unless it copies with sendfile. ReadAt is not affected.
+func WithReadahead(size int) Option {
+	return func(s *Stream) { s.readahead = size }
+}
+
+// WithContentAddress makes the Stream content-addressed: the File is written under the name
+// given to NewStream, and on a successful Close it's renamed to the hex digest (by newHash) of
+// its contents, in the same directory. Stream.FinalName returns the new name.
+// The FileSystem must be able to Rename, as StdFileSystem and NewMemFS can, or NewStream returns ErrUnsupported.
+func WithContentAddress(newHash func() hash.Hash) Option {
+	return func(s *Stream) { s.hash = newHash() }
+}
+
+// WithWriteTee writes everything written to the Stream to each of ws as well, in the same pass,
+// ex. to compute a checksum (a hash.Hash is an io.Writer) while mirroring to an archive.
+// The Stream's Write returns the first error from ws, though the data is still in the Stream.
+func WithWriteTee(ws ...io.Writer) Option {
+	return func(s *Stream) { s.tees = append(s.tees, ws...) }
+}
+
+// WithWriteTransform passes everything written to the Stream through fns before it reaches the File,
+// in order: Write goes to the Writer from fns[0], which writes to the one from fns[1], and so on,
+// ex. to compress then encrypt. Close Closes them in the same order, so each flushes into the
+// next, before Closing the File. Readers see the bytes of the File, and its size, as transformed,
+// see WithReadTransform to undo it.
+func WithWriteTransform(fns ...func(io.Writer) io.WriteCloser) Option {
+	return func(s *Stream) { s.xforms = append(s.xforms, fns...) }
+}
+
+// WithReadTransform passes what every Reader Reads through fns, in order: fns[0] reads from the
+// Stream, and the Reader Reads from the last one, ex. to decrypt then decompress what was written
+// WithWriteTransform. Read still blocks for Writes, and WriteTo (and so io.Copy) is transformed too,
+// but ReadAt, Seek and Size see the bytes of the File. Transforms which are io.Closers are Closed
+// with the Reader. fns must not Read when they're called, since that's within NextReader.
+func WithReadTransform(fns ...func(io.Reader) io.Reader) Option {
+	return func(s *Stream) { s.rxform = append(s.rxform, fns...) }
+}
+
+// WithAudit calls fn with an AuditEvent for each operation on the Stream: Readers opened and Closed
+// (with the ranges each read), Writes (with their offsets), and the Stream being Closed, Canceled or
+// shut down (with the cause), ex. to keep an audit log of who read cached user data. fn is called
+// synchronously, while the Stream may be locked, so it must not block or call the Stream.
+func WithAudit(fn func(AuditEvent)) Option {
+	return func(s *Stream) { s.onAudit = fn }
+}
+
+// WithMerkleTree maintains a MerkleTree (see NewMerkleTree) of chunkSize chunks over everything written
+// to the Stream, so clients can verify a prefix of the Stream before it's complete against the roots
+// from Stream.MerkleRoot, ex. while downloading it from untrusted peers.
+func WithMerkleTree(chunkSize int, newHash func() hash.Hash) Option {
+	return func(s *Stream) { s.merkle = NewMerkleTree(chunkSize, newHash) }
+}
+
+// WithCopyBufferSize sets the size of the buffers used by Stream.ReadFrom and Reader.WriteTo
+// (and so io.Copy and CloneTo), 32KB by default. Buffers are pooled per size, and shared by
+// every Stream using that size, so prefer a few common sizes.
+func WithCopyBufferSize(size int) Option {
+	return func(s *Stream) { s.bufSize = size }
+}
+
+// WithSharedFile makes every Reader share a single File opened from the FileSystem, instead of
+// each Reader Opening its own, so many concurrent Readers don't each hold a file descriptor.
+// Readers only use ReadAt (pread on an *os.File) on the shared File, so the FileSystem's Files
+// must support concurrent ReadAt calls, as StdFileSystem and NewMemFS do. The shared File is
+// Closed once every Reader is Closed. WriteTo doesn't use sendfile on a shared File.
+func WithSharedFile() Option {
+	return func(s *Stream) { s.share = true }
+}
+
+// WithFDBudget makes Readers Open their File lazily, within budget b, which can be shared
+// by many Streams (see FDBudget). Errors Opening the File are returned by the Reader's reads,
+// instead of by NextReader. WithSharedFile takes precedence, since it only uses one File.
+func WithFDBudget(b *FDBudget) Option {
+	return func(s *Stream) { s.budget = b }
+}
+
+// WithArchive copies the File to a File with the same name (after any rename) in dst once the
+// Stream is successfully Closed, ex. to serve hot content from memory while archiving it to disk.
+// The copy runs in the background, and holds a Reader, so Remove waits for it to finish. done
+// (if non-nil) is called with the result. To move the File instead, Remove the Stream in done.
+func WithArchive(dst FileSystem, done func(error)) Option {
+	return func(s *Stream) { s.archiveTo, s.archived = dst, done }
+}
+
+// WithAtomicCreate creates the File as name + ".tmp", and atomically renames it to name
+// only once the Stream is successfully Closed, so other processes never observe a partial File.
+// If the Stream is Canceled, the temporary File is removed.
+// The FileSystem must be able to Rename, as StdFileSystem and NewMemFS can, or NewStream returns ErrUnsupported.
+func WithAtomicCreate() Option {
+	return func(s *Stream) { s.target, s.name = s.name, s.name+".tmp" }
+}
+
+// WithRemoveOnClose removes the File once the Stream has been Closed (or Canceled) and
+// every Reader has been Closed, for transient Streams which never need to persist.
+// NextReader returns ErrRemoving once that has happened.
+func WithRemoveOnClose() Option {
+	return WithAutoRemove(0)
+}
+
+// WithAutoRemove removes the File once the Stream has been Closed (or Canceled) and there have
+// been no open Readers for the linger duration. A NextReader during that time keeps the File,
+// until its Reader is Closed and the Stream lingers again.
+// NextReader returns ErrRemoving once the File is being removed.
+func WithAutoRemove(linger time.Duration) Option {
+	return func(s *Stream) {
+		s.b.onZero = func() { s.Remove() }
+		s.b.linger = linger
+	}
+}
+
+// WithReaderIdleTimeout Closes Readers which have not been used (by Read, ReadAt, Seek or WriteTo)
+// for d, so abandoned Readers don't prevent the Stream from being Removed.
+// A Reader blocked waiting for more data is in use, and is not Closed.
+func WithReaderIdleTimeout(d time.Duration) Option {
+	return func(s *Stream) { s.idleAfter = d }
+}
+
+// WithIdleTimeout Cancels the Stream if it's not Closed and no Write occurs for d,
+// so Readers don't wait forever on a producer which hangs without erroring.
+// Reads then fail with an error wrapping both ErrCanceled and ErrStalled.
+func WithIdleTimeout(d time.Duration) Option {
+	return func(s *Stream) { s.stall = newIdleTimer(d) }
+}
+
+// WithReplayIndex records the time of every Write in a replay index named name + ".times", so
+// Readers can replay the Stream on the schedule it was written on, see Reader.Paced. The index is
+// removed along with the File by Remove.
+func WithReplayIndex() Option {
+	return func(s *Stream) { s.replayIdx = true }
+}
+
+// WithStateFile records whether the Stream is open, Closed (and its final size) or Canceled in
+// a state file named name + ".state", so that a process can Attach to the File while another
+// process is writing it. The state file is removed along with the File by Remove.
+func WithStateFile() Option {
+	return func(s *Stream) { s.stateFile = true }
+}
+
+// WithPollInterval sets how often a Stream created by Attach checks for new data, 100ms by default.
+func WithPollInterval(d time.Duration) Option {
+	return func(s *Stream) { s.pollEvery = d }
+}
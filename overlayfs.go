@@ -0,0 +1,61 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"os"
+)
+
+// NewOverlayFS returns a FileSystem which Creates Files in upper, and Opens them from upper if they
+// exist there, or from base if they don't, ex. to find warm content on a local disk and fall through
+// to a slow remote or a read-only snapshot for cold content. base is never modified: Remove and
+// Rename only apply to upper.
+func NewOverlayFS(upper, base FileSystem) FileSystem {
+	return &overlayFS{upper: upper, base: base}
+}
+
+type overlayFS struct {
+	upper FileSystem
+	base  FileSystem
+}
+
+// notExist reports whether err means a File doesn't exist, in the os package or an in-memory FileSystem.
+func notExist(err error) bool {
+	return errors.Is(err, os.ErrNotExist) || errors.Is(err, ErrNotFoundInMem)
+}
+
+func (fs *overlayFS) Create(name string) (File, error) { return fs.upper.Create(name) }
+
+func (fs *overlayFS) CreateContext(ctx context.Context, name string) (File, error) {
+	return createContext(ctx, fs.upper, name)
+}
+
+func (fs *overlayFS) Open(name string) (File, error) {
+	return fs.OpenContext(context.Background(), name)
+}
+
+func (fs *overlayFS) OpenContext(ctx context.Context, name string) (File, error) {
+	f, err := openContext(ctx, fs.upper, name)
+	if notExist(err) {
+		return openContext(ctx, fs.base, name)
+	}
+	return f, err
+}
+
+func (fs *overlayFS) Remove(name string) error { return fs.upper.Remove(name) }
+
+func (fs *overlayFS) RemoveContext(ctx context.Context, name string) error {
+	return removeContext(ctx, fs.upper, name)
+}
+
+func (fs *overlayFS) Rename(oldname, newname string) error {
+	upper, ok := fs.upper.(Renamer)
+	if !ok {
+		return ErrUnsupported
+	}
+	return upper.Rename(oldname, newname)
+}
+
+func (fs *overlayFS) canRename() bool { return canRename(fs.upper) }
+
+func (fs *overlayFS) syncDir(name string) error { return syncDir(fs.upper, name) }
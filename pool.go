@@ -0,0 +1,38 @@
+package stream
+
+import "sync"
+
+// defaultCopyBufferSize is the size of the buffers used for copies, unless WithCopyBufferSize is used.
+const defaultCopyBufferSize = 32 * 1024
+
+// bufferPools holds a *sync.Pool of *[]byte for each buffer size in use.
+var bufferPools sync.Map
+
+func bufferPool(size int) *sync.Pool {
+	if p, ok := bufferPools.Load(size); ok {
+		return p.(*sync.Pool)
+	}
+	p, _ := bufferPools.LoadOrStore(size, &sync.Pool{
+		New: func() interface{} {
+			buf := make([]byte, size)
+			return &buf
+		},
+	})
+	return p.(*sync.Pool)
+}
+
+// getBuffer returns a buffer for copying through the Stream, release it with putBuffer.
+func (s *Stream) getBuffer() *[]byte {
+	return bufferPool(s.copyBufferSize()).Get().(*[]byte)
+}
+
+func (s *Stream) putBuffer(buf *[]byte) {
+	bufferPool(len(*buf)).Put(buf)
+}
+
+func (s *Stream) copyBufferSize() int {
+	if s.bufSize > 0 {
+		return s.bufSize
+	}
+	return defaultCopyBufferSize
+}
@@ -0,0 +1,24 @@
+package stream
+
+import (
+	"os"
+	"syscall"
+)
+
+const (
+	fallocKeepSize  = 0x1 // FALLOC_FL_KEEP_SIZE
+	fallocPunchHole = 0x2 // FALLOC_FL_PUNCH_HOLE
+)
+
+// punchHole deallocates n bytes of f at off, if f is an *os.File on a filesystem which supports it.
+func punchHole(f File, off, n int64) error {
+	osf, ok := f.(*os.File)
+	if !ok {
+		return ErrUnsupported
+	}
+	err := syscall.Fallocate(int(osf.Fd()), fallocKeepSize|fallocPunchHole, off, n)
+	if err == syscall.EOPNOTSUPP || err == syscall.ENOSYS {
+		return ErrUnsupported
+	}
+	return err
+}
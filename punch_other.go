@@ -0,0 +1,7 @@
+//go:build !linux
+// +build !linux
+
+package stream
+
+// punchHole is only supported on Linux.
+func punchHole(f File, off, n int64) error { return ErrUnsupported }
@@ -0,0 +1,153 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrQuotaExceeded is returned by Write to a File of a QuotaFS which would take its usage past its limit.
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// QuotaFS is a FileSystem which caps the total size of the Files it has Created, see NewQuotaFS.
+type QuotaFS struct {
+	inner FileSystem
+	limit int64
+
+	mu    sync.Mutex
+	used  int64
+	files map[string]*quotaUsage // the Files Created, by name
+}
+
+// quotaUsage is the bytes written to a File Created on a QuotaFS, guarded by its mu.
+type quotaUsage struct {
+	size    int64
+	removed bool // the File was Removed (or Created over), so its bytes no longer count
+}
+
+// NewQuotaFS returns a FileSystem which caps the total size of all the Files Created on inner to
+// limit bytes, so a cache of Streams can cap its disk usage without a sweeper. A Write which would
+// exceed the limit writes what fits and returns ErrQuotaExceeded. Removing a File (or Creating over
+// it) returns its bytes to the quota. Files which existed before aren't counted.
+func NewQuotaFS(inner FileSystem, limit int64) *QuotaFS {
+	return &QuotaFS{inner: inner, limit: limit, files: make(map[string]*quotaUsage)}
+}
+
+// Usage returns the bytes currently used by the Files Created on the QuotaFS, out of its limit.
+func (fs *QuotaFS) Usage() (used, limit int64) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fs.used, fs.limit
+}
+
+func (fs *QuotaFS) Create(name string) (File, error) {
+	return fs.CreateContext(context.Background(), name)
+}
+
+// CreateContext is Create, passing ctx on to the inner FileSystem, see FileSystemContext.
+func (fs *QuotaFS) CreateContext(ctx context.Context, name string) (File, error) {
+	f, err := createContext(ctx, fs.inner, name)
+	if err != nil {
+		return nil, err
+	}
+	usage := &quotaUsage{}
+	fs.mu.Lock()
+	fs.forget(name)
+	fs.files[name] = usage
+	fs.mu.Unlock()
+	return &quotaFile{File: f, fs: fs, usage: usage}, nil
+}
+
+func (fs *QuotaFS) Open(name string) (File, error) { return fs.inner.Open(name) }
+
+// OpenContext is Open, passing ctx on to the inner FileSystem, see FileSystemContext.
+func (fs *QuotaFS) OpenContext(ctx context.Context, name string) (File, error) {
+	return openContext(ctx, fs.inner, name)
+}
+
+func (fs *QuotaFS) Remove(name string) error {
+	return fs.RemoveContext(context.Background(), name)
+}
+
+// RemoveContext is Remove, passing ctx on to the inner FileSystem, see FileSystemContext.
+func (fs *QuotaFS) RemoveContext(ctx context.Context, name string) error {
+	if err := removeContext(ctx, fs.inner, name); err != nil {
+		return err
+	}
+	fs.mu.Lock()
+	fs.forget(name)
+	fs.mu.Unlock()
+	return nil
+}
+
+func (fs *QuotaFS) Rename(oldname, newname string) error {
+	inner, ok := fs.inner.(Renamer)
+	if !ok {
+		return ErrUnsupported
+	}
+	if err := inner.Rename(oldname, newname); err != nil {
+		return err
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if usage, ok := fs.files[oldname]; ok {
+		delete(fs.files, oldname)
+		fs.forget(newname)
+		fs.files[newname] = usage
+	}
+	return nil
+}
+
+// forget returns the bytes of the File to the quota, fs.mu must be held.
+func (fs *QuotaFS) forget(name string) {
+	if usage, ok := fs.files[name]; ok {
+		fs.used -= usage.size
+		usage.size, usage.removed = 0, true
+		delete(fs.files, name)
+	}
+}
+
+func (fs *QuotaFS) canRename() bool { return canRename(fs.inner) }
+
+func (fs *QuotaFS) syncDir(name string) error { return syncDir(fs.inner, name) }
+
+type quotaFile struct {
+	File
+	fs    *QuotaFS
+	usage *quotaUsage
+}
+
+func (f *quotaFile) Write(p []byte) (int, error) {
+	return f.WriteContext(context.Background(), p)
+}
+
+func (f *quotaFile) WriteContext(ctx context.Context, p []byte) (int, error) {
+	// reserve room for p up front, so concurrent Writes to other Files can't overrun the limit.
+	f.fs.mu.Lock()
+	want := int64(len(p))
+	if room := f.fs.limit - f.fs.used; want > room {
+		want = room
+		if want < 0 {
+			want = 0
+		}
+	}
+	f.fs.used += want
+	f.fs.mu.Unlock()
+
+	n, err := writeContext(ctx, f.File, p[:want])
+
+	f.fs.mu.Lock()
+	if f.usage.removed {
+		f.fs.used -= want
+	} else {
+		f.fs.used -= want - int64(n)
+		f.usage.size += int64(n)
+	}
+	f.fs.mu.Unlock()
+	if err == nil && n < len(p) {
+		err = ErrQuotaExceeded
+	}
+	return n, err
+}
+
+func (f *quotaFile) Sync() error { return syncFile(f.File) }
@@ -0,0 +1,109 @@
+package stream
+
+import "context"
+
+// readahead asynchronously reads the next chunk of the Stream while the caller is busy
+// with the previous one, so sequential Reads don't pay for slow Files one ReadAt at a time.
+// All fields but ctx and stop are guarded by Reader.readMu.
+type readahead struct {
+	size       int
+	buf        []byte // unread prefetched bytes
+	off        int64  // Stream offset of buf[0]
+	pending    chan prefetched
+	pendingOff int64
+	cancel     context.CancelFunc // cancels the pending prefetch
+
+	ctx  context.Context    // parent of the prefetches
+	stop context.CancelFunc // cancels every prefetch, once the Reader is Closed
+}
+
+type prefetched struct {
+	p   []byte
+	err error
+}
+
+// prefetchKey marks the contexts of prefetches, see abandoned.
+type prefetchKey struct{}
+
+// abandoned reports whether ctx is that of a prefetch which was canceled, because the Reader was
+// Closed or moved elsewhere. Its error is never returned by a read, so it isn't recorded (see Reader.Err).
+func abandoned(ctx context.Context) bool {
+	return ctx.Err() != nil && ctx.Value(prefetchKey{}) != nil
+}
+
+func newReadahead(size int) *readahead {
+	ctx, stop := context.WithCancel(context.WithValue(context.Background(), prefetchKey{}, true))
+	return &readahead{size: size, ctx: ctx, stop: stop}
+}
+
+// Read reads into p from the Reader's Read offset, starting the next prefetch once
+// the buffered bytes are used up.
+func (ra *readahead) Read(r *Reader, p []byte) (int, error) {
+	if len(ra.buf) == 0 || ra.off != r.readOff {
+		if err := ra.fill(r); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, ra.buf)
+	ra.buf = ra.buf[n:]
+	ra.off += int64(n)
+	r.readOff += int64(n)
+
+	if len(ra.buf) == 0 {
+		ra.fetch(r, ra.off)
+	}
+	return n, nil
+}
+
+// Reset drops the buffered and pending prefetched data.
+func (ra *readahead) Reset() {
+	ra.buf, ra.off = nil, 0
+	ra.abandon()
+}
+
+// Moved cancels the pending prefetch, unless it's at off, the new Read offset after a Seek.
+func (ra *readahead) Moved(off int64) {
+	if ra.pending != nil && ra.pendingOff != off {
+		ra.abandon()
+	}
+}
+
+// abandon cancels the pending prefetch, if any.
+func (ra *readahead) abandon() {
+	if ra.cancel != nil {
+		ra.cancel()
+	}
+	ra.pending, ra.cancel = nil, nil
+}
+
+// fill waits for the chunk at the Read offset, discarding prefetches for other offsets (ex. after a Seek).
+// Bytes prefetched before an error are kept, the error is returned by the next prefetch if it persists.
+func (ra *readahead) fill(r *Reader) error {
+	if ra.pending == nil || ra.pendingOff != r.readOff {
+		ra.fetch(r, r.readOff)
+	}
+
+	res := <-ra.pending
+	ra.pending = nil
+	ra.cancel()
+	if len(res.p) == 0 && res.err != nil {
+		return res.err
+	}
+	ra.buf, ra.off = res.p, r.readOff
+	return nil
+}
+
+// fetch starts reading the chunk at off, canceling the pending prefetch. A canceled fetch
+// exits right away, even while waiting for Writes.
+func (ra *readahead) fetch(r *Reader, off int64) {
+	ra.abandon()
+	ctx, cancel := context.WithCancel(ra.ctx)
+	pending := make(chan prefetched, 1)
+	ra.pending, ra.pendingOff, ra.cancel = pending, off, cancel
+	go func() {
+		p := make([]byte, ra.size)
+		n, err := r.read(ctx, p, &off)
+		pending <- prefetched{p: p[:n], err: err}
+	}()
+}
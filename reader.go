@@ -1,47 +1,195 @@
 package stream
 
 import (
+	"context"
+	"encoding/gob"
+	"encoding/json"
 	"errors"
 	"io"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // Reader is a concurrent-safe Stream Reader.
 type Reader struct {
+	stats     readerStats // first, for 64-bit alignment of its atomics
 	s         *Stream
 	file      File
 	fileMu    sync.RWMutex
 	readMu    sync.Mutex
 	readOff   int64
+	pos       int64 // last Read offset reported to s.b, guarded by s.b.mu
+	behind    bool  // past the lag watermark, guarded by s.b.mu
+	ra        *readahead
+	idle      *idleTimer
+	bounded   bool // the Reader ends at limit (see Stream.SnapshotReader)
+	limit     int64
+	errMu     sync.Mutex
+	err       error // the last error a read returned, see Err
+	decMu     sync.Mutex
+	jsonDec   *json.Decoder // see DecodeJSON
+	gobDec    *gob.Decoder  // see DecodeGob
+	xform     io.Reader     // the last transform of WithReadTransform, nil if there are none
+	xclosers  []io.Closer   // the transforms which are io.Closers, Closed with the Reader
+	ranges    extentSet     // the ranges read, see WithAudit
+	created   []byte        // stack which created the Reader, see WithLeakDetection
+	opened    time.Time     // when NextReader created the Reader
+	label     string        // see Stream.NextReaderLabeled
 	closeOnce onceWithErr
 }
 
 // Name returns the name of the underlying File in the FileSystem.
 func (r *Reader) Name() string { return r.file.Name() }
 
+// Label returns the label the Reader was created with by Stream.NextReaderLabeled, or "" if it has none.
+func (r *Reader) Label() string { return r.label }
+
+// Stat returns a FileInfo for the Stream, so that a Reader implements fs.File.
+// Its Size is the size of the Stream at the time of the call, see Size.
+func (r *Reader) Stat() (fs.FileInfo, error) {
+	size, _ := r.Size()
+	return readerInfo{name: filepath.Base(r.Name()), size: size}, nil
+}
+
+type readerInfo struct {
+	name string
+	size int64
+}
+
+func (fi readerInfo) Name() string       { return fi.name }
+func (fi readerInfo) Size() int64        { return fi.size }
+func (fi readerInfo) Mode() fs.FileMode  { return 0444 }
+func (fi readerInfo) ModTime() time.Time { return time.Time{} }
+func (fi readerInfo) IsDir() bool        { return false }
+func (fi readerInfo) Sys() interface{}   { return nil }
+
 // ReadAt lets you Read from specific offsets in the Stream.
 // ReadAt blocks while waiting for the requested section of the Stream to be written,
 // unless the Stream is closed in which case it will always return immediately.
+// With WithNonBlockingReadAt, ReadAt never waits, see readAvailable.
 func (r *Reader) ReadAt(p []byte, off int64) (n int, err error) {
-	return r.read(p, &off)
+	defer r.idle.busy()()
+	if r.s.noWaitAt {
+		return r.readAvailable(p, off)
+	}
+	return r.read(context.Background(), p, &off)
+}
+
+// ReadAtContext is like ReadAt, but stops waiting for the requested section of the Stream once ctx
+// is done, returning ctx.Err(). The Reader stays open, so it can be reused, ex. by an HTTP handler
+// serving a Range Request whose client disconnected.
+func (r *Reader) ReadAtContext(ctx context.Context, p []byte, off int64) (n int, err error) {
+	defer r.idle.busy()()
+	if r.s.noWaitAt {
+		return r.readAvailable(p, off)
+	}
+	return r.read(ctx, p, &off)
+}
+
+// readAvailable reads what has been written of p at off without waiting for the rest,
+// returning io.EOF if that's less than len(p), like *os.File.
+func (r *Reader) readAvailable(p []byte, off int64) (n int, err error) {
+	if r.bounded && off+int64(len(p)) > r.limit {
+		if off >= r.limit {
+			return 0, r.observe(io.EOF)
+		}
+		p = p[:r.limit-off]
+		defer func() {
+			if err == nil {
+				err = r.observe(io.EOF)
+			}
+		}()
+	}
+
+	for n < len(p) {
+		var m int
+		m, err = r.readFile(p[n:], off+int64(n))
+		n += m
+		if err != nil || m == 0 {
+			break
+		}
+	}
+
+	switch {
+	case n == len(p):
+		return n, nil
+
+	case err == nil || err == io.EOF:
+		if r.s.b.Canceled() {
+			return n, r.checkErr(r.s.b.Wait(context.Background(), r, off+int64(n)))
+		}
+		return n, r.observe(io.EOF)
+	}
+	return n, r.checkErr(err)
+}
+
+// WaitAvailable blocks until the n bytes of the Stream starting at off have been written, so
+// they can be read without blocking. It returns io.ErrUnexpectedEOF if the Stream ends before
+// then, or the error the Stream was Canceled with, or os.ErrClosed if the Reader is Closed.
+func (r *Reader) WaitAvailable(off, n int64) error {
+	return r.WaitAvailableContext(context.Background(), off, n)
+}
+
+// WaitAvailableContext is like WaitAvailable, but stops waiting once ctx is done, returning ctx.Err().
+func (r *Reader) WaitAvailableContext(ctx context.Context, off, n int64) error {
+	if r.bounded && off+n > r.limit {
+		return io.ErrUnexpectedEOF
+	}
+	return r.s.b.WaitForSize(ctx, r, off+n)
+}
+
+// Section returns a reader of the n bytes of the Stream starting at off. Its Reads block until
+// the requested bytes are written (or return the error ending the Stream), so it can be
+// passed straight to http.ServeContent to serve a Range Request.
+func (r *Reader) Section(off, n int64) *io.SectionReader {
+	return io.NewSectionReader(r, off, n)
 }
 
 // Read reads from the Stream. If the end of an open Stream is reached, Read
 // blocks until more data is written or the Stream is Closed.
 func (r *Reader) Read(p []byte) (n int, err error) {
+	defer r.idle.busy()()
 	r.readMu.Lock()
 	defer r.readMu.Unlock()
-	return r.read(p, &r.readOff)
+	n, err = r.readNext(p)
+	r.s.b.Advance(r, r.readOff)
+	return n, err
+}
+
+// readNext reads from the Read offset, through the transforms of WithReadTransform if any. r.readMu must be held.
+func (r *Reader) readNext(p []byte) (int, error) {
+	if r.xform != nil {
+		return r.xform.Read(p)
+	}
+	return r.readRaw(p)
+}
+
+// readRaw reads from the Read offset, through the readahead buffer if enabled. r.readMu must be held.
+func (r *Reader) readRaw(p []byte) (int, error) {
+	if r.ra != nil {
+		return r.ra.Read(r, p)
+	}
+	return r.read(context.Background(), p, &r.readOff)
 }
 
-func (r *Reader) read(p []byte, off *int64) (n int, err error) {
+func (r *Reader) read(ctx context.Context, p []byte, off *int64) (n int, err error) {
+	if r.bounded {
+		if *off >= r.limit {
+			return 0, r.observe(io.EOF)
+		}
+		if max := r.limit - *off; int64(len(p)) > max {
+			p = p[:max]
+		}
+	}
+
 	for {
 		var m int
-		m, err = r.s.b.UseHandle(func() (int, error) {
-			r.fileMu.RLock()
-			defer r.fileMu.RUnlock()
-			return r.file.ReadAt(p[n:], *off)
-		})
+		m, err = r.readFile(p[n:], *off)
 		n += m
 		*off += int64(m)
 
@@ -50,7 +198,10 @@ func (r *Reader) read(p []byte, off *int64) (n int, err error) {
 			return n, nil
 
 		case err == io.EOF:
-			if err := r.s.b.Wait(r, *off); err != nil {
+			if err := r.s.b.Wait(ctx, r, *off); err != nil {
+				if abandoned(ctx) {
+					return n, err
+				}
 				return n, r.checkErr(err)
 			}
 
@@ -60,22 +211,165 @@ func (r *Reader) read(p []byte, off *int64) (n int, err error) {
 	}
 }
 
+// readFile reads from the File at off.
+func (r *Reader) readFile(p []byte, off int64) (int, error) {
+	if r.s.holes.overlaps(off, int64(len(p))) {
+		return 0, wrapErr("read", r.s.Name(), off, ErrTrimmed)
+	}
+	return r.s.b.UseHandle(func() (int, error) {
+		r.fileMu.RLock()
+		defer r.fileMu.RUnlock()
+		defer r.stats.read()()
+		n, err := r.file.ReadAt(p, off)
+		if err != nil && err != io.EOF {
+			err = wrapErr("read", r.s.Name(), off, err)
+		}
+		r.readRange(off, int64(n))
+		return n, err
+	})
+}
+
+// WriteTo implements io.WriterTo. It copies the Stream to w starting at the current
+// Read offset, blocking for more data until the Stream is Closed.
+// When the Stream is backed by an *os.File and w is a *net.TCPConn or *os.File, the
+// already written region is copied with sendfile/splice instead of through user space.
+func (r *Reader) WriteTo(w io.Writer) (n int64, err error) {
+	defer r.idle.busy()()
+	r.readMu.Lock()
+	defer r.readMu.Unlock()
+
+	f, ok := r.file.(*os.File)
+	if !ok || r.xform != nil || !canSendFile(w) {
+		return r.copyTo(w)
+	}
+
+	for {
+		var m int64
+		m, err = r.sendFile(w, f)
+		n += m
+		switch {
+		case err == io.EOF:
+			return n, nil
+
+		case err != nil:
+			return n, err
+		}
+	}
+}
+
+func canSendFile(w io.Writer) bool {
+	switch w.(type) {
+	case *net.TCPConn, *os.File:
+		return true
+	}
+	return false
+}
+
+// sendFile waits for unread data and then copies all of it from f to w. io.Copy will
+// use w.ReadFrom, which uses sendfile/splice when reading from an *os.File.
+func (r *Reader) sendFile(w io.Writer, f *os.File) (n int64, err error) {
+	if r.bounded && r.readOff >= r.limit {
+		return 0, r.observe(io.EOF)
+	}
+	if err := r.s.b.Wait(context.Background(), r, r.readOff); err != nil {
+		return 0, r.checkErr(err)
+	}
+	size, _ := r.Size()
+	if r.s.holes.overlaps(r.readOff, size-r.readOff) {
+		return 0, r.checkErr(wrapErr("read", r.s.Name(), r.readOff, ErrTrimmed))
+	}
+
+	_, err = r.s.b.UseHandle(func() (int, error) {
+		r.fileMu.RLock()
+		defer r.fileMu.RUnlock()
+		if _, err := f.Seek(r.readOff, io.SeekStart); err != nil {
+			return 0, err
+		}
+		n, err = io.Copy(w, io.LimitReader(f, size-r.readOff))
+		return 0, err
+	})
+	r.readRange(r.readOff, n)
+	r.readOff += n
+	r.s.b.Advance(r, r.readOff)
+	return n, r.checkErr(err)
+}
+
+func (r *Reader) copyTo(w io.Writer) (n int64, err error) {
+	pooled := r.s.getBuffer()
+	defer r.s.putBuffer(pooled)
+	buf := *pooled
+	for {
+		m, err := r.readNext(buf)
+		r.s.b.Advance(r, r.readOff)
+		if m > 0 {
+			k, werr := w.Write(buf[:m])
+			n += int64(k)
+			if werr == nil && k != m {
+				werr = io.ErrShortWrite
+			}
+			if werr != nil {
+				return n, werr
+			}
+		}
+		switch {
+		case err == io.EOF:
+			return n, nil
+
+		case err != nil:
+			return n, err
+		}
+	}
+}
+
 func (r *Reader) checkErr(err error) error {
-	switch err {
-	case ErrCanceled:
+	switch {
+	case err == io.EOF:
+		err = r.s.b.EOF()
+
+	case errors.Is(err, ErrCanceled):
 		r.Close()
 	}
+	return r.observe(err)
+}
+
+// observe records err as the last error a read returned.
+func (r *Reader) observe(err error) error {
+	r.errMu.Lock()
+	r.err = err
+	r.errMu.Unlock()
 	return err
 }
 
+// Err returns the last error returned by a read from the Reader (Read, ReadAt, WriteTo...),
+// or nil if there hasn't been one: io.EOF (or the error given to Stream.CloseWithError) once
+// the end of the Stream was reached, an error wrapping ErrCanceled if the Stream was Canceled,
+// or the error that shut it down, so wrappers don't need to keep track of it themselves.
+func (r *Reader) Err() error {
+	r.errMu.Lock()
+	defer r.errMu.Unlock()
+	return r.err
+}
+
 // Close closes this Reader on the Stream. This must be called when done with the
 // Reader or else the Stream cannot be Removed.
 func (r *Reader) Close() error {
 	return r.closeOnce.Do(func() (err error) {
+		r.idle.stop()
+		for i := len(r.xclosers) - 1; i >= 0; i-- {
+			if cerr := r.xclosers[i].Close(); err == nil {
+				err = cerr
+			}
+		}
 		r.fileMu.Lock()
-		err = r.file.Close()
+		if cerr := r.file.Close(); err == nil {
+			err = cerr
+		}
 		r.fileMu.Unlock()
 		r.s.b.DropReader(r)
+		if r.ra != nil {
+			r.ra.stop()
+		}
+		r.s.audit(AuditEvent{Kind: AuditReaderClosed, Reader: r, Read: r.rangesRead()})
 		return err
 	})
 }
@@ -83,10 +377,37 @@ func (r *Reader) Close() error {
 // Size returns the current size of the entire stream (not the remaining bytes to be read),
 // and true iff the size is valid (not canceled), and final (won't change).
 // Can be safely called concurrently with all other methods.
+// A Reader from Stream.SnapshotReader always returns its fixed size, and true.
 func (r *Reader) Size() (int64, bool) {
+	if r.bounded {
+		return r.limit, true
+	}
 	return r.s.b.Size()
 }
 
+// Offset returns the offset in the Stream of the next Read, as moved by Read, WriteTo, Seek and
+// Rewind (but not ReadAt), so progress can be reported without counting the bytes read.
+// It's the offset before WithReadTransform, and is safe to call concurrently with a blocked Read.
+func (r *Reader) Offset() int64 {
+	return atomic.LoadInt64(&r.stats.off)
+}
+
+// Remaining returns the bytes left to Read from Offset to the end of the Stream, and true if that's
+// known: once the size is final (see Size), or expected from Stream.SetSeekEnd. Otherwise, it returns
+// the bytes already written past Offset, and false. It's safe to call concurrently with all other methods.
+func (r *Reader) Remaining() (n int64, known bool) {
+	size, known := r.Size()
+	if !known {
+		if end := r.s.seekEnd.peek(); end >= 0 {
+			size, known = end, true
+		}
+	}
+	if n = size - r.Offset(); n < 0 {
+		n = 0
+	}
+	return n, known
+}
+
 // Seek changes the offset of the next Read in the stream.
 // Seeking to Start/Current does not block for the stream to reach that position,
 // so it cannot guarantee that position exists.
@@ -99,37 +420,65 @@ func (r *Reader) Size() (int64, bool) {
 // Similarly, calling SetSeekEnd concurrently with calls to Seek may lead to
 // either SeekEnd blocking OR using the SetSeekEnd.
 func (r *Reader) Seek(offset int64, whence int) (int64, error) {
+	return r.SeekContext(context.Background(), offset, whence)
+}
+
+// SeekContext is like Seek, but stops waiting for the Stream to be Closed to Seek to its end
+// once ctx is done, returning ctx.Err() and leaving the offset unchanged.
+func (r *Reader) SeekContext(ctx context.Context, offset int64, whence int) (int64, error) {
+	defer r.idle.busy()()
 	r.readMu.Lock()
 	defer r.readMu.Unlock()
 
 	switch whence {
 	default:
-		return 0, errWhence
+		return 0, &Error{Op: "seek", Name: r.s.Name(), Off: offset, Err: errWhence}
 	case io.SeekStart:
 	case io.SeekCurrent:
 		offset += r.readOff
 	case io.SeekEnd:
-		size, err := r.seekEnd()
+		size, err := r.seekEnd(ctx)
 		if err != nil {
 			return 0, err
 		}
 		offset += size
 	}
 	if offset < 0 {
-		return 0, errOffset
+		return 0, &Error{Op: "seek", Name: r.s.Name(), Off: offset, Err: errOffset}
 	}
 	r.readOff = offset
+	if r.ra != nil {
+		r.ra.Moved(offset)
+	}
+	r.s.b.Advance(r, r.readOff)
 	return r.readOff, nil
 }
 
-func (r *Reader) seekEnd() (int64, error) {
+// Rewind moves the Reader back to the start of the Stream and drops any data read ahead
+// (see WithReadahead), so the Reader can be reused (ex. to retry) without Opening the File again.
+func (r *Reader) Rewind() {
+	defer r.idle.busy()()
+	r.readMu.Lock()
+	defer r.readMu.Unlock()
+	r.readOff = 0
+	if r.ra != nil {
+		r.ra.Reset()
+	}
+	r.s.b.Advance(r, r.readOff)
+}
+
+func (r *Reader) seekEnd(ctx context.Context) (int64, error) {
+	if r.bounded {
+		return r.limit, nil
+	}
+
 	// Check if end was specified:
 	if size := r.s.seekEnd.read(); size >= 0 {
 		return size, nil
 	}
 
 	// Block until closed so we know the true size:
-	if err := r.s.b.Wait(r, maxInt64); err != nil && err != io.EOF {
+	if err := r.s.b.Wait(ctx, r, maxInt64); err != nil && err != io.EOF {
 		return 0, err
 	}
 	size, _ := r.s.b.Size() // we most be closed to reach here due to ^
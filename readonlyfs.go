@@ -0,0 +1,51 @@
+package stream
+
+import (
+	"io"
+	iofs "io/fs"
+	"os"
+)
+
+// NewReadOnlyFS returns a FileSystem of the Files in fsys (ex. os.DirFS or an embed.FS), so content
+// which already exists can be served with OpenStream. Create and Remove return ErrUnsupported, as
+// does Open of a File which isn't an io.ReaderAt.
+func NewReadOnlyFS(fsys iofs.FS) FileSystem {
+	return readOnlyFS{fsys}
+}
+
+type readOnlyFS struct{ fsys iofs.FS }
+
+func (fs readOnlyFS) Create(name string) (File, error) {
+	return nil, &os.PathError{Op: "create", Path: name, Err: ErrUnsupported}
+}
+
+func (fs readOnlyFS) Open(name string) (File, error) {
+	f, err := fs.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	r, ok := f.(readAtFile)
+	if !ok {
+		f.Close()
+		return nil, &os.PathError{Op: "open", Path: name, Err: ErrUnsupported}
+	}
+	return &readOnlyFile{readAtFile: r, name: name}, nil
+}
+
+func (fs readOnlyFS) Remove(name string) error {
+	return &os.PathError{Op: "remove", Path: name, Err: ErrUnsupported}
+}
+
+type readAtFile interface {
+	iofs.File
+	io.ReaderAt
+}
+
+type readOnlyFile struct {
+	readAtFile
+	name string
+}
+
+func (f *readOnlyFile) Name() string { return f.name }
+
+func (f *readOnlyFile) Write(p []byte) (int, error) { return 0, ErrUnsupported }
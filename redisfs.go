@@ -0,0 +1,134 @@
+package stream
+
+import (
+	"io"
+	"os"
+	"path"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RedisClient is the part of a Redis client used by NewRedisFS, so this package doesn't have to
+// depend on one. Each method is the Redis command of the same name, ex. with go-redis,
+// Append(key, value) is c.Append(ctx, key, string(value)).Result().
+type RedisClient interface {
+	Set(key string, value []byte, ttl time.Duration) error // ttl 0 for no expiry
+	Append(key string, value []byte) (length int64, err error)
+	GetRange(key string, start, end int64) ([]byte, error) // end is inclusive
+	StrLen(key string) (int64, error)
+	Exists(key string) (bool, error)
+	Del(key string) (deleted bool, err error)
+	Expire(key string, ttl time.Duration) error
+}
+
+// NewRedisFS returns a FileSystem which stores each File as a Redis string, written with APPEND and
+// read with GETRANGE, so small short-lived Streams can be shared across processes and hosts.
+// Files expire ttl after they were last written (never if ttl is 0), so Redis cleans up Streams
+// which are never Removed. It can't Rename Files, since Opened Files read by name.
+func NewRedisFS(c RedisClient, ttl time.Duration) FileSystem {
+	return redisFS{c: c, ttl: ttl}
+}
+
+type redisFS struct {
+	c   RedisClient
+	ttl time.Duration
+}
+
+func (fs redisFS) Create(name string) (File, error) {
+	if err := fs.c.Set(name, []byte{}, fs.ttl); err != nil {
+		return nil, &os.PathError{Op: "create", Path: name, Err: err}
+	}
+	return &redisFile{fs: fs, name: name}, nil
+}
+
+func (fs redisFS) Open(name string) (File, error) {
+	ok, err := fs.c.Exists(name)
+	if err == nil && !ok {
+		err = os.ErrNotExist
+	}
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &redisFile{fs: fs, name: name}, nil
+}
+
+func (fs redisFS) Remove(name string) error {
+	ok, err := fs.c.Del(name)
+	if err == nil && !ok {
+		err = os.ErrNotExist
+	}
+	if err != nil {
+		return &os.PathError{Op: "remove", Path: name, Err: err}
+	}
+	return nil
+}
+
+type redisFile struct {
+	fs   redisFS
+	name string
+
+	mu     sync.Mutex // serializes Read
+	off    int64      // for Read
+	closed int32
+}
+
+func (f *redisFile) Name() string { return f.name }
+
+func (f *redisFile) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if _, err := f.fs.c.Append(f.name, p); err != nil {
+		return 0, &os.PathError{Op: "write", Path: f.name, Err: err}
+	}
+	if f.fs.ttl > 0 {
+		if err := f.fs.c.Expire(f.name, f.fs.ttl); err != nil {
+			return len(p), &os.PathError{Op: "write", Path: f.name, Err: err}
+		}
+	}
+	return len(p), nil
+}
+
+func (f *redisFile) ReadAt(p []byte, off int64) (int, error) {
+	if atomic.LoadInt32(&f.closed) == 1 {
+		return 0, os.ErrClosed
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	data, err := f.fs.c.GetRange(f.name, off, off+int64(len(p))-1)
+	if err != nil {
+		return 0, &os.PathError{Op: "read", Path: f.name, Err: err}
+	}
+	n := copy(p, data)
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (f *redisFile) Read(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n, err := f.ReadAt(p, f.off)
+	f.off += int64(n)
+	if n > 0 && err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+// Stat returns the size of the File.
+func (f *redisFile) Stat() (os.FileInfo, error) {
+	size, err := f.fs.c.StrLen(f.name)
+	if err != nil {
+		return nil, &os.PathError{Op: "stat", Path: f.name, Err: err}
+	}
+	return readerInfo{name: path.Base(f.name), size: size}, nil
+}
+
+func (f *redisFile) Close() error {
+	atomic.StoreInt32(&f.closed, 1)
+	return nil
+}
@@ -0,0 +1,211 @@
+package stream
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+)
+
+// A remote read request is the offset (8 bytes) and length (4 bytes) to ReadAt, big-endian.
+// The response is a status byte and the length (4 bytes) of its payload, which is the data
+// read for statusOK, and the error message for statusError.
+const (
+	statusOK byte = iota
+	statusEOF
+	statusCanceled
+	statusError
+)
+
+// maxRemoteRead is the most a single remote read request returns, larger requests are short.
+const maxRemoteRead = 1 << 20
+
+// ServeStream serves s to clients connecting to l with DialStream, ex. over a unix socket
+// so sidecar processes can read an in-flight Stream. Each connection gets its own Reader,
+// which is Closed when the connection is. It returns once l.Accept fails, ex. after l is Closed.
+func ServeStream(l net.Listener, s *Stream) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go serveConn(conn, s)
+	}
+}
+
+func serveConn(conn net.Conn, s *Stream) {
+	defer conn.Close()
+
+	// requests are read concurrently, so a ReadAt blocked waiting for data is canceled once the client disconnects
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	reqs := make(chan [12]byte)
+	go func() {
+		defer cancel()
+		defer close(reqs)
+		br := bufio.NewReader(conn)
+		for {
+			var req [12]byte
+			if _, err := io.ReadFull(br, req[:]); err != nil {
+				return
+			}
+			select {
+			case reqs <- req:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	r, rerr := s.NextReader()
+	if rerr == nil {
+		defer r.Close()
+	}
+	for req := range reqs {
+		if rerr != nil {
+			writeResponse(conn, rerr, nil)
+			return
+		}
+
+		off := int64(binary.BigEndian.Uint64(req[:8]))
+		n := binary.BigEndian.Uint32(req[8:])
+		if n == 0 {
+			if err := writeResponse(conn, nil, nil); err != nil {
+				return
+			}
+			continue
+		}
+		if n > maxRemoteRead {
+			n = maxRemoteRead
+		}
+		p := make([]byte, n)
+		m, err := r.ReadAtContext(ctx, p, off)
+		if ctx.Err() != nil {
+			return
+		}
+		if m > 0 {
+			err = nil
+		}
+		if err := writeResponse(conn, err, p[:m]); err != nil {
+			return
+		}
+	}
+}
+
+func writeResponse(w io.Writer, err error, p []byte) error {
+	status := statusOK
+	switch {
+	case err == io.EOF:
+		status = statusEOF
+	case errors.Is(err, ErrCanceled):
+		status = statusCanceled
+	case err != nil:
+		status, p = statusError, []byte(err.Error())
+	}
+
+	buf := make([]byte, 5+len(p))
+	buf[0] = status
+	binary.BigEndian.PutUint32(buf[1:5], uint32(len(p)))
+	copy(buf[5:], p)
+	_, err = w.Write(buf)
+	return err
+}
+
+// RemoteReader reads a Stream served by ServeStream. Like a Reader, Reads block until the
+// requested data is written, or return io.EOF once the Stream is Closed, or ErrCanceled
+// if it's Canceled. Errors of other kinds are returned with their message only.
+type RemoteReader struct {
+	mu   sync.Mutex // held for each request/response
+	conn net.Conn
+	br   *bufio.Reader
+
+	readMu  sync.Mutex
+	readOff int64
+}
+
+// DialStream connects to a Stream served by ServeStream at address on network (ex. "unix").
+func DialStream(network, address string) (*RemoteReader, error) {
+	conn, err := net.Dial(network, address)
+	if err != nil {
+		return nil, err
+	}
+	return &RemoteReader{conn: conn, br: bufio.NewReader(conn)}, nil
+}
+
+// ReadAt reads len(p) bytes of the Stream starting at off, blocking until they're written.
+func (r *RemoteReader) ReadAt(p []byte, off int64) (n int, err error) {
+	for n < len(p) {
+		var m int
+		m, err = r.request(p[n:], off+int64(n))
+		n += m
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// Read reads from the Stream, blocking until data is written or the Stream is Closed.
+func (r *RemoteReader) Read(p []byte) (int, error) {
+	r.readMu.Lock()
+	defer r.readMu.Unlock()
+	if len(p) == 0 {
+		return 0, nil
+	}
+	n, err := r.request(p, r.readOff)
+	r.readOff += int64(n)
+	return n, err
+}
+
+// Close closes the connection, and so the Reader on the server.
+func (r *RemoteReader) Close() error {
+	return r.conn.Close()
+}
+
+// request reads up to len(p) bytes at off from the server.
+func (r *RemoteReader) request(p []byte, off int64) (int, error) {
+	if len(p) > maxRemoteRead {
+		p = p[:maxRemoteRead]
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var req [12]byte
+	binary.BigEndian.PutUint64(req[:8], uint64(off))
+	binary.BigEndian.PutUint32(req[8:], uint32(len(p)))
+	if _, err := r.conn.Write(req[:]); err != nil {
+		return 0, err
+	}
+
+	var resp [5]byte
+	if _, err := io.ReadFull(r.br, resp[:]); err != nil {
+		return 0, err
+	}
+	size := binary.BigEndian.Uint32(resp[1:])
+	switch resp[0] {
+	case statusOK:
+		if int(size) > len(p) {
+			return 0, errors.New("stream: invalid remote response")
+		}
+		return io.ReadFull(r.br, p[:size])
+
+	case statusEOF:
+		return 0, io.EOF
+
+	case statusCanceled:
+		return 0, ErrCanceled
+	}
+
+	if size > maxRemoteRead {
+		return 0, errors.New("stream: invalid remote response")
+	}
+	msg := make([]byte, size)
+	if _, err := io.ReadFull(r.br, msg); err != nil {
+		return 0, err
+	}
+	return 0, errors.New(string(msg))
+}
@@ -0,0 +1,95 @@
+package stream
+
+import (
+	"encoding/binary"
+	"io"
+	"time"
+)
+
+// A replay index (see WithReplayIndex) is a sequence of entries, one per Write: the size of the
+// Stream after the Write and the time of the Write in Unix nanoseconds, both int64 little-endian.
+const replayEntry = 16
+
+func replayName(name string) string { return name + ".times" }
+
+// recordWrite appends an entry for a Write which grew the Stream to size to the replay index.
+func (s *Stream) recordWrite(size int64) error {
+	var entry [replayEntry]byte
+	binary.LittleEndian.PutUint64(entry[:8], uint64(size))
+	binary.LittleEndian.PutUint64(entry[8:], uint64(time.Now().UnixNano()))
+	_, err := s.replay.Write(entry[:])
+	return err
+}
+
+// Paced returns an io.ReadCloser which Reads from r on the schedule the Stream was written on,
+// as recorded by WithReplayIndex, ex. to replay a recorded live Stream of logs or telemetry to a
+// consumer realistically. Bytes aren't returned until the time since the first Read matches the
+// time since the first Write, divided by speed (1 for the original pace, 2 for twice as fast).
+// Bytes the index doesn't cover, ex. if the writer is still writing it, are returned right away.
+// It returns an error if the Stream has no replay index, and ErrUnsupported for a NewMemStream. Close Closes the index, but not r.
+func (r *Reader) Paced(speed float64) (io.ReadCloser, error) {
+	if _, ok := r.s.fs.(singletonFs); ok {
+		return nil, ErrUnsupported
+	}
+	name := r.s.replayPath
+	if name == "" {
+		name = replayName(r.Name())
+	}
+	idx, err := r.s.fs.Open(name)
+	if err != nil {
+		return nil, wrapErr("open", name, -1, err)
+	}
+	return &pacedReader{r: r, idx: idx, speed: speed}, nil
+}
+
+type pacedReader struct {
+	r     *Reader
+	idx   File
+	speed float64
+
+	start    time.Time // of the first Read
+	first    int64     // time of the first Write
+	end, at  int64     // the size of the Stream after the next Write to release, and its time
+	off      int64     // bytes Read
+	unpaced  bool      // the index ran out, so Reads aren't paced
+	hasEntry bool
+}
+
+// next reads the entry of the next Write past off from the index, and returns false if there's none.
+func (p *pacedReader) next() bool {
+	for !p.hasEntry || p.end <= p.off {
+		var entry [replayEntry]byte
+		if _, err := io.ReadFull(p.idx, entry[:]); err != nil {
+			return false
+		}
+		p.end = int64(binary.LittleEndian.Uint64(entry[:8]))
+		p.at = int64(binary.LittleEndian.Uint64(entry[8:]))
+		if !p.hasEntry {
+			p.first = p.at
+		}
+		p.hasEntry = true
+	}
+	return true
+}
+
+func (p *pacedReader) Read(b []byte) (int, error) {
+	if p.start.IsZero() {
+		p.start = time.Now()
+	}
+	if !p.unpaced && p.next() {
+		due := p.start.Add(time.Duration(float64(p.at-p.first) / p.speed))
+		if wait := time.Until(due); wait > 0 {
+			time.Sleep(wait)
+		}
+		if max := p.end - p.off; int64(len(b)) > max {
+			b = b[:max]
+		}
+	} else {
+		p.unpaced = true
+	}
+	n, err := p.r.Read(b)
+	p.off += int64(n)
+	return n, err
+}
+
+func (p *pacedReader) Close() error { return p.idx.Close() }
@@ -0,0 +1,178 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"time"
+)
+
+// Backoff is the retry policy of NewRetryFS.
+type Backoff struct {
+	Attempts int           // the most attempts of an operation, including the first, 1 if < 1
+	Delay    time.Duration // the delay before the first retry, which doubles after each one
+	MaxDelay time.Duration // caps the delay, if > 0
+
+	// Retryable reports whether err is transient, and so the operation which failed with it
+	// should be retried. If nil, every error is retried but io.EOF and the errors which retrying can't
+	// fix: ErrUnsupported, os.ErrNotExist, os.ErrExist, os.ErrPermission, os.ErrClosed, and those of the
+	// Streams and FileSystems of this package (ErrQuotaExceeded, ErrFileTooLarge, ErrNotFoundInMem,
+	// ErrCorrupt, ErrTrimmed, ErrCanceled and ErrWriterClosed).
+	Retryable func(err error) bool
+}
+
+// permanentErrs aren't retried by default, see Backoff.Retryable.
+var permanentErrs = []error{
+	ErrUnsupported, os.ErrNotExist, os.ErrExist, os.ErrPermission, os.ErrClosed,
+	ErrQuotaExceeded, ErrFileTooLarge, ErrNotFoundInMem, ErrCorrupt, ErrTrimmed, ErrCanceled, ErrWriterClosed,
+}
+
+func (b Backoff) retryable(err error) bool {
+	if err == nil || err == io.EOF {
+		return false
+	}
+	if b.Retryable != nil {
+		return b.Retryable(err)
+	}
+	for _, permanent := range permanentErrs {
+		if errors.Is(err, permanent) {
+			return false
+		}
+	}
+	return true
+}
+
+// do calls op until it succeeds, fails with an error which isn't retryable, runs out of attempts,
+// or ctx is done. op returns whether it made progress, which resets the attempts.
+func (b Backoff) do(ctx context.Context, op func() (progress bool, err error)) error {
+	delay := b.Delay
+	for attempt := 1; ; attempt++ {
+		progress, err := op()
+		if progress {
+			attempt, delay = 0, b.Delay
+		}
+		if !b.retryable(err) || attempt >= b.Attempts {
+			return err
+		}
+		t := time.NewTimer(delay)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		}
+		if delay *= 2; b.MaxDelay > 0 && delay > b.MaxDelay {
+			delay = b.MaxDelay
+		}
+	}
+}
+
+// NewRetryFS returns a FileSystem which retries operations on inner, and on its Files, which fail
+// with transient errors (see Backoff.Retryable), ex. when inner is a network or cloud backend.
+// Create, Open and Remove are retried, as are Read, ReadAt and Write, which continue from where
+// a failed call stopped. Close is not retried. With a context (see FileSystemContext and WriterContext),
+// it stops retrying once the context is done, which is also passed on to inner.
+func NewRetryFS(inner FileSystem, policy Backoff) FileSystem {
+	return &retryFS{inner: inner, policy: policy}
+}
+
+type retryFS struct {
+	inner  FileSystem
+	policy Backoff
+}
+
+func (fs *retryFS) Create(name string) (File, error) {
+	return fs.CreateContext(context.Background(), name)
+}
+
+func (fs *retryFS) CreateContext(ctx context.Context, name string) (f File, err error) {
+	err = fs.policy.do(ctx, func() (bool, error) {
+		f, err = createContext(ctx, fs.inner, name)
+		return false, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &retryFile{File: f, policy: fs.policy}, nil
+}
+
+func (fs *retryFS) Open(name string) (File, error) {
+	return fs.OpenContext(context.Background(), name)
+}
+
+func (fs *retryFS) OpenContext(ctx context.Context, name string) (f File, err error) {
+	err = fs.policy.do(ctx, func() (bool, error) {
+		f, err = openContext(ctx, fs.inner, name)
+		return false, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &retryFile{File: f, policy: fs.policy}, nil
+}
+
+func (fs *retryFS) Remove(name string) error {
+	return fs.RemoveContext(context.Background(), name)
+}
+
+func (fs *retryFS) RemoveContext(ctx context.Context, name string) error {
+	return fs.policy.do(ctx, func() (bool, error) {
+		return false, removeContext(ctx, fs.inner, name)
+	})
+}
+
+func (fs *retryFS) Rename(oldname, newname string) error {
+	inner, ok := fs.inner.(Renamer)
+	if !ok {
+		return ErrUnsupported
+	}
+	return fs.policy.do(context.Background(), func() (bool, error) {
+		return false, inner.Rename(oldname, newname)
+	})
+}
+
+func (fs *retryFS) canRename() bool { return canRename(fs.inner) }
+
+func (fs *retryFS) syncDir(name string) error { return syncDir(fs.inner, name) }
+
+type retryFile struct {
+	File
+	policy Backoff
+}
+
+func (f *retryFile) Write(p []byte) (int, error) {
+	return f.WriteContext(context.Background(), p)
+}
+
+func (f *retryFile) WriteContext(ctx context.Context, p []byte) (n int, err error) {
+	err = f.policy.do(ctx, func() (bool, error) {
+		m, err := writeContext(ctx, f.File, p[n:])
+		n += m
+		return m > 0, err
+	})
+	return n, err
+}
+
+func (f *retryFile) ReadAt(p []byte, off int64) (n int, err error) {
+	err = f.policy.do(context.Background(), func() (bool, error) {
+		m, err := f.File.ReadAt(p[n:], off+int64(n))
+		n += m
+		return m > 0, err
+	})
+	return n, err
+}
+
+// Read returns what was read before a transient error, and retries it on the next Read.
+func (f *retryFile) Read(p []byte) (n int, err error) {
+	err = f.policy.do(context.Background(), func() (bool, error) {
+		n, err = f.File.Read(p)
+		if n > 0 && f.policy.retryable(err) {
+			err = nil
+		}
+		return false, err
+	})
+	return n, err
+}
+
+func (f *retryFile) Sync() error { return syncFile(f.File) }
@@ -0,0 +1,31 @@
+package stream
+
+import (
+	"bufio"
+	"io"
+)
+
+// Scanner returns a bufio.Scanner of the Stream from the Reader's Read offset, split into tokens
+// by split (bufio.ScanLines if nil). Scan blocks until a whole token is written, so a partly
+// written line isn't returned early; the last token is returned once the Stream is Closed.
+// Then Scan returns false, and the Scanner's Err is nil, or the error the Stream was Canceled
+// or Closed with (see CloseWithError). The Scanner reads ahead, so it shouldn't be mixed with other Reads.
+func (r *Reader) Scanner(split bufio.SplitFunc) *bufio.Scanner {
+	sc := bufio.NewScanner(scanReader{r})
+	if split != nil {
+		sc.Split(split)
+	}
+	return sc
+}
+
+// scanReader blocks rather than return no data, as bufio.Scanner gives up after too many empty Reads.
+type scanReader struct {
+	r io.Reader
+}
+
+func (s scanReader) Read(p []byte) (n int, err error) {
+	for n == 0 && err == nil && len(p) > 0 {
+		n, err = s.r.Read(p)
+	}
+	return n, err
+}
@@ -0,0 +1,323 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// ErrTrimmed is returned when reading a section of a File which was removed by SegmentFS.Trim,
+// or discarded by Stream.PunchHole.
+var ErrTrimmed = errors.New("stream: section of file was trimmed")
+
+// SegmentFS is a FileSystem which rolls each File over to a new segment of the wrapped
+// FileSystem every segmentSize bytes, named "name.0", "name.1"..., while its Readers read
+// seamlessly across segment boundaries. Old segments can be removed under a live Stream with
+// Trim, to enforce a retention policy. Files can only be Opened through the SegmentFS they
+// were Created with, which keeps track of their segments.
+type SegmentFS struct {
+	inner FileSystem
+	size  int64
+
+	mu    sync.Mutex
+	files map[string]*segments
+}
+
+// NewSegmentFS returns a SegmentFS of segments of segmentSize bytes, stored in inner.
+func NewSegmentFS(inner FileSystem, segmentSize int64) *SegmentFS {
+	return &SegmentFS{inner: inner, size: segmentSize, files: make(map[string]*segments)}
+}
+
+// segments tracks the segments of a File.
+type segments struct {
+	mu    sync.RWMutex
+	name  string
+	first int   // the first segment which hasn't been trimmed
+	size  int64 // bytes written
+}
+
+func segmentName(name string, i int) string { return fmt.Sprintf("%s.%d", name, i) }
+
+func (fs *SegmentFS) Create(name string) (File, error) {
+	return fs.CreateContext(context.Background(), name)
+}
+
+// CreateContext is Create, passing ctx on to the inner FileSystem, see FileSystemContext.
+// Segments Created by later Writes use the context of those Writes, see WriterContext.
+func (fs *SegmentFS) CreateContext(ctx context.Context, name string) (File, error) {
+	f, err := createContext(ctx, fs.inner, segmentName(name, 0))
+	if err != nil {
+		return nil, err
+	}
+	segs := &segments{name: name}
+	fs.mu.Lock()
+	fs.files[name] = segs
+	fs.mu.Unlock()
+	return &segmentWriter{segmentReader: segmentReader{fs: fs, segs: segs}, cur: f}, nil
+}
+
+func (fs *SegmentFS) Open(name string) (File, error) {
+	segs, err := fs.segments("open", name)
+	if err != nil {
+		return nil, err
+	}
+	return &segmentReader{fs: fs, segs: segs}, nil
+}
+
+// OpenContext is Open. Segments are Opened as they're read, so ctx isn't used.
+func (fs *SegmentFS) OpenContext(ctx context.Context, name string) (File, error) {
+	return fs.Open(name)
+}
+
+// Remove removes every remaining segment of the File.
+func (fs *SegmentFS) Remove(name string) error {
+	return fs.RemoveContext(context.Background(), name)
+}
+
+// RemoveContext is Remove, passing ctx on to the inner FileSystem, see FileSystemContext.
+func (fs *SegmentFS) RemoveContext(ctx context.Context, name string) error {
+	fs.mu.Lock()
+	segs, ok := fs.files[name]
+	delete(fs.files, name)
+	fs.mu.Unlock()
+	if !ok {
+		return &os.PathError{Op: "remove", Path: name, Err: os.ErrNotExist}
+	}
+
+	segs.mu.Lock()
+	defer segs.mu.Unlock()
+	var err error
+	for i := segs.first; i <= segs.last(fs.size); i++ {
+		if rerr := removeContext(ctx, fs.inner, segmentName(name, i)); err == nil && !os.IsNotExist(rerr) {
+			err = rerr
+		}
+	}
+	return err
+}
+
+func (fs *SegmentFS) Rename(oldname, newname string) error {
+	inner, ok := fs.inner.(Renamer)
+	if !ok {
+		return ErrUnsupported
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	segs, ok := fs.files[oldname]
+	if !ok {
+		return &os.PathError{Op: "rename", Path: oldname, Err: os.ErrNotExist}
+	}
+	segs.mu.Lock()
+	defer segs.mu.Unlock()
+	for i := segs.first; i <= segs.last(fs.size); i++ {
+		if err := inner.Rename(segmentName(oldname, i), segmentName(newname, i)); err != nil {
+			return err
+		}
+	}
+	segs.name = newname
+	delete(fs.files, oldname)
+	fs.files[newname] = segs
+	return nil
+}
+
+func (fs *SegmentFS) canRename() bool { return canRename(fs.inner) }
+
+func (fs *SegmentFS) syncDir(name string) error { return syncDir(fs.inner, name) }
+
+// Trim removes the segments of the File which are entirely before off, ex. the offset of
+// the slowest Reader. Reads of trimmed sections return ErrTrimmed.
+func (fs *SegmentFS) Trim(name string, off int64) error {
+	segs, err := fs.segments("trim", name)
+	if err != nil {
+		return err
+	}
+
+	segs.mu.Lock()
+	defer segs.mu.Unlock()
+	if off > segs.size {
+		off = segs.size
+	}
+	for ; int64(segs.first+1)*fs.size <= off; segs.first++ {
+		if err := fs.inner.Remove(segmentName(segs.name, segs.first)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Segments returns the names of the remaining segments of the File, first to last.
+func (fs *SegmentFS) Segments(name string) ([]string, error) {
+	segs, err := fs.segments("segments", name)
+	if err != nil {
+		return nil, err
+	}
+	segs.mu.RLock()
+	defer segs.mu.RUnlock()
+	var names []string
+	for i := segs.first; i <= segs.last(fs.size); i++ {
+		names = append(names, segmentName(segs.name, i))
+	}
+	return names, nil
+}
+
+func (fs *SegmentFS) segments(op, name string) (*segments, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	segs, ok := fs.files[name]
+	if !ok {
+		return nil, &os.PathError{Op: op, Path: name, Err: os.ErrNotExist}
+	}
+	return segs, nil
+}
+
+// last returns the index of the last segment, segs.mu must be held.
+func (segs *segments) last(segmentSize int64) int {
+	if segs.size == 0 {
+		return 0
+	}
+	return int((segs.size - 1) / segmentSize)
+}
+
+// segmentReader reads a File across its segments. It keeps the segment last read from open.
+type segmentReader struct {
+	fs   *SegmentFS
+	segs *segments
+
+	mu   sync.Mutex // guards the fields below
+	idx  int
+	file File  // segment idx, nil if none is open
+	off  int64 // offset for Read
+}
+
+func (r *segmentReader) Name() string {
+	r.segs.mu.RLock()
+	defer r.segs.mu.RUnlock()
+	return r.segs.name
+}
+
+func (r *segmentReader) ReadAt(p []byte, off int64) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.readAt(p, off)
+}
+
+// readAt is ReadAt, r.mu must be held.
+func (r *segmentReader) readAt(p []byte, off int64) (n int, err error) {
+	r.segs.mu.RLock()
+	size, first, name := r.segs.size, r.segs.first, r.segs.name
+	r.segs.mu.RUnlock()
+
+	if off < int64(first)*r.fs.size {
+		return 0, ErrTrimmed
+	}
+	if off >= size {
+		return 0, io.EOF
+	}
+	if max := size - off; int64(len(p)) > max {
+		p, err = p[:max], io.EOF
+	}
+
+	for n < len(p) {
+		pos := off + int64(n)
+		idx := int(pos / r.fs.size)
+		if r.file == nil || r.idx != idx {
+			if r.file != nil {
+				r.file.Close()
+			}
+			if r.file, err = r.fs.inner.Open(segmentName(name, idx)); err != nil {
+				return n, err
+			}
+			r.idx = idx
+		}
+
+		end := len(p)
+		if max := int64(idx+1)*r.fs.size - pos; int64(end-n) > max {
+			end = n + int(max)
+		}
+		m, rerr := r.file.ReadAt(p[n:end], pos%r.fs.size)
+		n += m
+		if rerr != nil && rerr != io.EOF {
+			return n, rerr
+		}
+		if m == 0 {
+			return n, io.ErrUnexpectedEOF
+		}
+	}
+	return n, err
+}
+
+func (r *segmentReader) Read(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n, err := r.readAt(p, r.off)
+	r.off += int64(n)
+	if n > 0 && err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+func (r *segmentReader) Write(p []byte) (int, error) { return 0, ErrUnsupported }
+
+func (r *segmentReader) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
+
+// segmentWriter writes a File, rolling over to a new segment when the current one is full.
+type segmentWriter struct {
+	segmentReader
+	cur File // the segment being written
+}
+
+func (w *segmentWriter) Write(p []byte) (int, error) {
+	return w.WriteContext(context.Background(), p)
+}
+
+func (w *segmentWriter) WriteContext(ctx context.Context, p []byte) (n int, err error) {
+	for len(p) > 0 {
+		w.segs.mu.RLock()
+		size, name := w.segs.size, w.segs.name
+		w.segs.mu.RUnlock()
+
+		room := w.fs.size - size%w.fs.size
+		if size > 0 && size%w.fs.size == 0 {
+			w.cur.Close()
+			if w.cur, err = createContext(ctx, w.fs.inner, segmentName(name, int(size/w.fs.size))); err != nil {
+				return n, err
+			}
+		}
+
+		chunk := p
+		if int64(len(chunk)) > room {
+			chunk = chunk[:room]
+		}
+		m, err := writeContext(ctx, w.cur, chunk)
+		n += m
+		p = p[m:]
+
+		w.segs.mu.Lock()
+		w.segs.size += int64(m)
+		w.segs.mu.Unlock()
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+func (w *segmentWriter) Sync() error { return syncFile(w.cur) }
+
+func (w *segmentWriter) Close() error {
+	w.segmentReader.Close()
+	return w.cur.Close()
+}
@@ -0,0 +1,39 @@
+package stream
+
+// SFTPClient is the part of an SFTP client used by NewSFTPFS. *sftp.Client from github.com/pkg/sftp
+// implements it with F *sftp.File, so this package doesn't have to depend on an SFTP implementation.
+type SFTPClient[F File] interface {
+	Create(path string) (F, error)
+	Open(path string) (F, error)
+	Remove(path string) error
+	Rename(oldpath, newpath string) error
+}
+
+// NewSFTPFS returns a FileSystem of the Files on a remote host reached with c, so Streams can cache
+// through to SFTP storage. Readers Open the File while it's written, so the server must allow a File
+// to be Opened for reading while it's open for writing, which OpenSSH's does.
+func NewSFTPFS[F File](c SFTPClient[F]) FileSystem {
+	return sftpFS[F]{c}
+}
+
+type sftpFS[F File] struct{ c SFTPClient[F] }
+
+func (fs sftpFS[F]) Create(name string) (File, error) {
+	f, err := fs.c.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (fs sftpFS[F]) Open(name string) (File, error) {
+	f, err := fs.c.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (fs sftpFS[F]) Remove(name string) error { return fs.c.Remove(name) }
+
+func (fs sftpFS[F]) Rename(oldname, newname string) error { return fs.c.Rename(oldname, newname) }
@@ -0,0 +1,74 @@
+package stream
+
+import (
+	"context"
+	"io"
+	"sync"
+)
+
+// sharedFile is the File shared by every Reader of a Stream created WithSharedFile.
+type sharedFile struct {
+	File
+	refs int // guarded by Stream.sharedMu
+}
+
+// openShared returns a handle to the shared File, opening it if no Reader holds it. s.nameMu must be held.
+func (s *Stream) openShared(ctx context.Context) (File, error) {
+	s.sharedMu.Lock()
+	defer s.sharedMu.Unlock()
+	if s.shared == nil {
+		f, err := openContext(ctx, s.fs, s.name)
+		if err != nil {
+			return nil, wrapErr("open", s.name, -1, err)
+		}
+		s.shared = &sharedFile{File: f}
+	}
+	s.shared.refs++
+	return &sharedHandle{s: s, sf: s.shared}, nil
+}
+
+// release drops a reference to sf, closing it once no Reader holds it.
+func (s *Stream) release(sf *sharedFile) error {
+	s.sharedMu.Lock()
+	defer s.sharedMu.Unlock()
+	sf.refs--
+	if sf.refs > 0 {
+		return nil
+	}
+	if s.shared == sf {
+		s.shared = nil
+	}
+	return sf.Close()
+}
+
+// sharedHandle is a Reader's handle to the shared File, only ReadAt touches the File,
+// so Readers never interfere with each other's offsets.
+type sharedHandle struct {
+	s         *Stream
+	sf        *sharedFile
+	closeOnce onceWithErr
+
+	mu  sync.Mutex
+	off int64 // offset for Read
+}
+
+func (h *sharedHandle) Name() string { return h.sf.Name() }
+
+func (h *sharedHandle) ReadAt(p []byte, off int64) (int, error) { return h.sf.ReadAt(p, off) }
+
+func (h *sharedHandle) Read(p []byte) (int, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	n, err := h.sf.ReadAt(p, h.off)
+	h.off += int64(n)
+	if n > 0 && err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+func (h *sharedHandle) Write(p []byte) (int, error) { return 0, ErrUnsupported }
+
+func (h *sharedHandle) Close() error {
+	return h.closeOnce.Do(func() error { return h.s.release(h.sf) })
+}
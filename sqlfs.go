@@ -0,0 +1,225 @@
+package stream
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sync"
+	"sync/atomic"
+)
+
+// NewSQLFS returns a FileSystem which stores Files as rows of chunks of up to chunkSize bytes in
+// table of db, creating it if needed, so an embedded application can keep thousands of small Streams
+// in one SQLite file, and Remove each one in a single transaction. db must use a driver with "?"
+// placeholders, as SQLite drivers do. It can't Rename Files, since Opened Files read by name.
+func NewSQLFS(db *sql.DB, table string, chunkSize int) (FileSystem, error) {
+	_, err := db.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	name TEXT NOT NULL,
+	seq INTEGER NOT NULL,
+	data BLOB NOT NULL,
+	PRIMARY KEY (name, seq)
+)`, table))
+	if err != nil {
+		return nil, err
+	}
+	return &sqlFS{db: db, table: table, chunkSize: chunkSize}, nil
+}
+
+// sqlFS stores File name as rows (name, seq, data) of its chunks in order. Every chunk but the last
+// is chunkSize bytes, and a File always has a chunk 0, so it exists even if it's empty.
+type sqlFS struct {
+	db        *sql.DB
+	table     string
+	chunkSize int
+}
+
+func (fs *sqlFS) Create(name string) (File, error) {
+	return fs.CreateContext(context.Background(), name)
+}
+
+func (fs *sqlFS) CreateContext(ctx context.Context, name string) (File, error) {
+	err := fs.tx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE name = ?", fs.table), name); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, fmt.Sprintf("INSERT INTO %s (name, seq, data) VALUES (?, 0, ?)", fs.table), name, []byte{})
+		return err
+	})
+	if err != nil {
+		return nil, &os.PathError{Op: "create", Path: name, Err: err}
+	}
+	return &sqlFile{fs: fs, name: name}, nil
+}
+
+func (fs *sqlFS) Open(name string) (File, error) {
+	return fs.OpenContext(context.Background(), name)
+}
+
+func (fs *sqlFS) OpenContext(ctx context.Context, name string) (File, error) {
+	var seq int64
+	err := fs.db.QueryRowContext(ctx, fmt.Sprintf("SELECT seq FROM %s WHERE name = ? AND seq = 0", fs.table), name).Scan(&seq)
+	if err == sql.ErrNoRows {
+		err = os.ErrNotExist
+	}
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &sqlFile{fs: fs, name: name}, nil
+}
+
+func (fs *sqlFS) Remove(name string) error {
+	return fs.RemoveContext(context.Background(), name)
+}
+
+func (fs *sqlFS) RemoveContext(ctx context.Context, name string) error {
+	res, err := fs.db.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE name = ?", fs.table), name)
+	if err == nil {
+		if n, rerr := res.RowsAffected(); rerr == nil && n == 0 {
+			err = os.ErrNotExist
+		}
+	}
+	if err != nil {
+		return &os.PathError{Op: "remove", Path: name, Err: err}
+	}
+	return nil
+}
+
+// tx runs do in a transaction, which is committed if it succeeds.
+func (fs *sqlFS) tx(ctx context.Context, do func(tx *sql.Tx) error) error {
+	tx, err := fs.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := do(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+type sqlFile struct {
+	fs   *sqlFS
+	name string
+
+	mu   sync.Mutex // serializes Writes and Read
+	size int64      // bytes Written, for a Created File
+	tail []byte     // the last chunk, for a Created File
+	off  int64      // for Read
+
+	closed int32
+}
+
+func (f *sqlFile) Name() string { return f.name }
+
+// Write updates the last chunk and inserts the chunks after it in one transaction, so Readers never
+// see a partial Write.
+func (f *sqlFile) Write(p []byte) (int, error) {
+	return f.WriteContext(context.Background(), p)
+}
+
+func (f *sqlFile) WriteContext(ctx context.Context, p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(p) == 0 {
+		return 0, nil
+	}
+	cs := f.fs.chunkSize
+	tail := f.tail
+	seq := (f.size - int64(len(tail))) / int64(cs)
+	rest := p
+	err := f.fs.tx(ctx, func(tx *sql.Tx) error {
+		if len(tail) < cs {
+			n := cs - len(tail)
+			if n > len(rest) {
+				n = len(rest)
+			}
+			tail = append(tail[:len(tail):len(tail)], rest[:n]...)
+			rest = rest[n:]
+			if _, err := tx.ExecContext(ctx, fmt.Sprintf("UPDATE %s SET data = ? WHERE name = ? AND seq = ?", f.fs.table), tail, f.name, seq); err != nil {
+				return err
+			}
+		}
+		for len(rest) > 0 {
+			n := cs
+			if n > len(rest) {
+				n = len(rest)
+			}
+			tail, rest = rest[:n:n], rest[n:]
+			seq++
+			if _, err := tx.ExecContext(ctx, fmt.Sprintf("INSERT INTO %s (name, seq, data) VALUES (?, ?, ?)", f.fs.table), f.name, seq, tail); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, &os.PathError{Op: "write", Path: f.name, Err: err}
+	}
+	f.size += int64(len(p))
+	f.tail = append([]byte(nil), tail...)
+	return len(p), nil
+}
+
+func (f *sqlFile) ReadAt(p []byte, off int64) (n int, err error) {
+	if atomic.LoadInt32(&f.closed) == 1 {
+		return 0, os.ErrClosed
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	cs := int64(f.fs.chunkSize)
+	rows, err := f.fs.db.Query(fmt.Sprintf("SELECT seq, data FROM %s WHERE name = ? AND seq >= ? AND seq <= ? ORDER BY seq", f.fs.table),
+		f.name, off/cs, (off+int64(len(p))-1)/cs)
+	if err != nil {
+		return 0, &os.PathError{Op: "read", Path: f.name, Err: err}
+	}
+	defer rows.Close()
+	for n < len(p) && rows.Next() {
+		var seq int64
+		var data []byte
+		if err := rows.Scan(&seq, &data); err != nil {
+			return n, &os.PathError{Op: "read", Path: f.name, Err: err}
+		}
+		pos := off + int64(n)
+		if seq != pos/cs || pos%cs >= int64(len(data)) {
+			break // past the end
+		}
+		n += copy(p[n:], data[pos%cs:])
+	}
+	if err := rows.Err(); err != nil {
+		return n, &os.PathError{Op: "read", Path: f.name, Err: err}
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (f *sqlFile) Read(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n, err := f.ReadAt(p, f.off)
+	f.off += int64(n)
+	if n > 0 && err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+// Stat returns the size of the File.
+func (f *sqlFile) Stat() (os.FileInfo, error) {
+	var size int64
+	err := f.fs.db.QueryRow(fmt.Sprintf("SELECT COALESCE(SUM(LENGTH(data)), 0) FROM %s WHERE name = ?", f.fs.table), f.name).Scan(&size)
+	if err != nil {
+		return nil, &os.PathError{Op: "stat", Path: f.name, Err: err}
+	}
+	return readerInfo{name: path.Base(f.name), size: size}, nil
+}
+
+func (f *sqlFile) Close() error {
+	atomic.StoreInt32(&f.closed, 1)
+	return nil
+}
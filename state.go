@@ -0,0 +1,153 @@
+package stream
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+)
+
+// The contents of a state file (see WithStateFile).
+const (
+	stateOpen     = "open"
+	stateClosed   = "closed"
+	stateCanceled = "canceled"
+)
+
+// defaultPollInterval is how often an Attached Stream checks for changes, unless WithPollInterval is used.
+const defaultPollInterval = 100 * time.Millisecond
+
+func stateName(name string) string { return name + ".state" }
+
+// writeState records the state of the Stream in its state file.
+func (s *Stream) writeState(state string, size int64) error {
+	f, err := s.fs.Create(s.statePath)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(f, state, size)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// closeState records that the Stream was Closed or Canceled.
+func (s *Stream) closeState() error {
+	if s.b.Canceled() {
+		return s.writeState(stateCanceled, 0)
+	}
+	size, _ := s.b.Size()
+	return s.writeState(stateClosed, size)
+}
+
+// readState returns the state recorded in the state file of name, and the final size
+// if it's stateClosed. A missing or partially written state file is stateOpen.
+func readState(fs FileSystem, name string) (state string, size int64) {
+	f, err := fs.Open(stateName(name))
+	if err != nil {
+		return stateOpen, 0
+	}
+	defer f.Close()
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return stateOpen, 0
+	}
+	if _, err := fmt.Sscan(string(data), &state, &size); err != nil {
+		return stateOpen, 0
+	}
+	return state, size
+}
+
+// Attach returns a Stream which follows the File name in fs, while it's written by a Stream
+// in another process which was created WithStateFile. Readers from NextReader block for new
+// data, and see EOF once the writer has Closed the Stream, like Readers of the writer's Stream.
+// If the writer Cancels its Stream, so is the attached Stream.
+//
+// The attached Stream polls fs for changes (see WithPollInterval). It can't be written to,
+// and Cancel stops following the File. Remove removes the File, as usual.
+func Attach(name string, fs FileSystem, opts ...Option) (*Stream, error) {
+	return attach(name, fs, true, opts...)
+}
+
+// FollowFile returns a Stream which follows the File name in fs while another process appends to
+// it, like tail -f: Readers from NextReader block for new data, and ReadAt works on what has been
+// appended so far. Unlike Attach, the writer needn't be a Stream, so the followed Stream never
+// ends on its own: Close it to stop following, after which Readers see EOF at the end of the data,
+// or Cancel it. It polls fs for changes (see WithPollInterval).
+func FollowFile(name string, fs FileSystem, opts ...Option) (*Stream, error) {
+	return attach(name, fs, false, opts...)
+}
+
+// attach follows the File name in fs, and its state file if withState.
+func attach(name string, fs FileSystem, withState bool, opts ...Option) (*Stream, error) {
+	f, err := fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	ff := &followFile{File: f, stop: make(chan struct{})}
+	s := newStream(name, ff, fs, opts...)
+	s.start()
+	go s.follow(ff, withState)
+	return s, nil
+}
+
+// followFile is the File of an Attached Stream, it's used to find the size of the File.
+type followFile struct {
+	File
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+func (f *followFile) Write(p []byte) (int, error) { return 0, ErrUnsupported }
+
+func (f *followFile) Close() error {
+	f.stopOnce.Do(func() { close(f.stop) })
+	return f.File.Close()
+}
+
+// follow polls the File of an Attached Stream, and its state file if withState, until the writer's
+// Stream is Closed or Canceled, or the followFile is Closed.
+func (s *Stream) follow(f *followFile, withState bool) {
+	every := s.pollEvery
+	if every <= 0 {
+		every = defaultPollInterval
+	}
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+
+	var seen int64
+	for {
+		state, final := stateOpen, int64(0)
+		if withState {
+			state, final = readState(s.fs, s.name)
+		}
+
+		size, err := fileSize(f.File)
+		if err != nil {
+			s.cancel(err)
+			return
+		}
+		if size > seen {
+			s.stall.busy()()
+			s.b.Wrote(int(size - seen))
+			seen = size
+		}
+
+		switch {
+		case state == stateCanceled:
+			s.cancel(nil)
+			return
+
+		case state == stateClosed && seen >= final:
+			s.Close()
+			return
+		}
+
+		select {
+		case <-ticker.C:
+		case <-f.stop:
+			return
+		}
+	}
+}
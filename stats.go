@@ -0,0 +1,117 @@
+package stream
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ReaderStats reports where a Reader has spent its time, see Reader.Stats. A Reader which spends
+// its time Blocked is waiting on a slow producer, while one which spends it Reading is waiting on
+// a slow FileSystem.
+type ReaderStats struct {
+	Blocked time.Duration // total time spent waiting for data to be written
+	Wakeups int64         // times the Reader was woken while waiting, ex. by a Write too short to satisfy it
+	Reading time.Duration // total time spent reading from the File
+}
+
+// readerStats are the counters of ReaderStats, and the state of the Reader for DebugDump, updated atomically.
+type readerStats struct {
+	blocked      int64 // nanoseconds
+	wakeups      int64
+	reading      int64 // nanoseconds
+	off          int64 // last Read offset
+	waitingSince int64 // UnixNano the Reader started waiting for data, 0 if it isn't
+	waitingFor   int64 // offset the Reader is waiting for
+	readingSince int64 // UnixNano the Reader started reading from the File, 0 if it isn't
+}
+
+// block records that the Reader is waiting for data at off, until the returned func is called.
+func (s *readerStats) block(off int64) func() {
+	start := time.Now()
+	atomic.StoreInt64(&s.waitingFor, off)
+	atomic.StoreInt64(&s.waitingSince, start.UnixNano())
+	return func() {
+		atomic.StoreInt64(&s.waitingSince, 0)
+		atomic.AddInt64(&s.blocked, int64(time.Since(start)))
+	}
+}
+
+func (s *readerStats) woke() { atomic.AddInt64(&s.wakeups, 1) }
+
+// read records that the Reader is reading from the File, until the returned func is called.
+func (s *readerStats) read() func() {
+	start := time.Now()
+	atomic.StoreInt64(&s.readingSince, start.UnixNano())
+	return func() {
+		atomic.StoreInt64(&s.readingSince, 0)
+		atomic.AddInt64(&s.reading, int64(time.Since(start)))
+	}
+}
+
+// Stats returns the cumulative time the Reader has spent blocked waiting for Writes and reading
+// from the File, and how many times it was woken while blocked. It's safe to call concurrently with
+// all other methods.
+func (r *Reader) Stats() ReaderStats {
+	return ReaderStats{
+		Blocked: time.Duration(atomic.LoadInt64(&r.stats.blocked)),
+		Wakeups: atomic.LoadInt64(&r.stats.wakeups),
+		Reading: time.Duration(atomic.LoadInt64(&r.stats.reading)),
+	}
+}
+
+// StreamStats reports how a Stream is being written and read, see Stream.Stats.
+type StreamStats struct {
+	Written int64   // bytes written
+	Writes  int64   // calls to Write which wrote data
+	Rate    float64 // bytes written per second, averaged over the last few seconds
+	Readers int     // open Readers
+}
+
+// rateWindow is the time constant of the decaying average of StreamStats.Rate.
+const rateWindow = 5 * time.Second
+
+// writeRate is an exponentially decaying average of the bytes written per second.
+type writeRate struct {
+	mu     sync.Mutex
+	writes int64
+	rate   float64
+	last   time.Time
+}
+
+func (w *writeRate) wrote(n int) {
+	if n == 0 {
+		return
+	}
+	now := time.Now()
+	w.mu.Lock()
+	w.writes++
+	w.rate = w.decayed(now) + float64(n)/rateWindow.Seconds()
+	w.last = now
+	w.mu.Unlock()
+}
+
+// decayed returns the rate as of now, w.mu must be held.
+func (w *writeRate) decayed(now time.Time) float64 {
+	if w.last.IsZero() {
+		return 0
+	}
+	return w.rate * math.Exp(-now.Sub(w.last).Seconds()/rateWindow.Seconds())
+}
+
+// Stats returns the bytes written to the Stream, how many Writes wrote them, the current write
+// throughput, and the number of open Readers, for admission control and dashboards.
+// It's safe to call concurrently with all other methods.
+func (s *Stream) Stats() StreamStats {
+	written, _ := s.b.Size()
+	readers, _ := s.b.Handles()
+	s.rate.mu.Lock()
+	defer s.rate.mu.Unlock()
+	return StreamStats{
+		Written: written,
+		Writes:  s.rate.writes,
+		Rate:    s.rate.decayed(time.Now()),
+		Readers: readers,
+	}
+}
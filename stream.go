@@ -2,13 +2,31 @@
 package stream
 
 import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"encoding/hex"
 	"errors"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime/debug"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // ErrUnsupported is returned when an operation is not supported.
 var ErrUnsupported = errors.New("unsupported")
 
+// ErrWriterClosed is returned by Write once the Stream has been Closed or Canceled.
+var ErrWriterClosed = errors.New("write to closed stream")
+
+// ErrStalled is the cause of the cancellation of a Stream which timed out waiting for a Write (see WithIdleTimeout).
+var ErrStalled = errors.New("stream stalled waiting for a write")
+
 // Stream is used to concurrently Write and Read from a File.
 type Stream struct {
 	mu        sync.Mutex
@@ -17,33 +35,178 @@ type Stream struct {
 	fs        FileSystem
 	seekEnd   sizeOnce
 	closeOnce onceWithErr
+	readahead int
+	idleAfter time.Duration // idle timeout for Readers, 0 if disabled
+	stall     *idleTimer    // cancels the Stream if there are no Writes, nil if disabled
+	hash      hash.Hash     // content hash to rename the File to on Close, nil if disabled
+	stateFile bool          // see WithStateFile
+	statePath string        // name of the state file, "" if disabled
+	pollEvery time.Duration // how often an Attached Stream polls for changes
+	committed bool          // the File was synced by Commit, so its directory is synced on Close
+	tees      []io.Writer   // also receive everything written to the File (see WithWriteTee)
+	bufSize   int           // size of pooled copy buffers, 0 for the default
+	share     bool          // Readers share one File (see WithSharedFile)
+	sharedMu  sync.Mutex
+	shared    *sharedFile // the File shared by open Readers, nil if there are none
+	budget    *FDBudget   // limits the Files open by Readers, nil if unlimited
+	archiveTo FileSystem  // copies the File here on Close, nil if disabled (see WithArchive)
+	archived  func(error)
+	gobMu     sync.Mutex
+	gobBuf    bytes.Buffer
+	gobEnc    *gob.Encoder // see EncodeGob
+	rate      writeRate    // see Stats
+	noWaitAt  bool         // see WithNonBlockingReadAt
+	strict    bool         // see WithStrictSize
+	holes     extentSet    // see PunchHole
+
+	xforms []func(io.Writer) io.WriteCloser // see WithWriteTransform
+	xform  *transformFile                   // the File, behind xforms, nil if there are none
+	rxform []func(io.Reader) io.Reader      // see WithReadTransform
+
+	onAudit func(AuditEvent) // see WithAudit, nil if disabled
+
+	deadline atomic.Value // time.Time, see SetWriteDeadline
+
+	merkle *MerkleTree // see WithMerkleTree, nil if disabled
+
+	replayIdx  bool   // see WithReplayIndex
+	replayPath string // name of the replay index, "" if disabled
+	replay     File   // the replay index
+
+	leakAfter time.Duration                   // see WithLeakDetection, 0 if disabled
+	onLeak    func(r *Reader, created []byte) // reports Readers still open leakAfter into a Remove
+	autoClose time.Duration                   // see WithReaderAutoClose, 0 if disabled
+	onClosed  func(r *Reader)                 // warns of Readers Closed autoClose into a Remove
+
+	nameMu    sync.RWMutex // held while the File is renamed
+	name      string
+	target    string // name to rename the File to on Close, "" if disabled
+	finalName string
+	discarded bool // the File was removed, by Cancel or Remove
+
+	placeholder string // reserves target until the File is renamed to it, see NewTempStream
 }
 
 // New creates a new Stream from the StdFileSystem with Name "name".
-func New(name string) (*Stream, error) {
-	return NewStream(name, StdFileSystem)
+func New(name string, opts ...Option) (*Stream, error) {
+	return NewStream(name, StdFileSystem, opts...)
 }
 
 // NewStream creates a new Stream with Name "name" in FileSystem fs.
-func NewStream(name string, fs FileSystem) (*Stream, error) {
-	f, err := fs.Create(name)
-	return newStream(f, fs), err
+// It returns ErrUnsupported if an option requires fs to implement Renamer, and it can't Rename.
+func NewStream(name string, fs FileSystem, opts ...Option) (*Stream, error) {
+	return NewStreamContext(context.Background(), name, fs, opts...)
+}
+
+// NewStreamContext is like NewStream, but if fs is a FileSystemContext, its Files are Created with ctx.
+func NewStreamContext(ctx context.Context, name string, fs FileSystem, opts ...Option) (*Stream, error) {
+	s := newStream(name, nil, fs, opts...)
+	if (s.hash != nil || s.target != "") && !canRename(fs) {
+		return nil, ErrUnsupported
+	}
+	f, err := createContext(ctx, fs, s.name)
+	err = wrapErr("create", s.name, -1, err)
+	s.setFile(f)
+	if err == nil && s.stateFile {
+		s.statePath = stateName(s.name)
+		err = s.writeState(stateOpen, 0)
+	}
+	if err == nil && s.replayIdx {
+		s.replayPath = replayName(s.name)
+		s.replay, err = createContext(ctx, fs, s.replayPath)
+		err = wrapErr("create", s.replayPath, -1, err)
+	}
+	if err == nil {
+		s.start()
+	}
+	return s, err
+}
+
+// NewTempStream creates a new Stream in the StdFileSystem, in a new File in dir with a unique name
+// chosen like ioutil.TempFile (pattern's last "*" is replaced by a random string). It returns the
+// Stream and the name of its File. With WithAtomicCreate, an empty File reserves the name until the
+// Stream is Closed, and is removed along with the temporary File if the Stream is Canceled.
+func NewTempStream(dir, pattern string, opts ...Option) (*Stream, string, error) {
+	f, err := ioutil.TempFile(dir, pattern)
+	if err != nil {
+		return nil, "", err
+	}
+	name := f.Name()
+	f.Close()
+
+	s, err := NewStream(name, StdFileSystem, opts...)
+	if err != nil {
+		os.Remove(name)
+		return nil, "", err
+	}
+	if s.target != "" {
+		s.placeholder = name
+	}
+	return s, name, nil
 }
 
 // NewMemStream creates an in-memory stream with no name, and no underlying fs.
 // This should replace uses of NewStream("name", NewMemFs()).
 // Remove() is unsupported as there is no fs to remove it from.
-func NewMemStream() *Stream {
+func NewMemStream(opts ...Option) *Stream {
 	f := newMemFile("")
-	return newStream(f, singletonFs{f})
+	s := newStream("", nil, singletonFs{f}, opts...)
+	s.setFile(f)
+	s.start()
+	return s
 }
 
-func newStream(file File, fs FileSystem) *Stream {
-	return &Stream{
+// setFile sets the File the Stream writes to, behind the transforms of WithWriteTransform.
+func (s *Stream) setFile(f File) {
+	s.file = f
+	if f != nil && len(s.xforms) > 0 {
+		s.xform = newTransformFile(f, s.xforms)
+		s.file = s.xform
+	}
+}
+
+// OpenStream returns a Closed Stream of the existing File name in fs, ex. one in a FileSystem
+// from NewReadOnlyFS, so content which was written before can be served to Readers without copying
+// it. It returns ErrUnsupported if an option would have to rewrite or Rename the File.
+func OpenStream(name string, fs FileSystem, opts ...Option) (*Stream, error) {
+	s := newStream(name, nil, fs, opts...)
+	if s.hash != nil || s.target != "" {
+		return nil, ErrUnsupported
+	}
+	f, err := fs.Open(name)
+	if err != nil {
+		return nil, wrapErr("open", name, -1, err)
+	}
+	size, err := fileSize(f)
+	if err != nil {
+		f.Close()
+		return nil, wrapErr("open", name, -1, err)
+	}
+	s.file = f
+	s.start()
+	s.SetSeekEnd(size)
+	s.b.Wrote(int(size))
+	return s, s.Close()
+}
+
+func newStream(name string, file File, fs FileSystem, opts ...Option) *Stream {
+	s := &Stream{
+		name: name,
 		file: file,
 		fs:   fs,
 		b:    newBroadcaster(),
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// start starts the timers of the Stream, once its File has been created.
+func (s *Stream) start() {
+	if s.stall != nil {
+		s.stall.start(func() { s.cancel(ErrStalled) })
+	}
 }
 
 type singletonFs struct {
@@ -52,34 +215,287 @@ type singletonFs struct {
 
 func (fs singletonFs) Create(key string) (File, error) { return nil, ErrUnsupported }
 
-func (fs singletonFs) Open(key string) (File, error) { return &memReader{memFile: fs.file}, nil }
+func (fs singletonFs) Open(key string) (File, error) { return fs.file.open(), nil }
 
 func (fs singletonFs) Remove(key string) error { return ErrUnsupported }
 
 // Name returns the name of the underlying File in the FileSystem.
-func (s *Stream) Name() string { return s.file.Name() }
+func (s *Stream) Name() string {
+	s.nameMu.RLock()
+	defer s.nameMu.RUnlock()
+	return s.name
+}
+
+// FinalName returns the name the File was renamed to when the Stream was Closed
+// (see WithContentAddress and WithAtomicCreate), or "" if it hasn't been renamed.
+func (s *Stream) FinalName() string {
+	s.nameMu.RLock()
+	defer s.nameMu.RUnlock()
+	return s.finalName
+}
 
 // Write writes p to the Stream. It's concurrent safe to be called with Stream's other methods.
+// It returns ErrWriterClosed once the Stream has been Closed or Canceled.
 func (s *Stream) Write(p []byte) (int, error) {
+	return s.write(context.Background(), len(p), func(w io.Writer, n int) (int, error) { return w.Write(p[:n]) })
+}
+
+// WriteContext is like Write, but stops waiting for slow Readers (see WithBackpressure) once ctx is done,
+// returning an error wrapping ctx.Err(), and passes ctx to the File if it's a WriterContext (unless
+// WithWriteTransform is used, as the transforms aren't).
+func (s *Stream) WriteContext(ctx context.Context, p []byte) (int, error) {
+	return s.write(ctx, len(p), func(w io.Writer, n int) (int, error) { return w.Write(p[:n]) })
+}
+
+// SetWriteDeadline sets the deadline of the Writes of the Stream (Write, WriteString, ReadFrom...), like
+// net.Conn.SetWriteDeadline: once it has passed, Writes fail with an error wrapping context.DeadlineExceeded,
+// including one already waiting for slow Readers. Until then, it's passed to the File as the deadline of a
+// context, if the File is a WriterContext. The zero time removes the deadline.
+func (s *Stream) SetWriteDeadline(t time.Time) {
+	s.deadline.Store(t)
+}
+
+// WriteString is like Write, but avoids copying str to a []byte when the File implements
+// io.StringWriter, as *os.File and the Files of NewMemFS do.
+func (s *Stream) WriteString(str string) (int, error) {
+	return s.write(context.Background(), len(str), func(w io.Writer, n int) (int, error) { return io.WriteString(w, str[:n]) })
+}
+
+// write writes size bytes to the Stream with ctx, using writeTo to write the first n bytes to a Writer.
+func (s *Stream) write(ctx context.Context, size int, writeTo func(w io.Writer, n int) (int, error)) (int, error) {
+	if d, _ := s.deadline.Load().(time.Time); !d.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, d)
+		defer cancel()
+	}
+	defer s.stall.busy()()
+	// waiting for slow Readers (see WithBackpressure) before taking s.mu, so it only throttles Writes
+	if err := s.b.WaitForReaders(ctx); err != nil {
+		return 0, wrapErr("write", s.Name(), -1, err)
+	}
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	n, err := s.file.Write(p)
-	s.b.Wrote(n)
+	if !s.b.IsOpen() {
+		return 0, ErrWriterClosed
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, wrapErr("write", s.Name(), -1, err)
+	}
+	if s.strict {
+		written, _ := s.b.Size()
+		if end := s.seekEnd.peek(); end >= 0 && written+int64(size) > end {
+			return 0, &SizeError{Want: end, Got: written + int64(size)}
+		}
+	}
+	off, _ := s.b.Size()
+	var file io.Writer = s.file
+	if ctx != context.Background() {
+		file = contextWriter{ctx: ctx, w: s.file}
+	}
+	n, err := writeTo(file, size)
+	if err != nil {
+		err = wrapErr("write", s.Name(), off, err)
+	}
+	if s.hash != nil {
+		writeTo(s.hash, n)
+	}
+	if s.merkle != nil {
+		writeTo(s.merkle, n)
+	}
+	for _, w := range s.tees {
+		if _, werr := writeTo(w, n); err == nil {
+			err = werr
+		}
+	}
+	if s.xform != nil {
+		s.b.Wrote(s.xform.flushed())
+	} else {
+		s.b.Wrote(n)
+	}
+	s.rate.wrote(n)
+	if s.replay != nil && n > 0 {
+		if rerr := s.recordWrite(off + int64(n)); err == nil {
+			err = wrapErr("write", s.replayPath, -1, rerr)
+		}
+	}
+	s.audit(AuditEvent{Kind: AuditWrite, Off: off, Len: int64(n), Err: err})
 	return n, err
 }
 
+// ReadFrom implements io.ReaderFrom. It Writes everything read from src to the Stream, using a
+// pooled buffer (see WithCopyBufferSize), until src returns io.EOF. It doesn't Close the Stream.
+func (s *Stream) ReadFrom(src io.Reader) (n int64, err error) {
+	buf := s.getBuffer()
+	defer s.putBuffer(buf)
+	for {
+		m, rerr := src.Read(*buf)
+		if m > 0 {
+			k, werr := s.Write((*buf)[:m])
+			n += int64(k)
+			if werr != nil {
+				return n, werr
+			}
+		}
+		switch {
+		case rerr == io.EOF:
+			return n, nil
+
+		case rerr != nil:
+			return n, rerr
+		}
+	}
+}
+
 // Close will close the active stream. This will cause Readers to return EOF once they have
 // read the entire stream.
 func (s *Stream) Close() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	return s.closeOnce.Do(func() (err error) {
+		s.stall.stop()
 		err = s.file.Close()
+		if s.xform != nil {
+			s.b.Wrote(s.xform.flushed())
+		}
+		if err == nil && !s.b.Canceled() {
+			err = s.finalize()
+		}
+		if s.merkle != nil && !s.b.Canceled() {
+			s.merkle.Close()
+		}
+		if err == nil && s.committed {
+			err = syncDir(s.fs, s.Name())
+		}
+		if s.statePath != "" {
+			if serr := s.closeState(); err == nil {
+				err = serr
+			}
+		}
+		if s.replay != nil {
+			if rerr := s.replay.Close(); err == nil {
+				err = rerr
+			}
+		}
+		var archive *Reader
+		if err == nil && s.archiveTo != nil && !s.b.Canceled() {
+			// taken before Close, so the File can't be auto-removed until it's archived
+			var aerr error
+			if archive, aerr = s.NextReader(); aerr != nil {
+				s.archiveDone(aerr)
+			}
+		}
 		s.b.Close()
+		if !s.b.Canceled() {
+			s.audit(AuditEvent{Kind: AuditClose, Err: err})
+		}
+		if archive != nil {
+			go s.archive(archive)
+		}
 		return err
 	})
 }
 
+// CloseWithError Closes the Stream like Close, except Readers which reach the end of the Stream
+// get err instead of io.EOF (io.EOF if err is nil), like io.PipeWriter.CloseWithError.
+// Unlike Cancel, Readers can still read everything that was written.
+// It has no effect on the error if the Stream is already Closed.
+func (s *Stream) CloseWithError(err error) error {
+	s.b.SetCloseErr(err)
+	return s.Close()
+}
+
+// CloseWithSize Closes the Stream if exactly n bytes were written to it. Otherwise, ex. when an
+// upstream download was truncated, it Cancels the Stream with a *SizeError as the cause, so Readers
+// fail instead of consuming bad data, and returns the *SizeError.
+func (s *Stream) CloseWithSize(n int64) error {
+	if size, _ := s.b.Size(); size != n {
+		err := &SizeError{Want: n, Got: size}
+		s.cancel(err)
+		return err
+	}
+	return s.Close()
+}
+
+// Commit finalizes the Stream: the File is synced to stable storage if it supports Sync (like *os.File),
+// and then the Stream is Closed, which renames the File if WithAtomicCreate or WithContentAddress was used.
+// On StdFileSystem, the directory is synced afterwards so that the File's (new) name is durable too.
+// If the sync fails, the Stream is Canceled instead so that Readers never consume a File which may be lost.
+func (s *Stream) Commit() error {
+	if !s.b.IsOpen() {
+		return s.Close()
+	}
+	if err := s.sync(); err != nil {
+		s.Cancel()
+		return err
+	}
+	return s.Close()
+}
+
+// Abort Cancels the Stream with cause and then Removes its File. Like Cancel, this call is non-blocking.
+// If cause is non-nil, Reads return an error wrapping both ErrCanceled and cause (see errors.Is).
+func (s *Stream) Abort(cause error) error {
+	err := s.cancel(cause)
+	if rerr := s.Remove(); err == nil {
+		err = rerr
+	}
+	return err
+}
+
+func (s *Stream) sync() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.committed = true
+	return syncFile(s.file)
+}
+
+// finalize renames the File after a successful Close, if an option requires it.
+func (s *Stream) finalize() error {
+	switch {
+	case s.hash != nil:
+		return s.rename(filepath.Join(filepath.Dir(s.Name()), hex.EncodeToString(s.hash.Sum(nil))))
+
+	case s.target != "":
+		return s.rename(s.target)
+	}
+	return nil
+}
+
+// discard removes a File which would have been renamed on Close, since it will never be complete.
+func (s *Stream) discard() error {
+	if s.target == "" && s.hash == nil {
+		return nil
+	}
+
+	s.nameMu.Lock()
+	defer s.nameMu.Unlock()
+	if s.discarded || s.finalName != "" {
+		return nil
+	}
+	s.discarded = true
+	err := wrapErr("remove", s.name, -1, s.fs.Remove(s.name))
+	if s.placeholder != "" {
+		if perr := s.fs.Remove(s.placeholder); err == nil {
+			err = wrapErr("remove", s.placeholder, -1, perr)
+		}
+	}
+	return err
+}
+
+func (s *Stream) rename(name string) error {
+	fs, ok := s.fs.(Renamer)
+	if !ok {
+		return ErrUnsupported
+	}
+
+	s.nameMu.Lock()
+	defer s.nameMu.Unlock()
+	if err := fs.Rename(s.name, name); err != nil {
+		return err
+	}
+	s.name, s.finalName = name, name
+	return nil
+}
+
 // SetSeekEnd is required in order to support Range Requests. Range Requests
 // require the length of a Stream to be returned by using Reader.Seek with io.SeekEnd.
 // You must set this value to the expected final length of the Stream in order for
@@ -93,9 +509,10 @@ func (s *Stream) Close() error {
 // This value can only be set once, subsequent sets will not update the SeekEnd position
 // and will return an error.
 //
-// This method currently has no other affects on the Stream and in particular
+// This method has no other affects on the Stream unless WithStrictSize is used, and in particular
 // does not prevent Writing a different amount of bytes and Closing the stream, though this
 // is undefined behavior, and this library reserves the right to define that behavior in the future.
+// CloseWithSize can be used to check the final size.
 func (s *Stream) SetSeekEnd(size int64) error {
 	return s.seekEnd.set(size)
 }
@@ -104,36 +521,283 @@ func (s *Stream) SetSeekEnd(size int64) error {
 // at which point it will delete the underlying file. NextReader() will return
 // ErrRemoving if called after Remove.
 func (s *Stream) Remove() error {
-	s.ShutdownWithErr(ErrRemoving)
-	return s.fs.Remove(s.file.Name())
+	return s.RemoveContext(context.Background())
+}
+
+// RemoveContext is like Remove, but stops waiting for the Stream and its Readers to be Closed once
+// ctx is done, returning ctx.Err() and leaving the File in place: the Stream stays shut down, and
+// Remove can be called again. If the FileSystem is a FileSystemContext, the Files are removed with ctx.
+func (s *Stream) RemoveContext(ctx context.Context) error {
+	if err := s.shutdown(ctx, ErrRemoving); err != nil {
+		return err
+	}
+
+	s.nameMu.Lock()
+	defer s.nameMu.Unlock()
+	var err error
+	if !s.discarded {
+		if err = removeContext(ctx, s.fs, s.name); err == nil {
+			s.discarded = true
+		}
+		err = wrapErr("remove", s.name, -1, err)
+	}
+	if s.statePath != "" {
+		if serr := removeContext(ctx, s.fs, s.statePath); err == nil && !os.IsNotExist(serr) {
+			err = serr
+		}
+	}
+	if s.replay != nil {
+		if rerr := removeContext(ctx, s.fs, s.replayPath); err == nil && !os.IsNotExist(rerr) {
+			err = rerr
+		}
+	}
+	return err
+}
+
+// Cause returns why the Stream ended, like context.Cause, so components which learn of the Stream
+// late don't have to Read to find out: the cause it was Canceled with (ErrStalled when WithIdleTimeout
+// timed out, ErrCanceled if there's none), the error given to CloseWithError, or the error given to
+// ShutdownWithErr (ErrRemoving by Remove). It's nil while the Stream is open, or if it was just Closed.
+func (s *Stream) Cause() error {
+	return s.b.Cause()
+}
+
+// OnClose calls fn once the Stream is Closed, or right away if it already has been, so resources
+// which depend on the Stream can be cleaned up. fn is never called if the Stream is Canceled
+// instead. fn is called synchronously by Close, so it must not block on the Stream.
+func (s *Stream) OnClose(fn func()) {
+	s.b.OnClose(fn)
+}
+
+// OnCancel calls fn with the error Reads fail with once the Stream is Canceled, or right away if it
+// already has been. fn is called synchronously by Cancel, so it must not block on the Stream.
+func (s *Stream) OnCancel(fn func(err error)) {
+	s.b.OnCancel(fn)
+}
+
+// Handles returns the number of Readers which haven't been Closed yet, and whether the Stream
+// itself is still open for writing. Remove blocks until both are released.
+func (s *Stream) Handles() (readers int, writerOpen bool) {
+	return s.b.Handles()
+}
+
+// Size returns the bytes written to the Stream so far, and true iff the size is final because the
+// Stream was Closed (false if it's still open or was Canceled), like Reader.Size but without
+// opening a Reader. It's safe to call concurrently with all other methods.
+func (s *Stream) Size() (int64, bool) {
+	return s.b.Size()
+}
+
+// IsClosed reports whether the Stream was Closed or Canceled, so it no longer accepts Writes.
+func (s *Stream) IsClosed() bool {
+	return !s.b.IsOpen()
+}
+
+// MerkleRoot returns the root of the MerkleTree of the Stream (see WithMerkleTree) and the bytes from the
+// start of the Stream it covers: its complete chunks, and all of it once the Stream is Closed. A client verifies
+// that prefix by comparing root with the Root of a Closed MerkleTree it wrote the prefix to.
+// It returns a nil root if WithMerkleTree wasn't used.
+func (s *Stream) MerkleRoot() (root []byte, size int64) {
+	if s.merkle == nil {
+		return nil, 0
+	}
+	return s.merkle.Root()
 }
 
 // ShutdownWithErr causes NextReader to stop creating new Readers and instead return err, this
 // method also blocks until all Readers and the Writer have closed.
 func (s *Stream) ShutdownWithErr(err error) {
+	s.shutdown(context.Background(), err)
+}
+
+// shutdown is ShutdownWithErr, but stops waiting for the handles once ctx is done, returning ctx.Err().
+func (s *Stream) shutdown(ctx context.Context, err error) error {
 	if err == nil {
-		return
+		return nil
 	}
 	s.b.PreventNewHandles(err) // no new readers can be created, but existing ones can finish, same with the writer
-	s.b.WaitForZeroHandles()   // wait for exiting handles to finish up
+	s.audit(AuditEvent{Kind: AuditShutdown, Err: err})
+	if s.onLeak != nil {
+		t := time.AfterFunc(s.leakAfter, s.reportLeaks)
+		defer t.Stop()
+	}
+	if s.onClosed != nil {
+		t := time.AfterFunc(s.autoClose, s.closeLeaks)
+		defer t.Stop()
+	}
+	if ctx.Done() == nil {
+		s.b.WaitForZeroHandles() // wait for exiting handles to finish up
+		return nil
+	}
+	done := make(chan struct{})
+	go func() {
+		s.b.WaitForZeroHandles()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 // Cancel signals that this Stream is forcibly ending, NextReader() will fail, existing readers will fail Reads, all Readers & Writer are Closed.
 // This call is non-blocking, and Remove() after this call is non-blocking.
+// Files which would have been renamed on Close (see WithAtomicCreate) are removed.
 func (s *Stream) Cancel() error {
-	s.b.Cancel()     // all existing reads are canceled, no new reads will occur, all readers closed
-	return s.Close() // all writes are stopped
+	return s.cancel(nil)
+}
+
+func (s *Stream) cancel(cause error) error {
+	s.b.Cancel(cause) // all existing reads are canceled, no new reads will occur, all readers closed
+	err := s.Close()  // all writes are stopped
+	s.audit(AuditEvent{Kind: AuditCancel, Err: s.b.Cause()})
+	if derr := s.discard(); err == nil {
+		err = derr
+	}
+	return err
 }
 
 // NextReader will return a concurrent-safe Reader for this stream. Each Reader will
 // see a complete and independent view of the stream, and can Read while the stream
 // is written to.
 func (s *Stream) NextReader() (*Reader, error) {
-	return s.b.NewReader(func() (*Reader, error) {
-		file, err := s.fs.Open(s.file.Name())
+	return s.nextReader(context.Background(), nil)
+}
+
+// NextReaderContext is like NextReader, but if the FileSystem of the Stream is a FileSystemContext,
+// the File of the Reader is Opened with ctx. Reads of the Reader don't use ctx, nor do the lazy Opens
+// of Readers within an FDBudget (see WithFDBudget), which happen on their reads.
+func (s *Stream) NextReaderContext(ctx context.Context) (*Reader, error) {
+	return s.nextReader(ctx, nil)
+}
+
+// NextReaderLabeled is like NextReader, but the Reader is identified by label (ex. "tenant-42/request-abc")
+// in diagnostics: its String, DebugDump and Readers, and so in leak, auto-close and lag reports.
+func (s *Stream) NextReaderLabeled(label string) (*Reader, error) {
+	return s.nextReader(context.Background(), func(r *Reader) { r.label = label })
+}
+
+// nextReader is NextReader, except setup (if non-nil) is called on the Reader before it's registered.
+func (s *Stream) nextReader(ctx context.Context, setup func(r *Reader)) (*Reader, error) {
+	r, err := s.b.NewReader(func() (*Reader, error) {
+		s.nameMu.RLock()
+		defer s.nameMu.RUnlock()
+		var file File
+		var err error
+		switch {
+		case s.share:
+			file, err = s.openShared(ctx)
+		case s.budget != nil:
+			file = s.budget.newFile(s.fs, s.Name)
+		default:
+			file, err = openContext(ctx, s.fs, s.name)
+			err = wrapErr("open", s.name, -1, err)
+		}
 		if err != nil {
 			return nil, err
 		}
-		return &Reader{file: file, s: s}, nil
+		r := &Reader{file: file, s: s, opened: time.Now()}
+		if s.onLeak != nil {
+			r.created = debug.Stack()
+		}
+		if s.readahead > 0 {
+			r.ra = newReadahead(s.readahead)
+		}
+		if len(s.rxform) > 0 {
+			r.transform(s.rxform)
+		}
+		if s.idleAfter > 0 {
+			r.idle = newIdleTimer(s.idleAfter)
+			r.idle.start(func() { r.Close() })
+		}
+		if setup != nil {
+			setup(r)
+		}
+		return r, nil
 	})
+	if err == nil {
+		s.audit(AuditEvent{Kind: AuditReaderOpened, Reader: r})
+	}
+	return r, err
+}
+
+// WaitForSize blocks until at least n bytes have been written to the Stream. It returns
+// io.ErrUnexpectedEOF if the Stream is Closed before then, or the error it was Canceled with.
+func (s *Stream) WaitForSize(n int64) error {
+	return s.b.WaitForSize(context.Background(), nil, n)
+}
+
+// WaitForSizeContext is like WaitForSize, but stops waiting once ctx is done, returning ctx.Err().
+func (s *Stream) WaitForSizeContext(ctx context.Context, n int64) error {
+	return s.b.WaitForSize(ctx, nil, n)
+}
+
+// NotifyAvailable returns a channel which receives a single value once the n bytes starting at off
+// have been written: nil, or io.ErrUnexpectedEOF if the Stream is Closed before then, or the error
+// the Stream was Canceled with. It lets callers dispatch work per chunk as a large Stream fills in,
+// without a blocked goroutine per chunk.
+func (s *Stream) NotifyAvailable(off, n int64) <-chan error {
+	return s.b.NotifyAvailable(off + n)
+}
+
+// SnapshotReader returns a Reader like NextReader, except it ends at the bytes written at the
+// time of the call, so it never blocks waiting for future Writes.
+func (s *Stream) SnapshotReader() (*Reader, error) {
+	size, _ := s.b.Size()
+	return s.nextReader(context.Background(), func(r *Reader) { r.bounded, r.limit = true, size })
+}
+
+// NextReaderWith is like NextReader, but Reads are passed through transform (ex. flate.NewReader),
+// so a Stream which is stored compressed or encrypted can be consumed decoded.
+// Reads still block until the Stream is Closed. Closing the returned ReadCloser closes
+// the transformed reader (if it's an io.Closer) and then the underlying Reader.
+func (s *Stream) NextReaderWith(transform func(io.Reader) io.Reader) (io.ReadCloser, error) {
+	r, err := s.NextReader()
+	if err != nil {
+		return nil, err
+	}
+	return &transformedReader{Reader: transform(r), r: r}, nil
+}
+
+type transformedReader struct {
+	io.Reader
+	r *Reader
+}
+
+func (t *transformedReader) Close() error {
+	var err error
+	if c, ok := t.Reader.(io.Closer); ok {
+		err = c.Close()
+	}
+	if rerr := t.r.Close(); err == nil {
+		err = rerr
+	}
+	return err
+}
+
+// CloneTo creates a new Stream named name in fs, which receives everything written to s so far
+// and then mirrors every subsequent Write, ex. to move an in-memory Stream to disk once it
+// grows too large. The clone is Closed once s is, and Canceled if s is Canceled or copying fails.
+func (s *Stream) CloneTo(name string, fs FileSystem, opts ...Option) (*Stream, error) {
+	r, err := s.NextReader()
+	if err != nil {
+		return nil, err
+	}
+	clone, err := NewStream(name, fs, opts...)
+	if err != nil {
+		r.Close()
+		return nil, err
+	}
+
+	go func() {
+		defer r.Close()
+		if _, err := io.Copy(clone, r); err != nil {
+			clone.cancel(err)
+			return
+		}
+		clone.Close()
+	}()
+	return clone, nil
 }
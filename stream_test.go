@@ -1,14 +1,36 @@
 package stream
 
 import (
+	"bufio"
 	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/binary"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
+	iofs "io/fs"
 	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"testing/fstest"
+	"testing/iotest"
 	"time"
 )
 
@@ -90,6 +112,7 @@ func GetFilesystems() []FileSystem {
 		NewMemFS(),
 		&slowFs{NewMemFS()},
 		StdFileSystem,
+		NewSegmentFS(NewMemFS(), 7),
 	}
 }
 
@@ -622,7 +645,7 @@ func testReader(f *Stream, t *testing.T) {
 }
 
 func cleanup(f *Stream, t *testing.T) {
-	if err := f.Remove(); err != nil && err != ErrUnsupported {
+	if err := f.Remove(); err != nil && !errors.Is(err, ErrUnsupported) {
 		t.Error("error while removing file: ", err)
 	}
 }
@@ -702,11 +725,11 @@ func testSeeker(t *testing.T, fs FileSystem) {
 		}
 	}
 
-	if _, err := r.Seek(0, 100); err != errWhence {
+	if _, err := r.Seek(0, 100); !errors.Is(err, errWhence) {
 		t.Errorf("Expected errWhence")
 	}
 
-	if _, err := r.Seek(-1, io.SeekStart); err != errOffset {
+	if _, err := r.Seek(-1, io.SeekStart); !errors.Is(err, errOffset) {
 		t.Errorf("Expected errOffset")
 	}
 
@@ -814,11 +837,11 @@ func testSetSeekEnd(t *testing.T, fs FileSystem) {
 		}
 	}
 
-	if _, err := r.Seek(0, 100); err != errWhence {
+	if _, err := r.Seek(0, 100); !errors.Is(err, errWhence) {
 		t.Errorf("Expected errWhence")
 	}
 
-	if _, err := r.Seek(-1, io.SeekStart); err != errOffset {
+	if _, err := r.Seek(-1, io.SeekStart); !errors.Is(err, errOffset) {
 		t.Errorf("Expected errOffset")
 	}
 
@@ -831,3 +854,4516 @@ func testSetSeekEnd(t *testing.T, fs FileSystem) {
 		t.Errorf("Wanted SeekEnd to be == SetSeekEnd(%v), but got %v", want, got)
 	}
 }
+
+func TestWriteTo(t *testing.T) {
+	for _, fs := range GetFilesystems() {
+		testWriteTo(t, fs, bytes.NewBuffer(nil))
+	}
+
+	out, err := ioutil.TempFile("", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(out.Name())
+	defer out.Close()
+	testWriteTo(t, StdFileSystem, out)
+}
+
+func testWriteTo(t *testing.T, fs FileSystem, w io.Writer) {
+	f, err := NewStream(t.Name()+".txt", fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Remove()
+	r, err := f.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	f.Write(testdata)
+	go func() {
+		<-time.After(50 * time.Millisecond)
+		f.Write(testdata)
+		f.Close()
+	}()
+
+	n, err := r.WriteTo(w)
+	if err != nil {
+		t.Error(err)
+	}
+	if want := int64(2 * len(testdata)); n != want {
+		t.Errorf("Want/got: %d/%d", want, n)
+	}
+
+	var got []byte
+	switch w := w.(type) {
+	case *bytes.Buffer:
+		got = w.Bytes()
+	case *os.File:
+		got, _ = ioutil.ReadFile(w.Name())
+	}
+	if want := bytes.Repeat(testdata, 2); !bytes.Equal(want, got) {
+		t.Errorf("Want/got: %q/%q", want, got)
+	}
+}
+
+func TestCopyWithProgress(t *testing.T) {
+	f := NewMemStream()
+	r, err := f.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	go func() {
+		for i := 0; i < 3; i++ {
+			f.Write(testdata)
+			<-time.After(10 * time.Millisecond)
+		}
+		f.Close()
+	}()
+
+	var progress []int64
+	buf := bytes.NewBuffer(nil)
+	n, err := CopyWithProgress(buf, r, func(copied int64) {
+		progress = append(progress, copied)
+	})
+	if err != nil {
+		t.Error(err)
+	}
+	if want := int64(3 * len(testdata)); n != want {
+		t.Errorf("Want/got: %d/%d", want, n)
+	}
+	if len(progress) == 0 || progress[len(progress)-1] != n {
+		t.Errorf("expected last progress report to be %d, got %v", n, progress)
+	}
+	for i := 1; i < len(progress); i++ {
+		if progress[i] <= progress[i-1] {
+			t.Errorf("expected increasing progress, got %v", progress)
+		}
+	}
+}
+
+func TestBackpressureClose(t *testing.T) {
+	f := NewMemStream(WithBackpressure(int64(len(testdata) - 1)))
+	r, err := f.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	f.Write(testdata)
+	wrote := make(chan error, 1)
+	go func() {
+		_, err := f.Write(testdata) // blocks, the Reader is behind by more than the window
+		wrote <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	closed := make(chan error, 1)
+	go func() { closed <- f.CloseWithError(nil) }()
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected Close not to wait for the Reader to catch up")
+	}
+	if err := <-wrote; err != ErrWriterClosed {
+		t.Errorf("expected the blocked Write to fail with ErrWriterClosed, got %v", err)
+	}
+	if data, _ := ioutil.ReadAll(r); !bytes.Equal(data, testdata) {
+		t.Errorf("expected only the first Write to be read, got %q", data)
+	}
+}
+
+func TestWriteDeadline(t *testing.T) {
+	f := NewMemStream(WithBackpressure(int64(len(testdata) - 1)))
+	r, err := f.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	f.Write(testdata)
+	f.SetWriteDeadline(time.Now().Add(20 * time.Millisecond))
+	// blocks, the Reader is behind by more than the window, until the deadline
+	if n, err := f.Write(testdata); n != 0 || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the Write to time out, wrote %d: %v", n, err)
+	}
+
+	f.SetWriteDeadline(time.Time{})
+	io.ReadFull(r, make([]byte, len(testdata)))
+	if _, err := f.Write(testdata); err != nil {
+		t.Errorf("expected the Write to succeed once the deadline is cleared, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := f.WriteContext(ctx, testdata); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the canceled Write to fail, got %v", err)
+	}
+}
+
+func TestBackpressure(t *testing.T) {
+	f := NewMemStream(WithBackpressure(int64(len(testdata) - 1)))
+	r, err := f.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	f.Write(testdata) // reader isn't behind yet, so this doesn't block
+
+	wrote := make(chan struct{})
+	go func() {
+		f.Write(testdata)
+		close(wrote)
+	}()
+
+	select {
+	case <-wrote:
+		t.Fatal("expected Write to block while reader is behind")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if _, err := io.ReadFull(r, make([]byte, len(testdata))); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-wrote:
+	case <-time.After(time.Second):
+		t.Fatal("expected Write to unblock once reader caught up")
+	}
+
+	// a closed reader doesn't hold back the writer
+	r.Close()
+	f.Write(testdata)
+	f.Write(testdata)
+
+	// nor does a snapshot reader which has read everything it can
+	snap, err := f.SnapshotReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snap.Close()
+	if _, err := ioutil.ReadAll(snap); err != nil {
+		t.Fatal(err)
+	}
+	wrote = make(chan struct{})
+	go func() {
+		f.Write(testdata)
+		close(wrote)
+	}()
+	select {
+	case <-wrote:
+	case <-time.After(time.Second):
+		t.Fatal("expected a finished snapshot reader not to block Write")
+	}
+	f.Close()
+}
+
+func TestLagWatermark(t *testing.T) {
+	var mu sync.Mutex
+	var events []bool
+	f := NewMemStream(WithLagWatermark(int64(len(testdata)), func(r *Reader, behind bool) {
+		mu.Lock()
+		events = append(events, behind)
+		mu.Unlock()
+	}))
+	r, err := f.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	f.Write(testdata)
+	f.Write(testdata) // now behind
+	f.Write(testdata) // still behind, no new event
+
+	if _, err := io.ReadFull(r, make([]byte, 2*len(testdata))); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if want := []bool{true, false}; fmt.Sprint(events) != fmt.Sprint(want) {
+		t.Errorf("Want/got: %v/%v", want, events)
+	}
+}
+
+func TestReadahead(t *testing.T) {
+	f, err := NewStream(t.Name()+".txt", &slowFs{NewMemFS()}, WithReadahead(len(testdata)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Remove()
+	r, err := f.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	go func() {
+		for i := 0; i < 5; i++ {
+			f.Write(testdata)
+		}
+		f.Close()
+	}()
+
+	data, err := ioutil.ReadAll(io.LimitReader(r, int64(len(testdata)+1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := append(testdata, testdata[0]); !bytes.Equal(want, data) {
+		t.Errorf("Want/got: %q/%q", want, data)
+	}
+
+	// prefetched data must be dropped after a Seek
+	if _, err := r.Seek(2, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	buf := bytes.NewBuffer(nil)
+	if _, err := io.CopyBuffer(buf, struct{ io.Reader }{r}, make([]byte, 5)); err != nil {
+		t.Fatal(err)
+	}
+	if want := bytes.Repeat(testdata, 5)[2:]; !bytes.Equal(want, buf.Bytes()) {
+		t.Errorf("Want/got: %q/%q", want, buf.Bytes())
+	}
+}
+
+func TestReadaheadCancel(t *testing.T) {
+	f := NewMemStream(WithReadahead(len(testdata)))
+	f.Write(testdata)
+	r, err := f.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectEnded := func(pending chan prefetched, after string) {
+		t.Helper()
+		select {
+		case res := <-pending:
+			if res.err == nil {
+				t.Errorf("expected the prefetch to fail after %s", after)
+			}
+		case <-time.After(time.Second):
+			t.Errorf("expected the prefetch to be canceled after %s", after)
+		}
+	}
+
+	// the prefetch of what follows waits for Writes, until the Reader moves elsewhere
+	if _, err := io.ReadFull(r, make([]byte, len(testdata))); err != nil {
+		t.Fatal(err)
+	}
+	pending := r.ra.pending
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	expectEnded(pending, "a Seek")
+	if err := r.Err(); err != nil {
+		t.Errorf("expected the canceled prefetch not to be recorded, got %v", err)
+	}
+
+	if _, err := io.ReadFull(r, make([]byte, len(testdata))); err != nil {
+		t.Fatal(err)
+	}
+	pending = r.ra.pending
+	r.Close()
+	expectEnded(pending, "Close")
+	f.Close()
+}
+
+// partialFS Opens Files whose first ReadAt reads half of p, and fails.
+type partialFS struct{ FileSystem }
+
+func (fs partialFS) Open(name string) (File, error) {
+	f, err := fs.FileSystem.Open(name)
+	return &partialFile{File: f}, err
+}
+
+type partialFile struct {
+	File
+	failed int32
+}
+
+func (f *partialFile) ReadAt(p []byte, off int64) (int, error) {
+	if atomic.CompareAndSwapInt32(&f.failed, 0, 1) {
+		n, _ := f.File.ReadAt(p[:len(p)/2], off)
+		return n, errFlaky
+	}
+	return f.File.ReadAt(p, off)
+}
+
+func TestReadaheadPartial(t *testing.T) {
+	f, err := NewStream(t.Name(), partialFS{NewMemFS()}, WithReadahead(len(testdata)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Remove()
+	f.Write(testdata)
+	f.Close()
+
+	r, err := f.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if data, err := ioutil.ReadAll(r); err != nil || !bytes.Equal(data, testdata) {
+		t.Errorf("expected the bytes read before the error to be kept, got %q, %v", data, err)
+	}
+}
+
+func TestNextReaderWith(t *testing.T) {
+	for _, fs := range GetFilesystems() {
+		testNextReaderWith(t, fs)
+	}
+}
+
+func testNextReaderWith(t *testing.T, fs FileSystem) {
+	f, err := NewStream(t.Name()+".txt", fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Remove()
+
+	r, err := f.NextReaderWith(func(r io.Reader) io.Reader { return flate.NewReader(r) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	go func() {
+		w, _ := flate.NewWriter(f, flate.BestSpeed)
+		w.Write(testdata)
+		w.Flush()
+		<-time.After(10 * time.Millisecond)
+		w.Write(testdata)
+		w.Close()
+		f.Close()
+	}()
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := bytes.Repeat(testdata, 2); !bytes.Equal(want, data) {
+		t.Errorf("Want/got: %q/%q", want, data)
+	}
+}
+
+func TestGzipFS(t *testing.T) {
+	inner := NewMemFS()
+	fs := NewGzipFS(inner, 5)
+	f, err := NewStream(t.Name()+".gz", fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Remove()
+
+	r, err := f.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	want := bytes.Repeat(testdata, 3)
+	f.Write(want[:7]) // one compressed block, the rest is pending
+
+	p := make([]byte, 4)
+	if _, err := r.ReadAt(p, 3); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(p, want[3:7]) {
+		t.Errorf("Want/got: %q/%q", want[3:7], p)
+	}
+
+	f.Write(want[7:])
+	f.Close()
+
+	if _, err := r.Seek(-10, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, want[len(want)-10:]) {
+		t.Errorf("Want/got: %q/%q", want[len(want)-10:], data)
+	}
+
+	// The stored file is plain (multi-member) gzip.
+	raw, _ := inner.Open(t.Name() + ".gz")
+	defer raw.Close()
+	gz, err := gzip.NewReader(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadAll(gz); !bytes.Equal(data, want) {
+		t.Errorf("Want/got: %q/%q", want, data)
+	}
+
+	// A new FileSystem loads the index written on Close.
+	reopened, err := NewGzipFS(inner, 5).Open(t.Name() + ".gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	if _, err := reopened.ReadAt(p, 11); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(p, want[11:15]) {
+		t.Errorf("Want/got: %q/%q", want[11:15], p)
+	}
+}
+
+// fakeZstd "compresses" into frames which just hold the raw bytes.
+type fakeZstd struct{}
+
+func (fakeZstd) EncodeAll(src, dst []byte) []byte { return append(dst, src...) }
+func (fakeZstd) DecodeAll(input, dst []byte) ([]byte, error) {
+	return append(dst, input...), nil
+}
+
+func TestZstdFS(t *testing.T) {
+	inner := NewMemFS()
+	f, err := NewStream(t.Name()+".zst", NewZstdFS(inner, 5, fakeZstd{}, fakeZstd{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Remove()
+
+	want := bytes.Repeat(testdata, 3)
+	f.Write(want)
+	f.Close()
+
+	// A new FileSystem finds the frames using the seek table.
+	r, err := NewZstdFS(inner, 5, fakeZstd{}, fakeZstd{}).Open(t.Name() + ".zst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, want) {
+		t.Errorf("Want/got: %q/%q", want, data)
+	}
+
+	p := make([]byte, 7)
+	if _, err := r.ReadAt(p, 13); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(p, want[13:20]) {
+		t.Errorf("Want/got: %q/%q", want[13:20], p)
+	}
+
+	raw, _ := inner.Open(t.Name() + ".zst")
+	defer raw.Close()
+	if size, _ := fileSize(raw); size != int64(len(want))+8+8*8+9 {
+		t.Errorf("unexpected file size %d", size)
+	}
+	if _, err := NewZstdFS(NewMemFS(), 5, fakeZstd{}, fakeZstd{}).Open("missing"); err == nil {
+		t.Error("expected error opening a missing file")
+	}
+}
+
+func TestAESCTRFS(t *testing.T) {
+	if _, err := NewAESCTRFS(NewMemFS(), []byte("short")); err == nil {
+		t.Error("expected invalid key size error")
+	}
+
+	key := bytes.Repeat([]byte{1}, 16)
+	inner := NewMemFS()
+	fs, err := NewAESCTRFS(inner, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := NewStream(t.Name(), fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Remove()
+
+	want := bytes.Repeat(testdata, 5)
+	f.Write(want[:7])
+	f.Write(want[7:])
+	f.Close()
+
+	r, err := f.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	for off := 0; off < len(want); off += 7 {
+		p := make([]byte, 5)
+		n, err := r.ReadAt(p, int64(off))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(p[:n], want[off:off+n]) {
+			t.Errorf("Want/got at %d: %q/%q", off, want[off:off+n], p[:n])
+		}
+	}
+
+	// The stored File is the nonce followed by standard AES-CTR ciphertext.
+	raw, _ := inner.Open(t.Name())
+	defer raw.Close()
+	stored, _ := ioutil.ReadAll(raw)
+	if bytes.Contains(stored, testdata) {
+		t.Error("expected stored file to be encrypted")
+	}
+	block, _ := aes.NewCipher(key)
+	plain := make([]byte, len(stored)-aes.BlockSize)
+	cipher.NewCTR(block, stored[:aes.BlockSize]).XORKeyStream(plain, stored[aes.BlockSize:])
+	if !bytes.Equal(plain, want) {
+		t.Errorf("Want/got: %q/%q", want, plain)
+	}
+}
+
+func TestContentAddress(t *testing.T) {
+	for _, fs := range GetFilesystems() {
+		if !canRename(fs) {
+			if _, err := NewStream(t.Name(), fs, WithContentAddress(sha256.New)); err != ErrUnsupported {
+				t.Errorf("expected ErrUnsupported, got %v", err)
+			}
+			continue
+		}
+		testContentAddress(t, fs)
+	}
+	testContentAddress(t, NewGzipFS(NewMemFS(), 5))
+
+	if _, err := NewStream(t.Name(), NewGzipFS(&slowFs{NewMemFS()}, 5), WithContentAddress(sha256.New)); err != ErrUnsupported {
+		t.Errorf("expected ErrUnsupported for a wrapped FileSystem which can't Rename, got %v", err)
+	}
+}
+
+func testContentAddress(t *testing.T, fs FileSystem) {
+	f, err := NewStream(t.Name()+".tmp", fs, WithContentAddress(sha256.New))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup(f, t)
+
+	f.Write(testdata)
+	if name := f.FinalName(); name != "" {
+		t.Errorf("expected no final name before Close, got %q", name)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	sum := sha256.Sum256(testdata)
+	want := hex.EncodeToString(sum[:])
+	if got := f.FinalName(); got != want {
+		t.Errorf("Want/got: %s/%s", want, got)
+	}
+	if got := f.Name(); got != want {
+		t.Errorf("Want/got: %s/%s", want, got)
+	}
+	if _, err := fs.Open(t.Name() + ".tmp"); err == nil {
+		t.Error("expected temporary name to be gone")
+	}
+
+	r, err := f.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if data, _ := ioutil.ReadAll(r); !bytes.Equal(data, testdata) {
+		t.Errorf("Want/got: %q/%q", testdata, data)
+	}
+}
+
+func TestAtomicCreate(t *testing.T) {
+	for _, fs := range GetFilesystems() {
+		if !canRename(fs) {
+			if _, err := NewStream(t.Name(), fs, WithAtomicCreate()); err != ErrUnsupported {
+				t.Errorf("expected ErrUnsupported, got %v", err)
+			}
+			continue
+		}
+		testAtomicCreate(t, fs)
+	}
+
+	fs, err := NewAESCTRFS(NewMemFS(), make([]byte, 16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testAtomicCreate(t, fs)
+}
+
+func testAtomicCreate(t *testing.T, fs FileSystem) {
+	name := t.Name() + ".txt"
+	f, err := NewStream(name, fs, WithAtomicCreate())
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(testdata)
+	if _, err := fs.Open(name); err == nil {
+		t.Error("expected File to be hidden until Close")
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := f.FinalName(); got != name {
+		t.Errorf("Want/got: %s/%s", name, got)
+	}
+	r, err := fs.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadAll(r); !bytes.Equal(data, testdata) {
+		t.Errorf("Want/got: %q/%q", testdata, data)
+	}
+	r.Close()
+	cleanup(f, t)
+
+	canceled, err := NewStream(name, fs, WithAtomicCreate())
+	if err != nil {
+		t.Fatal(err)
+	}
+	canceled.Write(testdata)
+	canceled.Cancel()
+	if _, err := fs.Open(name + ".tmp"); err == nil {
+		t.Error("expected temporary File to be removed on Cancel")
+	}
+	if _, err := fs.Open(name); err == nil {
+		t.Error("expected File to never be created after Cancel")
+	}
+	cleanup(canceled, t)
+}
+
+func TestCommit(t *testing.T) {
+	name := t.Name() + ".txt"
+	f, err := New(name, WithAtomicCreate())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup(f, t)
+	f.Write(testdata)
+	if err := f.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Commit(); err != nil {
+		t.Errorf("expected second Commit to be a no-op, got %v", err)
+	}
+	if data, err := ioutil.ReadFile(name); err != nil || !bytes.Equal(data, testdata) {
+		t.Errorf("Want/got: %q/%q (%v)", testdata, data, err)
+	}
+}
+
+func TestAbort(t *testing.T) {
+	for _, fs := range GetFilesystems() {
+		testAbort(t, fs)
+	}
+}
+
+func testAbort(t *testing.T, fs FileSystem) {
+	name := t.Name() + ".txt"
+	f, err := NewStream(name, fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := f.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(testdata)
+
+	done := make(chan error)
+	go func() { done <- f.Abort(errFail) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Abort blocked on an open Reader")
+	}
+
+	if _, err := r.Read(make([]byte, 1)); !errors.Is(err, ErrCanceled) || !errors.Is(err, errFail) {
+		t.Errorf("expected ErrCanceled caused by errFail, got %v", err)
+	}
+	if _, err := f.NextReader(); !errors.Is(err, errFail) {
+		t.Errorf("expected NextReader to fail with the cause, got %v", err)
+	}
+	if _, err := fs.Open(name); err == nil {
+		t.Error("expected File to be removed")
+	}
+}
+
+func TestRemoveOnClose(t *testing.T) {
+	for _, fs := range GetFilesystems() {
+		testRemoveOnClose(t, fs)
+	}
+}
+
+func testRemoveOnClose(t *testing.T, fs FileSystem) {
+	name := t.Name() + ".txt"
+	f, err := NewStream(name, fs, WithRemoveOnClose())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := f.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(testdata)
+	f.Close()
+
+	if _, err := fs.Open(name); err != nil {
+		t.Errorf("expected File to exist while a Reader is open, got %v", err)
+	}
+	if data, _ := ioutil.ReadAll(r); !bytes.Equal(data, testdata) {
+		t.Errorf("Want/got: %q/%q", testdata, data)
+	}
+	r.Close()
+
+	if _, err := fs.Open(name); err == nil {
+		t.Error("expected File to be removed once the last Reader Closed")
+	}
+	if _, err := f.NextReader(); err != ErrRemoving {
+		t.Errorf("expected ErrRemoving, got %v", err)
+	}
+	if err := f.Remove(); err != nil {
+		t.Errorf("expected Remove of an already removed File to succeed, got %v", err)
+	}
+
+	if !canRename(fs) {
+		return
+	}
+	f, err = NewStream(name, fs, WithRemoveOnClose(), WithAtomicCreate())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Cancel(); err != nil {
+		t.Errorf("expected Cancel to succeed, got %v", err)
+	}
+	if err := f.Remove(); err != nil {
+		t.Errorf("expected Remove to succeed, got %v", err)
+	}
+}
+
+func TestAutoRemove(t *testing.T) {
+	name := t.Name() + ".txt"
+	fs := NewMemFS()
+	f, err := NewStream(name, fs, WithAutoRemove(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(testdata)
+	f.Close()
+
+	<-time.After(25 * time.Millisecond)
+	r, err := f.NextReader() // resets the linger
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-time.After(50 * time.Millisecond)
+	r.Close()
+
+	<-time.After(25 * time.Millisecond)
+	if _, err := fs.Open(name); err != nil {
+		t.Errorf("expected File to linger after the last Reader Closed, got %v", err)
+	}
+
+	<-time.After(75 * time.Millisecond)
+	if _, err := fs.Open(name); err == nil {
+		t.Error("expected File to be removed after lingering")
+	}
+	if _, err := f.NextReader(); err != ErrRemoving {
+		t.Errorf("expected ErrRemoving, got %v", err)
+	}
+}
+
+func TestReaderIdleTimeout(t *testing.T) {
+	f := NewMemStream(WithReaderIdleTimeout(50 * time.Millisecond))
+	idle, err := f.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocked, err := f.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer blocked.Close()
+
+	read := make(chan error)
+	go func() {
+		_, err := blocked.Read(make([]byte, 1))
+		read <- err
+	}()
+
+	<-time.After(100 * time.Millisecond)
+	if _, err := idle.Read(make([]byte, 1)); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("expected idle Reader to be Closed, got %v", err)
+	}
+
+	f.Write(testdata)
+	if err := <-read; err != nil {
+		t.Errorf("expected blocked Reader to stay open, got %v", err)
+	}
+	f.Close()
+	cleanup(f, t) // blocks if idle wasn't Closed
+}
+
+func TestIdleTimeout(t *testing.T) {
+	f := NewMemStream(WithIdleTimeout(50 * time.Millisecond))
+	r, err := f.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	for i := 0; i < 3; i++ {
+		<-time.After(25 * time.Millisecond)
+		if _, err := f.Write(testdata); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := ioutil.ReadAll(r)
+	if !errors.Is(err, ErrStalled) || !errors.Is(err, ErrCanceled) {
+		t.Errorf("expected ErrStalled, got %v", err)
+	}
+	if want := bytes.Repeat(testdata, 3); !bytes.Equal(data, want) {
+		t.Errorf("Want/got: %q/%q", want, data)
+	}
+
+	closed := NewMemStream(WithIdleTimeout(10 * time.Millisecond))
+	closed.Close()
+	<-time.After(50 * time.Millisecond)
+	r, err = closed.NextReader()
+	if err != nil {
+		t.Fatalf("expected a Closed Stream to never stall, got %v", err)
+	}
+	r.Close()
+
+	if _, err := NewStream("missing/"+t.Name(), StdFileSystem, WithIdleTimeout(time.Millisecond)); err == nil {
+		t.Fatal("expected Create to fail")
+	}
+	<-time.After(20 * time.Millisecond) // the Stream must not stall without a File
+}
+
+func TestCloneTo(t *testing.T) {
+	f := NewMemStream()
+	f.Write(testdata)
+
+	fs := NewMemFS()
+	clone, err := f.CloneTo(t.Name(), fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup(clone, t)
+
+	r, err := clone.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	f.Write(testdata)
+	f.Close()
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := bytes.Repeat(testdata, 2); !bytes.Equal(data, want) {
+		t.Errorf("Want/got: %q/%q", want, data)
+	}
+
+	canceled := NewMemStream()
+	clone, err = canceled.CloneTo(t.Name()+"2", fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup(clone, t)
+	r, err = clone.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	canceled.Cancel()
+	if _, err := ioutil.ReadAll(r); !errors.Is(err, ErrCanceled) {
+		t.Errorf("expected clone to be canceled, got %v", err)
+	}
+}
+
+func TestSnapshotReader(t *testing.T) {
+	for _, fs := range GetFilesystems() {
+		testSnapshotReader(t, fs)
+	}
+}
+
+func testSnapshotReader(t *testing.T, fs FileSystem) {
+	f, err := NewStream(t.Name()+".txt", fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup(f, t)
+	defer f.Close()
+
+	f.Write(testdata)
+	r, err := f.SnapshotReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	f.Write(testdata)
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, testdata) {
+		t.Errorf("Want/got: %q/%q", testdata, data)
+	}
+	if size, final := r.Size(); size != int64(len(testdata)) || !final {
+		t.Errorf("expected final size %d, got %d, %v", len(testdata), size, final)
+	}
+	if off, err := r.Seek(-1, io.SeekEnd); err != nil || off != int64(len(testdata)-1) {
+		t.Errorf("expected SeekEnd to use the snapshot size, got %d, %v", off, err)
+	}
+	if _, err := r.ReadAt(make([]byte, 2), int64(len(testdata)-1)); err != nil {
+		t.Errorf("expected short ReadAt at the end of the snapshot, got %v", err)
+	}
+	if n, err := r.ReadAt(make([]byte, 1), int64(len(testdata))); n != 0 || err != io.EOF {
+		t.Errorf("expected EOF past the snapshot, got %d, %v", n, err)
+	}
+
+	r2, err := f.SnapshotReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r2.Close()
+	buf := bytes.NewBuffer(nil)
+	if _, err := r2.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+	if want := bytes.Repeat(testdata, 2); !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("Want/got: %q/%q", want, buf.Bytes())
+	}
+}
+
+func TestSection(t *testing.T) {
+	f := NewMemStream()
+	r, err := f.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	go func() {
+		for i := 0; i < 3; i++ {
+			f.Write(testdata)
+			<-time.After(10 * time.Millisecond)
+		}
+		f.Close()
+	}()
+
+	off, n := int64(len(testdata)-2), int64(len(testdata)+4)
+	data, err := ioutil.ReadAll(r.Section(off, n))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := bytes.Repeat(testdata, 3)[off : off+n]; !bytes.Equal(data, want) {
+		t.Errorf("Want/got: %q/%q", want, data)
+	}
+}
+
+func TestWaitForSize(t *testing.T) {
+	f := NewMemStream()
+	r, err := f.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	go func() {
+		f.Write(testdata[:3])
+		<-time.After(25 * time.Millisecond)
+		f.Write(testdata[3:])
+		f.Close()
+	}()
+
+	if err := f.WaitForSize(5); err != nil {
+		t.Fatal(err)
+	}
+	if size, _ := r.Size(); size < 5 {
+		t.Errorf("expected at least 5 bytes to be written, got %d", size)
+	}
+	if err := r.WaitAvailable(2, int64(len(testdata)-2)); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.WaitAvailable(2, int64(len(testdata))); err != io.ErrUnexpectedEOF {
+		t.Errorf("expected io.ErrUnexpectedEOF, got %v", err)
+	}
+	if err := f.WaitForSize(int64(len(testdata)) + 1); err != io.ErrUnexpectedEOF {
+		t.Errorf("expected io.ErrUnexpectedEOF, got %v", err)
+	}
+
+	canceled := NewMemStream()
+	go canceled.Cancel()
+	if err := canceled.WaitForSize(1); err != ErrCanceled {
+		t.Errorf("expected ErrCanceled, got %v", err)
+	}
+}
+
+func TestNotifyAvailable(t *testing.T) {
+	f := NewMemStream()
+	first := f.NotifyAvailable(0, 5)
+	second := f.NotifyAvailable(5, 5)
+	never := f.NotifyAvailable(int64(len(testdata)), 1)
+
+	f.Write(testdata[:7])
+	select {
+	case err := <-first:
+		if err != nil {
+			t.Error(err)
+		}
+	default:
+		t.Error("expected first range to be available")
+	}
+	select {
+	case err := <-second:
+		t.Errorf("expected second range to be pending, got %v", err)
+	default:
+	}
+
+	f.Write(testdata[7:])
+	if err := <-second; err != nil {
+		t.Error(err)
+	}
+	if err := <-f.NotifyAvailable(0, 1); err != nil {
+		t.Errorf("expected an already available range to be notified, got %v", err)
+	}
+
+	f.Close()
+	if err := <-never; err != io.ErrUnexpectedEOF {
+		t.Errorf("expected io.ErrUnexpectedEOF, got %v", err)
+	}
+
+	canceled := NewMemStream()
+	pending := canceled.NotifyAvailable(0, 1)
+	canceled.Cancel()
+	if err := <-pending; err != ErrCanceled {
+		t.Errorf("expected ErrCanceled, got %v", err)
+	}
+}
+
+func TestHandles(t *testing.T) {
+	f := NewMemStream()
+	if readers, writerOpen := f.Handles(); readers != 0 || !writerOpen {
+		t.Errorf("expected 0 readers and an open writer, got %d, %t", readers, writerOpen)
+	}
+
+	r1, _ := f.NextReader()
+	r2, _ := f.NextReader()
+	if readers, _ := f.Handles(); readers != 2 {
+		t.Errorf("expected 2 readers, got %d", readers)
+	}
+
+	f.Close()
+	r1.Close()
+	if readers, writerOpen := f.Handles(); readers != 1 || writerOpen {
+		t.Errorf("expected 1 reader and a closed writer, got %d, %t", readers, writerOpen)
+	}
+
+	r2.Close()
+	if readers, writerOpen := f.Handles(); readers != 0 || writerOpen {
+		t.Errorf("expected no handles, got %d, %t", readers, writerOpen)
+	}
+}
+
+func TestStdRemoveWhileOpen(t *testing.T) {
+	name := t.Name() + ".txt"
+	w, err := StdFileSystem.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	r, err := StdFileSystem.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if err := StdFileSystem.Remove(name); err != nil {
+		t.Fatalf("expected Remove to succeed with open Files, got %v", err)
+	}
+
+	w.Write(testdata)
+	buf := make([]byte, len(testdata))
+	if _, err := r.ReadAt(buf, 0); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf, testdata) {
+		t.Errorf("expected %q, got %q", testdata, buf)
+	}
+}
+
+func TestAttach(t *testing.T) {
+	for _, fs := range []FileSystem{StdFileSystem, NewMemFS()} {
+		testAttach(t, fs)
+	}
+}
+
+func TestFollowFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "app.log")
+	log, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+
+	f, err := FollowFile(name, StdFileSystem, WithPollInterval(time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := f.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	go log.Write(testdata[:5])
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(r, buf); err != nil || string(buf) != string(testdata[:5]) {
+		t.Fatalf("expected the appended data, got %q, %v", buf, err)
+	}
+	log.Write(testdata[5:])
+	if err := r.WaitAvailable(0, int64(len(testdata))); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := r.ReadAt(buf, 6); n != 5 || string(buf) != "world" {
+		t.Errorf("unexpected ReadAt %d, %v: %q", n, err, buf)
+	}
+
+	f.Close()
+	rest, err := ioutil.ReadAll(r)
+	if err != nil || !bytes.Equal(rest, testdata[5:]) {
+		t.Errorf("expected the rest of the data then EOF once Closed, got %q, %v", rest, err)
+	}
+}
+
+func testAttach(t *testing.T, fs FileSystem) {
+	name := t.Name() + ".txt"
+	w, err := NewStream(name, fs, WithStateFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Remove()
+
+	f, err := Attach(name, fs, WithPollInterval(time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write(testdata); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("expected ErrUnsupported, got %v", err)
+	}
+	r, err := f.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	go func() {
+		w.Write(testdata[:5])
+		time.Sleep(10 * time.Millisecond)
+		w.Write(testdata[5:])
+		w.Close()
+	}()
+
+	buf, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf, testdata) {
+		t.Errorf("expected %q, got %q", testdata, buf)
+	}
+	if _, err := f.Write(testdata); err != ErrWriterClosed {
+		t.Errorf("expected ErrWriterClosed, got %v", err)
+	}
+
+	canceled, err := NewStream(name+".canceled", fs, WithStateFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer canceled.Remove()
+	f, err = Attach(name+".canceled", fs, WithPollInterval(time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err = f.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	canceled.Cancel()
+	if _, err := r.Read(make([]byte, 1)); err != ErrCanceled {
+		t.Errorf("expected ErrCanceled, got %v", err)
+	}
+}
+
+// countingFs counts the ReadAt calls on the Files it Opens.
+type countingFs struct {
+	FileSystem
+	reads int64
+}
+type countingFile struct {
+	File
+	reads *int64
+}
+
+func (fs *countingFs) Open(name string) (File, error) {
+	f, err := fs.FileSystem.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return countingFile{File: f, reads: &fs.reads}, nil
+}
+
+func (f countingFile) ReadAt(p []byte, off int64) (int, error) {
+	atomic.AddInt64(f.reads, 1)
+	return f.File.ReadAt(p, off)
+}
+
+// prefetchCheck fails if the next chunk isn't being read while a chunk is written.
+type prefetchCheck struct {
+	t      *testing.T
+	fs     *countingFs
+	chunks int64
+}
+
+func (w *prefetchCheck) Write(p []byte) (int, error) {
+	w.chunks++
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt64(&w.fs.reads) <= w.chunks {
+		if time.Now().After(deadline) {
+			w.t.Errorf("expected chunk %d to be prefetched while chunk %d is written", w.chunks+1, w.chunks)
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return len(p), nil
+}
+
+func TestReadaheadWriteTo(t *testing.T) {
+	fs := &countingFs{FileSystem: NewMemFS()}
+	f, err := NewStream(t.Name()+".txt", fs, WithReadahead(len(testdata)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Remove()
+	for i := 0; i < 3; i++ {
+		f.Write(testdata)
+	}
+	f.Close()
+
+	r, err := f.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	w := &prefetchCheck{t: t, fs: fs}
+	if n, err := io.Copy(w, r); err != nil || n != int64(3*len(testdata)) {
+		t.Errorf("expected to copy %d bytes, got %d, %v", 3*len(testdata), n, err)
+	}
+}
+
+// syncFs counts the Sync calls on the Files it Creates.
+type syncFs struct {
+	FileSystem
+	syncs int64
+}
+type syncingFile struct {
+	File
+	syncs *int64
+}
+
+func (fs *syncFs) Create(name string) (File, error) {
+	f, err := fs.FileSystem.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	return syncingFile{File: f, syncs: &fs.syncs}, nil
+}
+
+func (f syncingFile) Sync() error {
+	atomic.AddInt64(f.syncs, 1)
+	return nil
+}
+
+func TestCommitWrappedFS(t *testing.T) {
+	key := make([]byte, 16)
+	for _, wrap := range []func(FileSystem) FileSystem{
+		func(fs FileSystem) FileSystem { return NewGzipFS(fs, 5) },
+		func(fs FileSystem) FileSystem { return NewZstdFS(fs, 5, fakeZstd{}, fakeZstd{}) },
+		func(fs FileSystem) FileSystem {
+			fs, err := NewAESCTRFS(fs, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return fs
+		},
+	} {
+		inner := &syncFs{FileSystem: NewMemFS()}
+		f, err := NewStream(t.Name(), wrap(inner))
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write(testdata)
+		if err := f.Commit(); err != nil {
+			t.Fatal(err)
+		}
+		if inner.syncs == 0 {
+			t.Errorf("expected Commit to sync the File through %T", f.fs)
+		}
+
+		r, err := f.NextReader()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data, _ := ioutil.ReadAll(r); !bytes.Equal(data, testdata) {
+			t.Errorf("Want/got: %q/%q", testdata, data)
+		}
+		r.Close()
+	}
+}
+
+func TestServeStream(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	l, err := net.Listen("unix", filepath.Join(dir, "stream.sock"))
+	if err != nil {
+		t.Skip(err)
+	}
+	defer l.Close()
+
+	f := NewMemStream()
+	go ServeStream(l, f)
+
+	r, err := DialStream("unix", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	go func() {
+		f.Write(testdata[:5])
+		time.Sleep(10 * time.Millisecond)
+		f.Write(testdata[5:])
+		f.Close()
+	}()
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, testdata) {
+		t.Errorf("Want/got: %q/%q", testdata, data)
+	}
+
+	buf := make([]byte, 5)
+	if _, err := r.ReadAt(buf, 6); err != nil || !bytes.Equal(buf, testdata[6:11]) {
+		t.Errorf("Want/got: %q/%q (%v)", testdata[6:11], buf, err)
+	}
+	if _, err := r.ReadAt(buf, int64(len(testdata))-2); err != io.EOF {
+		t.Errorf("expected io.EOF reading past the end, got %v", err)
+	}
+
+	canceled := NewMemStream()
+	l2, err := net.Listen("unix", filepath.Join(dir, "canceled.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l2.Close()
+	go ServeStream(l2, canceled)
+	r2, err := DialStream("unix", l2.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r2.Close()
+	go canceled.Cancel()
+	if _, err := r2.Read(make([]byte, 1)); err != ErrCanceled {
+		t.Errorf("expected ErrCanceled, got %v", err)
+	}
+}
+
+func TestServeStreamEmptyRequest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	l, err := net.Listen("unix", filepath.Join(dir, "stream.sock"))
+	if err != nil {
+		t.Skip(err)
+	}
+	defer l.Close()
+
+	f := NewMemStream()
+	f.Write(testdata)
+	defer f.Close()
+	go ServeStream(l, f)
+
+	conn, err := net.Dial("unix", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(time.Second))
+	if _, err := conn.Write(make([]byte, 12)); err != nil { // offset 0, length 0
+		t.Fatal(err)
+	}
+	var resp [5]byte
+	if _, err := io.ReadFull(conn, resp[:]); err != nil {
+		t.Fatalf("expected a response to an empty request, got %v", err)
+	}
+	if resp != [5]byte{statusOK} {
+		t.Errorf("expected an empty OK response, got %v", resp)
+	}
+}
+
+func TestServeStreamDisconnect(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	l, err := net.Listen("unix", filepath.Join(dir, "stream.sock"))
+	if err != nil {
+		t.Skip(err)
+	}
+	defer l.Close()
+
+	f, err := NewStream(t.Name(), NewMemFS())
+	if err != nil {
+		t.Fatal(err)
+	}
+	go ServeStream(l, f)
+
+	r, err := DialStream("unix", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	go r.ReadAt(make([]byte, 5), 0) // blocks, nothing is written yet
+	for readers, _ := f.Handles(); readers == 0; readers, _ = f.Handles() {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	r.Close()
+
+	// the Stream is still open, so only the disconnect can release the server's Reader
+	deadline := time.Now().Add(time.Second)
+	for readers, _ := f.Handles(); readers > 0; readers, _ = f.Handles() {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the server's Reader to be Closed once its client disconnected")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	f.Close()
+	if err := f.Remove(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNewTempStream(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	f, name, err := NewTempStream(dir, "cache-*.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Remove()
+	if filepath.Dir(name) != dir || !strings.HasPrefix(filepath.Base(name), "cache-") || !strings.HasSuffix(name, ".txt") {
+		t.Errorf("unexpected name %q", name)
+	}
+	if f.Name() != name {
+		t.Errorf("Want/got: %s/%s", name, f.Name())
+	}
+
+	f2, name2, err := NewTempStream(dir, "cache-*.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f2.Remove()
+	defer f2.Close()
+	if name2 == name {
+		t.Errorf("expected unique names, got %q twice", name)
+	}
+
+	f.Write(testdata)
+	f.Close()
+	if data, err := ioutil.ReadFile(name); err != nil || !bytes.Equal(data, testdata) {
+		t.Errorf("Want/got: %q/%q (%v)", testdata, data, err)
+	}
+
+	// with WithAtomicCreate, the File reserving the name is replaced on Close, or removed on Cancel
+	for _, cancel := range []bool{false, true} {
+		f, name, err := NewTempStream(dir, "atomic-*.txt", WithAtomicCreate())
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write(testdata)
+		if cancel {
+			if err := f.Cancel(); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := os.Stat(name); !os.IsNotExist(err) {
+				t.Errorf("expected the placeholder to be removed on Cancel, got %v", err)
+			}
+			continue
+		}
+		f.Close()
+		if data, err := ioutil.ReadFile(name); err != nil || !bytes.Equal(data, testdata) {
+			t.Errorf("Want/got: %q/%q (%v)", testdata, data, err)
+		}
+		f.Remove()
+	}
+	if matches, _ := filepath.Glob(filepath.Join(dir, "atomic-*")); len(matches) != 0 {
+		t.Errorf("expected no Files left behind, got %q", matches)
+	}
+}
+
+func TestReaderStat(t *testing.T) {
+	f, err := NewStream(filepath.Join(os.TempDir(), t.Name()+".txt"), NewMemFS())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Remove()
+	defer f.Close()
+	r, err := f.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	var file iofs.File = r
+	f.Write(testdata)
+	info, err := file.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Name() != t.Name()+".txt" || info.Size() != int64(len(testdata)) || info.IsDir() || info.Mode() != 0444 {
+		t.Errorf("unexpected FileInfo %q, %d, %t, %v", info.Name(), info.Size(), info.IsDir(), info.Mode())
+	}
+}
+
+func TestReaderOffset(t *testing.T) {
+	f := NewMemStream()
+	f.Write(testdata)
+	f.Close()
+	r, err := f.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if off := r.Offset(); off != 0 {
+		t.Errorf("expected offset 0, got %d", off)
+	}
+	r.Read(make([]byte, 6))
+	if off := r.Offset(); off != 6 {
+		t.Errorf("expected offset 6 after Read, got %d", off)
+	}
+	r.ReadAt(make([]byte, 6), 0)
+	if off := r.Offset(); off != 6 {
+		t.Errorf("expected ReadAt to keep offset 6, got %d", off)
+	}
+	r.Seek(-2, io.SeekEnd)
+	if off := r.Offset(); off != int64(len(testdata))-2 {
+		t.Errorf("expected offset %d after Seek, got %d", len(testdata)-2, off)
+	}
+	r.Rewind()
+	if off := r.Offset(); off != 0 {
+		t.Errorf("expected offset 0 after Rewind, got %d", off)
+	}
+}
+
+func TestReaderRemaining(t *testing.T) {
+	f := NewMemStream()
+	defer f.Close()
+	r, err := f.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	check := func(when string, want int64, wantKnown bool) {
+		t.Helper()
+		if n, known := r.Remaining(); n != want || known != wantKnown {
+			t.Errorf("%s: expected Remaining %d, %t, got %d, %t", when, want, wantKnown, n, known)
+		}
+	}
+	f.Write(testdata)
+	check("open", int64(len(testdata)), false)
+	r.Read(make([]byte, 6))
+	check("read", int64(len(testdata))-6, false)
+
+	f.SetSeekEnd(2 * int64(len(testdata)))
+	check("expected size", 2*int64(len(testdata))-6, true)
+
+	f.Write(testdata[:1])
+	f.Close()
+	check("closed", int64(len(testdata))-5, true)
+}
+
+func TestStreamSize(t *testing.T) {
+	f := NewMemStream()
+	if size, final := f.Size(); size != 0 || final || f.IsClosed() {
+		t.Errorf("expected an empty open Stream, got %d, %t, closed %t", size, final, f.IsClosed())
+	}
+	f.Write(testdata)
+	if size, final := f.Size(); size != int64(len(testdata)) || final {
+		t.Errorf("expected size %d, not final, got %d, %t", len(testdata), size, final)
+	}
+	f.Close()
+	if size, final := f.Size(); size != int64(len(testdata)) || !final || !f.IsClosed() {
+		t.Errorf("expected final size %d, got %d, %t, closed %t", len(testdata), size, final, f.IsClosed())
+	}
+
+	c := NewMemStream()
+	c.Write(testdata)
+	c.Cancel()
+	if _, final := c.Size(); final || !c.IsClosed() {
+		t.Errorf("expected a Canceled Stream to be closed with no final size, got %t, %t", final, c.IsClosed())
+	}
+}
+
+func TestStreamFS(t *testing.T) {
+	done, inFlight := NewMemStream(), NewMemStream()
+	done.Write(testdata)
+	done.Close()
+	inFlight.Write(testdata)
+	defer inFlight.Close()
+	streams := map[string]*Stream{"done.txt": done, "in-flight.txt": inFlight}
+	lookup := func(name string) (*Stream, bool) {
+		s, ok := streams[name]
+		return s, ok
+	}
+
+	completed := NewStreamFS(lookup, false)
+	if data, err := iofs.ReadFile(completed, "done.txt"); err != nil || !bytes.Equal(data, testdata) {
+		t.Errorf("Want/got: %q/%q (%v)", testdata, data, err)
+	}
+	for _, name := range []string{"in-flight.txt", "missing.txt"} {
+		if _, err := completed.Open(name); !errors.Is(err, iofs.ErrNotExist) {
+			t.Errorf("expected %s not to exist, got %v", name, err)
+		}
+	}
+	if _, err := completed.Open("../done.txt"); !errors.Is(err, iofs.ErrInvalid) {
+		t.Errorf("expected an invalid path, got %v", err)
+	}
+
+	all := NewStreamFS(lookup, true)
+	f, err := all.Open("in-flight.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	buf := make([]byte, len(testdata))
+	if _, err := io.ReadFull(f, buf); err != nil || !bytes.Equal(buf, testdata) {
+		t.Errorf("Want/got: %q/%q (%v)", testdata, buf, err)
+	}
+}
+
+func TestMemFSView(t *testing.T) {
+	fs := NewMemFS()
+	for _, name := range []string{"a.txt", "dir/b.txt", "dir/sub/c.txt", "../invalid.txt"} {
+		f, err := fs.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write(testdata)
+		f.Close()
+	}
+
+	view, err := MemFSView(fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fstest.TestFS(view, "a.txt", "dir/b.txt", "dir/sub/c.txt"); err != nil {
+		t.Error(err)
+	}
+	if _, err := MemFSView(StdFileSystem); err != ErrUnsupported {
+		t.Errorf("expected ErrUnsupported, got %v", err)
+	}
+}
+
+func TestWriteTee(t *testing.T) {
+	h := sha256.New()
+	archive := bytes.NewBuffer(nil)
+	f := NewMemStream(WithWriteTee(h, archive))
+	f.Write(testdata[:5])
+	f.Write(testdata[5:])
+	f.Close()
+
+	if !bytes.Equal(archive.Bytes(), testdata) {
+		t.Errorf("Want/got: %q/%q", testdata, archive.Bytes())
+	}
+	if sum := sha256.Sum256(testdata); !bytes.Equal(h.Sum(nil), sum[:]) {
+		t.Errorf("expected the hash of the Stream")
+	}
+
+	failing := NewMemStream(WithWriteTee(badFile{}))
+	if n, err := failing.Write(testdata); n != len(testdata) || err != errFail {
+		t.Errorf("expected %d, errFail, got %d, %v", len(testdata), n, err)
+	}
+	failing.Close()
+}
+
+// chunkRecorder records the sizes of the Writes to it.
+type chunkRecorder struct{ sizes []int }
+
+func (c *chunkRecorder) Write(p []byte) (int, error) {
+	c.sizes = append(c.sizes, len(p))
+	return len(p), nil
+}
+
+func TestCopyBufferSize(t *testing.T) {
+	chunks := &chunkRecorder{}
+	f := NewMemStream(WithCopyBufferSize(5), WithWriteTee(chunks))
+	n, err := f.ReadFrom(bytes.NewReader(testdata))
+	if err != nil || n != int64(len(testdata)) {
+		t.Fatalf("expected %d, nil, got %d, %v", len(testdata), n, err)
+	}
+	f.Close()
+	for _, size := range chunks.sizes {
+		if size > 5 {
+			t.Errorf("expected ReadFrom to Write at most 5 bytes at a time, got %d", size)
+		}
+	}
+
+	r, err := f.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	out := &chunkRecorder{}
+	if n, err := r.WriteTo(out); err != nil || n != int64(len(testdata)) {
+		t.Fatalf("expected %d, nil, got %d, %v", len(testdata), n, err)
+	}
+	for _, size := range out.sizes {
+		if size > 5 {
+			t.Errorf("expected WriteTo to Write at most 5 bytes at a time, got %d", size)
+		}
+	}
+}
+
+// openCounter counts the Files Opened, and how many are still open.
+type openCounter struct {
+	FileSystem
+	opens, open int64
+}
+type countedFile struct {
+	File
+	fs *openCounter
+}
+
+func (fs *openCounter) Open(name string) (File, error) {
+	f, err := fs.FileSystem.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	atomic.AddInt64(&fs.opens, 1)
+	atomic.AddInt64(&fs.open, 1)
+	return &countedFile{File: f, fs: fs}, nil
+}
+
+func (f *countedFile) Close() error {
+	atomic.AddInt64(&f.fs.open, -1)
+	return f.File.Close()
+}
+
+func TestSharedFile(t *testing.T) {
+	for _, inner := range GetFilesystems() {
+		fs := &openCounter{FileSystem: inner}
+		f, err := NewStream(t.Name()+".txt", fs, WithSharedFile())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var rs []*Reader
+		for i := 0; i < 3; i++ {
+			r, err := f.NextReader()
+			if err != nil {
+				t.Fatal(err)
+			}
+			rs = append(rs, r)
+		}
+		if fs.opens != 1 {
+			t.Errorf("expected a single Open, got %d", fs.opens)
+		}
+
+		go func() {
+			f.Write(testdata)
+			f.Close()
+		}()
+		var wg sync.WaitGroup
+		for _, r := range rs {
+			wg.Add(1)
+			go func(r *Reader) {
+				defer wg.Done()
+				if data, err := ioutil.ReadAll(r); err != nil || !bytes.Equal(data, testdata) {
+					t.Errorf("Want/got: %q/%q (%v)", testdata, data, err)
+				}
+			}(r)
+		}
+		wg.Wait()
+
+		rs[0].Close()
+		rs[1].Close()
+		if open := atomic.LoadInt64(&fs.open); open != 1 {
+			t.Errorf("expected the shared File to stay open, got %d open", open)
+		}
+		rs[2].Close()
+		if open := atomic.LoadInt64(&fs.open); open != 0 {
+			t.Errorf("expected the shared File to be Closed, got %d open", open)
+		}
+		f.Remove()
+	}
+}
+
+func TestFDBudget(t *testing.T) {
+	budget := NewFDBudget(2)
+	fs := &openCounter{FileSystem: NewMemFS()}
+	f, err := NewStream(t.Name()+".txt", fs, WithFDBudget(budget))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Remove()
+
+	var rs []*Reader
+	for i := 0; i < 5; i++ {
+		r, err := f.NextReader()
+		if err != nil {
+			t.Fatal(err)
+		}
+		rs = append(rs, r)
+	}
+	if fs.opens != 0 {
+		t.Errorf("expected Readers to Open lazily, got %d Opens", fs.opens)
+	}
+
+	go func() {
+		f.Write(testdata)
+		f.Close()
+	}()
+	var wg sync.WaitGroup
+	for _, r := range rs {
+		wg.Add(1)
+		go func(r *Reader) {
+			defer wg.Done()
+			if data, err := ioutil.ReadAll(r); err != nil || !bytes.Equal(data, testdata) {
+				t.Errorf("Want/got: %q/%q (%v)", testdata, data, err)
+			}
+			if open := budget.Open(); open > 2 {
+				t.Errorf("expected at most 2 open Files, got %d", open)
+			}
+		}(r)
+	}
+	wg.Wait()
+	if open := atomic.LoadInt64(&fs.open); open > 2 {
+		t.Errorf("expected at most 2 open Files, got %d", open)
+	}
+
+	// a Reader whose File was reclaimed reopens it
+	for _, r := range rs {
+		if _, err := r.Seek(0, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		if data, err := ioutil.ReadAll(r); err != nil || !bytes.Equal(data, testdata) {
+			t.Errorf("Want/got: %q/%q (%v)", testdata, data, err)
+		}
+	}
+	if fs.opens <= 2 {
+		t.Errorf("expected reclaimed Files to be reopened, got %d Opens", fs.opens)
+	}
+
+	for _, r := range rs {
+		r.Close()
+	}
+	if open := budget.Open(); open != 0 {
+		t.Errorf("expected no open Files, got %d", open)
+	}
+}
+
+func TestRewind(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithReadahead(4)}} {
+		fs := &openCounter{FileSystem: NewMemFS()}
+		f, err := NewStream(t.Name()+".txt", fs, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write(testdata)
+		f.Close()
+		r, err := f.NextReader()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := io.ReadFull(r, make([]byte, 5)); err != nil {
+			t.Fatal(err)
+		}
+		r.Rewind()
+		if data, err := ioutil.ReadAll(r); err != nil || !bytes.Equal(data, testdata) {
+			t.Errorf("Want/got: %q/%q (%v)", testdata, data, err)
+		}
+		if fs.opens != 1 {
+			t.Errorf("expected Rewind not to reopen the File, got %d Opens", fs.opens)
+		}
+		r.Close()
+		f.Remove()
+	}
+}
+
+func TestArchive(t *testing.T) {
+	archive := NewMemFS()
+	done := make(chan error, 1)
+	f, err := NewStream(t.Name()+".txt", NewMemFS(), WithArchive(archive, func(err error) { done <- err }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(testdata)
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Remove(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := archive.Open(t.Name() + ".txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if data, _ := ioutil.ReadAll(r); !bytes.Equal(data, testdata) {
+		t.Errorf("Want/got: %q/%q", testdata, data)
+	}
+
+	canceled, err := NewStream(t.Name()+".canceled", NewMemFS(), WithArchive(archive, func(err error) { done <- err }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	canceled.Cancel()
+	select {
+	case err := <-done:
+		t.Errorf("expected a Canceled Stream not to be archived, got %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestOnCloseOnCancel(t *testing.T) {
+	var closes, cancels []error
+	onClose := func() { closes = append(closes, nil) }
+	onCancel := func(err error) { cancels = append(cancels, err) }
+
+	f := NewMemStream()
+	f.OnClose(onClose)
+	f.OnCancel(onCancel)
+	f.Close()
+	f.Close()
+	f.OnClose(onClose) // already Closed
+	if len(closes) != 2 || len(cancels) != 0 {
+		t.Errorf("expected 2 close and 0 cancel calls, got %d and %d", len(closes), len(cancels))
+	}
+
+	closes, cancels = nil, nil
+	canceled := NewMemStream()
+	canceled.OnClose(onClose)
+	canceled.OnCancel(onCancel)
+	canceled.Abort(errFail)
+	canceled.Cancel()
+	canceled.OnClose(onClose)   // never Closed
+	canceled.OnCancel(onCancel) // already Canceled
+	if len(closes) != 0 || len(cancels) != 2 {
+		t.Fatalf("expected 0 close and 2 cancel calls, got %d and %d", len(closes), len(cancels))
+	}
+	for _, err := range cancels {
+		if !errors.Is(err, ErrCanceled) || !errors.Is(err, errFail) {
+			t.Errorf("expected the cancel error, got %v", err)
+		}
+	}
+}
+
+func TestCloseWithError(t *testing.T) {
+	f, err := NewStream(t.Name()+".txt", StdFileSystem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Remove()
+	r, err := f.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	r2, err := f.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r2.Close()
+
+	go func() {
+		f.Write(testdata)
+		f.CloseWithError(errFail)
+	}()
+
+	data, err := ioutil.ReadAll(r)
+	if err != errFail {
+		t.Errorf("expected errFail, got %v", err)
+	}
+	if !bytes.Equal(data, testdata) {
+		t.Errorf("Want/got: %q/%q", testdata, data)
+	}
+
+	out, err := ioutil.TempFile("", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(out.Name())
+	defer out.Close()
+	if n, err := r2.WriteTo(out); err != errFail || n != int64(len(testdata)) {
+		t.Errorf("expected %d, errFail, got %d, %v", len(testdata), n, err)
+	}
+
+	if size, err := r.Seek(0, io.SeekEnd); err != nil || size != int64(len(testdata)) {
+		t.Errorf("expected Seek to the end to work, got %d, %v", size, err)
+	}
+}
+
+func TestReaderErr(t *testing.T) {
+	f := NewMemStream()
+	r, err := f.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if err := r.Err(); err != nil {
+		t.Errorf("expected no error before reading, got %v", err)
+	}
+	f.Write(testdata)
+	f.Close()
+	ioutil.ReadAll(r)
+	if err := r.Err(); err != io.EOF {
+		t.Errorf("expected io.EOF, got %v", err)
+	}
+
+	canceled := NewMemStream()
+	r, err = canceled.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	canceled.Abort(errFail)
+	r.Read(make([]byte, 1))
+	if err := r.Err(); !errors.Is(err, ErrCanceled) || !errors.Is(err, errFail) {
+		t.Errorf("expected the cancel error, got %v", err)
+	}
+}
+
+func TestErrWriterClosed(t *testing.T) {
+	for _, fs := range append(GetFilesystems(), &badFs{}) {
+		f, err := NewStream(t.Name()+".txt", fs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+		if _, err := f.Write(testdata); err != ErrWriterClosed {
+			t.Errorf("expected ErrWriterClosed after Close, got %v", err)
+		}
+		f.Remove()
+	}
+
+	f := NewMemStream()
+	f.Cancel()
+	if _, err := f.Write(testdata); err != ErrWriterClosed {
+		t.Errorf("expected ErrWriterClosed after Cancel, got %v", err)
+	}
+}
+
+func TestError(t *testing.T) {
+	f, err := NewStream(t.Name()+".txt", NewMemFS())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Remove()
+	defer f.Close()
+	f.Write(testdata)
+
+	r, err := f.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var serr *Error
+	if _, err := r.Seek(-1, io.SeekStart); !errors.As(err, &serr) {
+		t.Fatalf("expected an *Error, got %v", err)
+	}
+	if serr.Op != "seek" || serr.Name != f.Name() || serr.Off != -1 || serr.Err != errOffset {
+		t.Errorf("unexpected Error: %#v", serr)
+	}
+
+	r.Close()
+	if _, err := r.ReadAt(make([]byte, 1), 2); !errors.As(err, &serr) {
+		t.Fatalf("expected an *Error, got %v", err)
+	}
+	if serr.Op != "read" || serr.Off != 2 || !errors.Is(serr, os.ErrClosed) {
+		t.Errorf("unexpected Error: %#v", serr)
+	}
+}
+
+func TestMemFSMaxFileSize(t *testing.T) {
+	f, err := NewStream(t.Name()+".txt", NewMemFS(MemFSMaxFileSize(5)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Remove()
+
+	if n, err := f.Write(testdata[:3]); n != 3 || err != nil {
+		t.Fatalf("unexpected Write: %d, %v", n, err)
+	}
+	if n, err := f.Write(testdata[3:]); n != 2 || !errors.Is(err, ErrFileTooLarge) {
+		t.Errorf("expected 2 bytes and ErrFileTooLarge, got %d, %v", n, err)
+	}
+	f.Close()
+
+	r, err := f.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, testdata[:5]) {
+		t.Errorf("Want/got: %q/%q", testdata[:5], data)
+	}
+}
+
+func TestMemFSChunks(t *testing.T) {
+	f, err := NewMemFS().Create(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := bytes.Repeat(testdata, 3*memChunkSize/len(testdata)+1)
+	for p := want; len(p) > 0; {
+		n := 1000
+		if n > len(p) {
+			n = len(p)
+		}
+		f.Write(p[:n])
+		p = p[n:]
+	}
+	f.Close()
+
+	for _, off := range []int64{0, memChunkSize - 3, 2*memChunkSize - 50} {
+		got := make([]byte, memChunkSize+10)
+		n, err := f.ReadAt(got, off)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got[:n], want[off:off+int64(n)]) {
+			t.Errorf("unequal ReadAt at %d", off)
+		}
+	}
+
+	got := make([]byte, 10)
+	off := int64(len(want) - 4)
+	if n, err := f.ReadAt(got, off); n != 4 || err != io.EOF || !bytes.Equal(got[:n], want[off:]) {
+		t.Errorf("expected the last 4 bytes and io.EOF, got %d, %v", n, err)
+	}
+}
+
+func TestMemFSRecycle(t *testing.T) {
+	fs := NewMemFS()
+	f, err := fs.Create(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(testdata)
+	f.Close()
+
+	r, err := fs.Open(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs.Remove(t.Name())
+
+	// the chunks are still in use by r, so another File must not get them.
+	g, err := fs.Create(t.Name() + "2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.Write(bytes.Repeat([]byte{'x'}, len(testdata)))
+	defer fs.Remove(t.Name() + "2")
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, testdata) {
+		t.Errorf("Want/got: %q/%q", testdata, data)
+	}
+	r.Close()
+
+	if _, err := f.ReadAt(make([]byte, 1), 0); err != io.EOF {
+		t.Errorf("expected a Removed File to be empty once its Readers are Closed, got %v", err)
+	}
+}
+
+func TestMemFSRead(t *testing.T) {
+	fs := NewMemFS()
+	f, err := fs.Create(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.Remove(t.Name())
+	want := bytes.Repeat(testdata, memChunkSize/len(testdata)+1)
+	f.Write(want[:10])
+
+	r, err := fs.Open(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if data, err := ioutil.ReadAll(r); err != nil || !bytes.Equal(data, want[:10]) {
+		t.Errorf("expected the data written so far, got %q, %v", data, err)
+	}
+	if n, err := r.Read(nil); n != 0 || err != nil {
+		t.Errorf("expected an empty Read to succeed, got %d, %v", n, err)
+	}
+	// the writer is still open: io.EOF at the end of the data so far, then Reads resume after Writes
+	if n, err := r.Read(make([]byte, 1)); n != 0 || err != io.EOF {
+		t.Errorf("expected io.EOF while the writer is open, got %d, %v", n, err)
+	}
+
+	f.Write(want[10:])
+	f.Close()
+	if data, err := ioutil.ReadAll(r); err != nil || !bytes.Equal(data, want[10:]) {
+		t.Errorf("expected the rest of the data, got %q, %v", data, err)
+	}
+	if n, err := r.Read(make([]byte, 1)); n != 0 || err != io.EOF {
+		t.Errorf("expected io.EOF once the writer is Closed, got %d, %v", n, err)
+	}
+	if n, err := r.ReadAt(make([]byte, 1), int64(len(want))); n != 0 || err != io.EOF {
+		t.Errorf("expected ReadAt to agree with Read, got %d, %v", n, err)
+	}
+
+	r2, err := fs.Open(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r2.Close()
+	if err := iotest.TestReader(r2, want); err != nil {
+		t.Error(err)
+	}
+}
+
+type int64Codec struct{}
+
+func (int64Codec) NewEncoder(w io.Writer) RecordEncoder[int64] { return int64Encoder{w} }
+func (int64Codec) NewDecoder(r io.Reader) RecordDecoder[int64] { return int64Decoder{r} }
+
+type int64Encoder struct{ w io.Writer }
+
+func (e int64Encoder) Encode(v int64) error { return binary.Write(e.w, binary.BigEndian, v) }
+
+type int64Decoder struct{ r io.Reader }
+
+func (d int64Decoder) Decode(v *int64) error { return binary.Read(d.r, binary.BigEndian, v) }
+
+func TestTyped(t *testing.T) {
+	f, err := NewStream(t.Name()+".txt", NewMemFS())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Remove()
+	s := NewTyped[int64](f, int64Codec{})
+
+	r, err := s.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	go func() {
+		for i := int64(0); i < 10; i++ {
+			s.Write(i)
+			time.Sleep(time.Millisecond)
+		}
+		s.Close()
+	}()
+
+	for i := int64(0); ; i++ {
+		v, err := r.Next()
+		if err == io.EOF {
+			if i != 10 {
+				t.Errorf("expected 10 values, got %d", i)
+			}
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != i {
+			t.Errorf("Want/got: %d/%d", i, v)
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	type doc struct {
+		N    int
+		Text string
+	}
+
+	f, err := NewStream(t.Name()+".txt", NewMemFS())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Remove()
+
+	r, err := f.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	go func() {
+		for i := 0; i < 5; i++ {
+			f.WriteJSON(doc{N: i, Text: string(testdata)})
+		}
+		f.Close()
+	}()
+
+	for i := 0; ; i++ {
+		var d doc
+		err := r.DecodeJSON(&d)
+		if err == io.EOF {
+			if i != 5 {
+				t.Errorf("expected 5 documents, got %d", i)
+			}
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.N != i || d.Text != string(testdata) {
+			t.Errorf("unexpected document: %+v", d)
+		}
+	}
+
+	r2, err := f.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r2.Close()
+	data, _ := ioutil.ReadAll(r2)
+	if lines := bytes.Count(data, []byte("\n")); lines != 5 {
+		t.Errorf("expected 5 lines of JSON, got %d", lines)
+	}
+}
+
+func TestTypedJSON(t *testing.T) {
+	s := NewTyped[[]string](NewMemStream(), JSONCodec[[]string]{})
+	s.Write([]string{"a", "b"})
+	s.Close()
+
+	r, err := s.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if v, err := r.Next(); err != nil || len(v) != 2 || v[1] != "b" {
+		t.Errorf("unexpected value: %v, %v", v, err)
+	}
+	if _, err := r.Next(); err != io.EOF {
+		t.Errorf("expected io.EOF, got %v", err)
+	}
+}
+
+func TestDelimited(t *testing.T) {
+	f := NewMemStream()
+	records := [][]byte{testdata, {}, bytes.Repeat(testdata, 100)}
+
+	r, err := f.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	go func() {
+		for _, p := range records {
+			f.WriteDelimited(p)
+		}
+		f.Write([]byte{5, 'a'}) // a truncated record
+		f.Close()
+	}()
+
+	for _, want := range records {
+		p, err := r.ReadDelimited()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(p, want) {
+			t.Errorf("Want/got: %q/%q", want, p)
+		}
+	}
+	if _, err := r.ReadDelimited(); err != io.ErrUnexpectedEOF {
+		t.Errorf("expected io.ErrUnexpectedEOF, got %v", err)
+	}
+	if _, err := r.ReadDelimited(); err != io.EOF {
+		t.Errorf("expected io.EOF, got %v", err)
+	}
+
+	big := NewMemStream()
+	var size [binary.MaxVarintLen64]byte
+	big.Write(size[:binary.PutUvarint(size[:], maxDelimitedSize+1)])
+	big.Close()
+	br, err := big.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer br.Close()
+	if _, err := br.ReadDelimited(); err != ErrRecordTooLarge {
+		t.Errorf("expected ErrRecordTooLarge, got %v", err)
+	}
+}
+
+func TestGob(t *testing.T) {
+	type record struct {
+		N    int
+		Data []byte
+	}
+
+	f := NewMemStream()
+	go func() {
+		for i := 0; i < 5; i++ {
+			f.EncodeGob(record{N: i, Data: testdata})
+		}
+		f.Close()
+	}()
+
+	for j := 0; j < 2; j++ {
+		r, err := f.NextReader()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+		for i := 0; ; i++ {
+			var rec record
+			err := r.DecodeGob(&rec)
+			if err == io.EOF {
+				if i != 5 {
+					t.Errorf("expected 5 records, got %d", i)
+				}
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rec.N != i || !bytes.Equal(rec.Data, testdata) {
+				t.Errorf("unexpected record: %+v", rec)
+			}
+		}
+	}
+
+	s := NewTyped[map[string]int](NewMemStream(), GobCodec[map[string]int]{})
+	s.Write(map[string]int{"a": 1})
+	s.Write(map[string]int{"b": 2})
+	s.Close()
+	r, err := s.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	for _, key := range []string{"a", "b"} {
+		if v, err := r.Next(); err != nil || len(v) != 1 || v[key] == 0 {
+			t.Errorf("unexpected value: %v, %v", v, err)
+		}
+	}
+}
+
+func TestScanner(t *testing.T) {
+	f := NewMemStream()
+	r, err := f.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	go func() {
+		f.Write([]byte("one\ntw"))
+		time.Sleep(10 * time.Millisecond)
+		f.Write([]byte("o\nthree"))
+		f.Close()
+	}()
+
+	var lines []string
+	sc := r.Scanner(nil)
+	for sc.Scan() {
+		lines = append(lines, sc.Text())
+	}
+	if err := sc.Err(); err != nil {
+		t.Error(err)
+	}
+	if got := strings.Join(lines, ","); got != "one,two,three" {
+		t.Errorf("unexpected lines: %q", got)
+	}
+
+	f2 := NewMemStream()
+	r2, err := f2.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r2.Close()
+	f2.Write([]byte("a b"))
+	f2.Cancel()
+	sc = r2.Scanner(bufio.ScanWords)
+	for sc.Scan() {
+	}
+	if !errors.Is(sc.Err(), ErrCanceled) {
+		t.Errorf("expected ErrCanceled, got %v", sc.Err())
+	}
+}
+
+func TestWriteString(t *testing.T) {
+	var tee bytes.Buffer
+	for _, fs := range []FileSystem{NewMemFS(), StdFileSystem} {
+		tee.Reset()
+		f, err := NewStream(t.Name()+".txt", fs, WithWriteTee(&tee))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 3; i++ {
+			if n, err := f.WriteString(string(testdata)); n != len(testdata) || err != nil {
+				t.Errorf("unexpected WriteString: %d, %v", n, err)
+			}
+		}
+		f.Close()
+
+		r, err := f.NextReader()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := ioutil.ReadAll(r)
+		r.Close()
+		if want := bytes.Repeat(testdata, 3); !bytes.Equal(data, want) || !bytes.Equal(tee.Bytes(), want) {
+			t.Errorf("Want/got/tee: %q/%q/%q", want, data, tee.Bytes())
+		}
+		f.Remove()
+	}
+}
+
+func TestChain(t *testing.T) {
+	parts := []*Stream{NewMemStream(), NewMemStream(), NewMemStream()}
+	r := Chain(parts...)
+	defer r.Close()
+
+	go func() {
+		for i := len(parts) - 1; i >= 0; i-- {
+			parts[i].Write([]byte{'a' + byte(i)})
+			time.Sleep(5 * time.Millisecond)
+			parts[i].Write([]byte{'A' + byte(i)})
+			parts[i].Close()
+		}
+	}()
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "aAbBcC"; string(data) != want {
+		t.Errorf("Want/got: %q/%q", want, data)
+	}
+}
+
+func TestSegmentFS(t *testing.T) {
+	inner := NewMemFS()
+	fs := NewSegmentFS(inner, 10)
+	f, err := NewStream(t.Name(), fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := f.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := bytes.Repeat(testdata, 4)[:35]
+	go func() {
+		for p := want; len(p) > 0; p = p[7:] {
+			f.Write(p[:7])
+			time.Sleep(time.Millisecond)
+		}
+		f.Close()
+	}()
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, want) {
+		t.Errorf("Want/got: %q/%q", want, data)
+	}
+
+	// concurrent Reads share the offset of the File
+	sf, err := fs.Open(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var read int64
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p := make([]byte, 3)
+			for {
+				n, err := sf.Read(p)
+				atomic.AddInt64(&read, int64(n))
+				if err != nil {
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	sf.Close()
+	if read != int64(len(want)) {
+		t.Errorf("expected concurrent Reads to read %d bytes in all, got %d", len(want), read)
+	}
+
+	if err := fs.Trim(t.Name(), 25); err != nil {
+		t.Fatal(err)
+	}
+	names, err := fs.Segments(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(names, ","); got != t.Name()+".2,"+t.Name()+".3" {
+		t.Errorf("unexpected segments: %s", got)
+	}
+	if _, err := inner.Open(t.Name() + ".1"); err == nil {
+		t.Errorf("expected a trimmed segment to be removed")
+	}
+	if _, err := r.ReadAt(make([]byte, 5), 15); !errors.Is(err, ErrTrimmed) {
+		t.Errorf("expected ErrTrimmed, got %v", err)
+	}
+	p := make([]byte, 12)
+	if n, err := r.ReadAt(p, 20); n != 12 || err != nil || !bytes.Equal(p, want[20:32]) {
+		t.Errorf("unexpected ReadAt: %d, %v, %q", n, err, p)
+	}
+	r.Close()
+
+	if err := f.Remove(); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		if _, err := inner.Open(name); err == nil {
+			t.Errorf("expected %s to be removed", name)
+		}
+	}
+}
+
+func TestReaderStats(t *testing.T) {
+	f := NewMemStream()
+	r, err := f.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		f.Write(testdata)
+		f.Close()
+	}()
+	if _, err := ioutil.ReadAll(r); err != nil {
+		t.Fatal(err)
+	}
+
+	stats := r.Stats()
+	if stats.Blocked < 15*time.Millisecond {
+		t.Errorf("expected the Reader to be blocked for the delay, got %v", stats.Blocked)
+	}
+	if stats.Wakeups < 1 {
+		t.Errorf("expected the Reader to be woken, got %d", stats.Wakeups)
+	}
+	if stats.Reading <= 0 || stats.Reading >= stats.Blocked {
+		t.Errorf("unexpected time Reading: %v", stats.Reading)
+	}
+}
+
+func TestStreamStats(t *testing.T) {
+	f := NewMemStream()
+	r, err := f.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	for i := 0; i < 4; i++ {
+		f.Write(testdata)
+	}
+	f.Write(nil)
+
+	stats := f.Stats()
+	if stats.Written != 4*int64(len(testdata)) || stats.Writes != 4 || stats.Readers != 1 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+	if want := float64(stats.Written) / rateWindow.Seconds(); stats.Rate <= 0 || stats.Rate > want {
+		t.Errorf("expected a rate of up to %v, got %v", want, stats.Rate)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	if later := f.Stats().Rate; later >= stats.Rate {
+		t.Errorf("expected the rate to decay without Writes, got %v then %v", stats.Rate, later)
+	}
+}
+
+func TestDebugDump(t *testing.T) {
+	f := NewMemStream()
+	f.Write(testdata)
+
+	blocked, err := f.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer blocked.Close()
+	idle, err := f.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idle.Close()
+
+	done := make(chan struct{})
+	go func() {
+		ioutil.ReadAll(blocked)
+		close(done)
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	var buf bytes.Buffer
+	if err := f.DebugDump(&buf); err != nil {
+		t.Fatal(err)
+	}
+	dump := buf.String()
+	for _, want := range []string{
+		fmt.Sprintf(`stream "": open, size %d, 2 readers, writer open: true`, len(testdata)),
+		"offset 0, idle",
+		fmt.Sprintf("offset %d, blocked for", len(testdata)),
+		fmt.Sprintf("waiting for offset %d", len(testdata)),
+	} {
+		if !strings.Contains(dump, want) {
+			t.Errorf("expected %q in the dump:\n%s", want, dump)
+		}
+	}
+	f.Close()
+	<-done
+}
+
+func TestStreamReaders(t *testing.T) {
+	f := NewMemStream()
+	f.Write(testdata)
+
+	idle, err := f.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idle.Close()
+	time.Sleep(time.Millisecond)
+	blocked, err := f.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer blocked.Close()
+
+	done := make(chan struct{})
+	go func() {
+		ioutil.ReadAll(blocked)
+		close(done)
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	infos := f.Readers()
+	if len(infos) != 2 || infos[0].Reader != idle || infos[1].Reader != blocked {
+		t.Fatalf("expected the idle and blocked Readers in the order they were opened, got %v", infos)
+	}
+	if info := infos[0]; info.Offset != 0 || info.Blocked || info.Opened.IsZero() {
+		t.Errorf("expected an idle Reader at offset 0, got %+v", info)
+	}
+	if info := infos[1]; info.Offset != int64(len(testdata)) || !info.Blocked || info.BlockedFor <= 0 || info.WaitingFor != int64(len(testdata)) {
+		t.Errorf("expected a Reader blocked at offset %d, got %+v", len(testdata), info)
+	}
+	f.Close()
+	<-done
+}
+
+func TestNextReaderLabeled(t *testing.T) {
+	leaked := make(chan string, 1)
+	f, err := NewStream(t.Name()+".txt", NewMemFS(), WithLeakDetection(10*time.Millisecond, func(r *Reader, created []byte) {
+		leaked <- r.String()
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(testdata)
+	f.Close()
+
+	r, err := f.NextReaderLabeled("tenant-42/request-abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Label() != "tenant-42/request-abc" {
+		t.Errorf("expected the label tenant-42/request-abc, got %q", r.Label())
+	}
+	if infos := f.Readers(); len(infos) != 1 || infos[0].Label != r.Label() {
+		t.Errorf("expected the labeled Reader in Readers, got %+v", infos)
+	}
+	var buf bytes.Buffer
+	f.DebugDump(&buf)
+	if !strings.Contains(buf.String(), "reader tenant-42/request-abc: offset 0") {
+		t.Errorf("expected the label in the dump:\n%s", buf.String())
+	}
+
+	go f.Remove()
+	if report := <-leaked; !strings.Contains(report, `reader "tenant-42/request-abc" of`) {
+		t.Errorf("expected the label in the leak report, got %q", report)
+	}
+	r.Close()
+}
+
+func TestString(t *testing.T) {
+	f, err := NewStream(t.Name()+".txt", NewMemFS())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Remove()
+	f.Write(testdata)
+	r, err := f.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Read(make([]byte, 3))
+
+	if got, want := fmt.Sprintf("%v", f), fmt.Sprintf(`stream "TestString.txt" (open, %d bytes, 1 readers)`, len(testdata)); got != want {
+		t.Errorf("Want/got: %s/%s", want, got)
+	}
+	if got, want := fmt.Sprintf("%#v", f), fmt.Sprintf(`&stream.Stream{Name: "TestString.txt", State: "open", Size: %d, Readers: 1}`, len(testdata)); got != want {
+		t.Errorf("Want/got: %s/%s", want, got)
+	}
+	if got, want := fmt.Sprint(r), `reader of "TestString.txt" at offset 3 (idle)`; got != want {
+		t.Errorf("Want/got: %s/%s", want, got)
+	}
+	r.Close()
+	f.Close()
+	if got := f.String(); !strings.Contains(got, "(closed,") {
+		t.Errorf("expected a closed Stream, got %s", got)
+	}
+}
+
+func leakReader(t *testing.T, f *Stream) {
+	if _, err := f.NextReader(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLeakDetection(t *testing.T) {
+	var reported int32
+	f, err := NewStream(t.Name()+".txt", NewMemFS(), WithLeakDetection(10*time.Millisecond, func(r *Reader, created []byte) {
+		atomic.AddInt32(&reported, 1)
+		if !bytes.Contains(created, []byte("leakReader")) {
+			t.Errorf("expected the stack which created the Reader, got:\n%s", created)
+		}
+		r.Close()
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	leakReader(t, f)
+	r, err := f.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	f.Close()
+
+	if err := f.Remove(); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&reported); n != 1 {
+		t.Errorf("expected 1 leaked Reader, got %d", n)
+	}
+}
+
+func TestReaderAutoClose(t *testing.T) {
+	var warned int32
+	f, err := NewStream(t.Name()+".txt", NewMemFS(), WithReaderAutoClose(10*time.Millisecond, func(r *Reader) {
+		atomic.AddInt32(&warned, 1)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := f.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	if err := f.Remove(); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&warned); n != 1 {
+		t.Errorf("expected a warning for 1 Reader, got %d", n)
+	}
+	if _, err := r.Read(make([]byte, 1)); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("expected the Reader to be Closed, got %v", err)
+	}
+}
+
+func TestNonBlockingReadAt(t *testing.T) {
+	f, err := NewStream(t.Name()+".txt", NewMemFS(), WithNonBlockingReadAt())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Remove()
+	f.Write(testdata)
+
+	r, err := f.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	p := make([]byte, 5)
+	if n, err := r.ReadAt(p, 2); n != 5 || err != nil || !bytes.Equal(p, testdata[2:7]) {
+		t.Errorf("unexpected ReadAt: %d, %v, %q", n, err, p)
+	}
+	p = make([]byte, len(testdata))
+	if n, err := r.ReadAt(p, 3); n != len(testdata)-3 || err != io.EOF {
+		t.Errorf("expected a short ReadAt with io.EOF, got %d, %v", n, err)
+	}
+	if n, err := r.ReadAt(p, 100); n != 0 || err != io.EOF {
+		t.Errorf("expected io.EOF past the end, got %d, %v", n, err)
+	}
+
+	// Read still blocks for more data.
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		f.Write(testdata)
+		f.Close()
+	}()
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := bytes.Repeat(testdata, 2); !bytes.Equal(data, want) {
+		t.Errorf("Want/got: %q/%q", want, data)
+	}
+
+	canceled, err := NewStream(t.Name()+"2.txt", NewMemFS(), WithNonBlockingReadAt())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cr, err := canceled.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	canceled.Cancel()
+	if _, err := cr.ReadAt(p, 0); !errors.Is(err, ErrCanceled) {
+		t.Errorf("expected ErrCanceled, got %v", err)
+	}
+}
+
+func TestCloseWithSize(t *testing.T) {
+	f := NewMemStream()
+	f.Write(testdata)
+	if err := f.CloseWithSize(int64(len(testdata))); err != nil {
+		t.Fatal(err)
+	}
+	r, err := f.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ioutil.ReadAll(r); err != nil || !bytes.Equal(data, testdata) {
+		t.Errorf("unexpected ReadAll: %q, %v", data, err)
+	}
+	r.Close()
+
+	truncated := NewMemStream()
+	r, err = truncated.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	truncated.Write(testdata[:5])
+	var serr *SizeError
+	if err := truncated.CloseWithSize(int64(len(testdata))); !errors.As(err, &serr) || serr.Got != 5 || serr.Want != int64(len(testdata)) {
+		t.Fatalf("expected a *SizeError, got %v", err)
+	}
+	if _, err := ioutil.ReadAll(r); !errors.Is(err, ErrCanceled) || !errors.As(err, &serr) {
+		t.Errorf("expected Readers to fail with the SizeError, got %v", err)
+	}
+}
+
+func TestStrictSize(t *testing.T) {
+	f := NewMemStream(WithStrictSize())
+	f.Write(testdata) // no declared size yet
+	if err := f.SetSeekEnd(int64(len(testdata)) + 3); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := f.Write(testdata[:3]); n != 3 || err != nil {
+		t.Errorf("unexpected Write: %d, %v", n, err)
+	}
+	var serr *SizeError
+	if n, err := f.Write(testdata[:1]); n != 0 || !errors.As(err, &serr) || serr.Want != int64(len(testdata))+3 {
+		t.Errorf("expected a *SizeError, got %d, %v", n, err)
+	}
+	if err := f.CloseWithSize(int64(len(testdata)) + 3); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPunchHole(t *testing.T) {
+	f, err := New(t.Name() + ".txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Remove()
+	defer f.Close()
+	const block = 64 << 10
+	data := bytes.Repeat(testdata, 3*block/len(testdata)+1)[:3*block]
+	f.Write(data)
+
+	if err := f.PunchHole(2*block, 2*block); !errors.Is(err, errRange) {
+		t.Errorf("expected a range past the end to be invalid, got %v", err)
+	}
+	if err := f.PunchHole(block, block); err == ErrUnsupported {
+		t.Skip("punching holes is unsupported here")
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	f.PunchHole(block+10, 10) // already discarded
+
+	want := []Extent{{Off: 0, Len: block}, {Off: 2 * block, Len: block}}
+	if got := f.Extents(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Want/got: %v/%v", want, got)
+	}
+
+	r, err := f.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	p := make([]byte, 100)
+	if _, err := r.ReadAt(p, block-50); !errors.Is(err, ErrTrimmed) {
+		t.Errorf("expected ErrTrimmed, got %v", err)
+	}
+	if n, err := r.ReadAt(p, 2*block); n != len(p) || err != nil || !bytes.Equal(p, data[2*block:2*block+100]) {
+		t.Errorf("unexpected ReadAt: %d, %v", n, err)
+	}
+}
+
+func TestPunchHoleClosed(t *testing.T) {
+	f := NewMemStream()
+	f.Write(testdata)
+	f.Close()
+	if err := f.PunchHole(0, 1); !errors.Is(err, ErrWriterClosed) {
+		t.Errorf("expected ErrWriterClosed once the Stream is Closed, got %v", err)
+	}
+}
+
+func TestReadAtContext(t *testing.T) {
+	f := NewMemStream()
+	f.Write(testdata)
+	r, err := f.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	p := make([]byte, 5)
+	if _, err := r.ReadAtContext(ctx, p, int64(len(testdata))); err != context.DeadlineExceeded {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+
+	// the Reader is still usable
+	if n, err := r.ReadAtContext(context.Background(), p, 1); n != 5 || err != nil || !bytes.Equal(p, testdata[1:6]) {
+		t.Errorf("unexpected ReadAtContext: %d, %v, %q", n, err, p)
+	}
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		f.Write(testdata)
+	}()
+	if n, err := r.ReadAtContext(context.Background(), p, int64(len(testdata))); n != 5 || err != nil || !bytes.Equal(p, testdata[:5]) {
+		t.Errorf("unexpected ReadAtContext: %d, %v, %q", n, err, p)
+	}
+	f.Close()
+}
+
+func TestSeekContext(t *testing.T) {
+	f := NewMemStream()
+	f.Write(testdata)
+	r, err := f.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	r.Seek(2, io.SeekStart)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := r.SeekContext(ctx, -1, io.SeekEnd); err != context.DeadlineExceeded {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+	if off, err := r.Seek(0, io.SeekCurrent); off != 2 || err != nil {
+		t.Errorf("expected the offset to be unchanged, got %d, %v", off, err)
+	}
+
+	f.Close()
+	if off, err := r.SeekContext(context.Background(), -1, io.SeekEnd); off != int64(len(testdata))-1 || err != nil {
+		t.Errorf("unexpected SeekContext: %d, %v", off, err)
+	}
+}
+
+func TestWaitContext(t *testing.T) {
+	f := NewMemStream()
+	f.Write(testdata)
+	r, err := f.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := f.WaitForSizeContext(ctx, 100); err != context.DeadlineExceeded {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+	if err := r.WaitAvailableContext(ctx, 0, 100); err != context.DeadlineExceeded {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+	if err := r.WaitAvailableContext(ctx, 0, 5); err != nil {
+		t.Errorf("expected written data to be available, got %v", err)
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		f.Write(testdata)
+		f.Close()
+	}()
+	if err := f.WaitForSizeContext(context.Background(), int64(len(testdata))+1); err != nil {
+		t.Error(err)
+	}
+	if err := r.WaitAvailableContext(context.Background(), 0, 100); err != io.ErrUnexpectedEOF {
+		t.Errorf("expected io.ErrUnexpectedEOF, got %v", err)
+	}
+}
+
+func TestCause(t *testing.T) {
+	f := NewMemStream()
+	if err := f.Cause(); err != nil {
+		t.Errorf("expected no cause while open, got %v", err)
+	}
+	f.Close()
+	if err := f.Cause(); err != nil {
+		t.Errorf("expected no cause once Closed, got %v", err)
+	}
+
+	errUpstream := errors.New("upstream failed")
+	f = NewMemStream()
+	f.CloseWithError(errUpstream)
+	if err := f.Cause(); err != errUpstream {
+		t.Errorf("expected the CloseWithError error, got %v", err)
+	}
+
+	f = NewMemStream()
+	f.Cancel()
+	if err := f.Cause(); err != ErrCanceled {
+		t.Errorf("expected ErrCanceled, got %v", err)
+	}
+
+	f = NewMemStream()
+	f.CloseWithSize(1)
+	var serr *SizeError
+	if err := f.Cause(); !errors.As(err, &serr) {
+		t.Errorf("expected the *SizeError cause, got %v", err)
+	}
+
+	f = NewMemStream()
+	f.Close()
+	f.ShutdownWithErr(ErrRemoving)
+	if err := f.Cause(); err != ErrRemoving {
+		t.Errorf("expected ErrRemoving, got %v", err)
+	}
+}
+
+var errFlaky = errors.New("flaky")
+
+// flakyFS fails every other Create, Open, Write and ReadAt with errFlaky.
+type flakyFS struct {
+	FileSystem
+	calls int32
+}
+
+func (fs *flakyFS) fail() bool { return atomic.AddInt32(&fs.calls, 1)%2 == 1 }
+
+func (fs *flakyFS) Create(name string) (File, error) {
+	if fs.fail() {
+		return nil, errFlaky
+	}
+	f, err := fs.FileSystem.Create(name)
+	return &flakyFile{File: f, fs: fs}, err
+}
+
+func (fs *flakyFS) Open(name string) (File, error) {
+	if fs.fail() {
+		return nil, errFlaky
+	}
+	f, err := fs.FileSystem.Open(name)
+	return &flakyFile{File: f, fs: fs}, err
+}
+
+type flakyFile struct {
+	File
+	fs *flakyFS
+}
+
+func (f *flakyFile) Write(p []byte) (int, error) {
+	if f.fs.fail() {
+		return 0, errFlaky
+	}
+	return f.File.Write(p)
+}
+
+func (f *flakyFile) ReadAt(p []byte, off int64) (int, error) {
+	if f.fs.fail() {
+		return 0, errFlaky
+	}
+	return f.File.ReadAt(p, off)
+}
+
+func TestRetryFS(t *testing.T) {
+	fs := NewRetryFS(&flakyFS{FileSystem: NewMemFS()}, Backoff{Attempts: 2, Delay: time.Millisecond})
+	f, err := NewStream("retry", fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Remove()
+	r, err := f.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	for i := range testdata {
+		if _, err := f.Write(testdata[i : i+1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f.Close()
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, testdata) {
+		t.Errorf("Want/got: %q/%q", testdata, data)
+	}
+
+	fs = NewRetryFS(&flakyFS{FileSystem: NewMemFS()}, Backoff{Attempts: 2, Retryable: func(error) bool { return false }})
+	if _, err := fs.Create("retry"); err != errFlaky {
+		t.Errorf("expected errFlaky not to be retried, got %v", err)
+	}
+	if _, err := NewRetryFS(NewMemFS(), Backoff{Attempts: 3}).Open("missing"); err == nil {
+		t.Error("expected Open of a missing File to fail")
+	}
+
+	for _, permanent := range []error{ErrQuotaExceeded, ErrFileTooLarge, ErrNotFoundInMem, ErrCorrupt, ErrTrimmed, ErrCanceled, ErrWriterClosed} {
+		failing := &failingFS{FileSystem: NewMemFS(), err: &Error{Op: "create", Err: permanent}}
+		if _, err := NewRetryFS(failing, Backoff{Attempts: 3}).Create("retry"); !errors.Is(err, permanent) || failing.calls != 1 {
+			t.Errorf("expected %v not to be retried, got %v after %d calls", permanent, err, failing.calls)
+		}
+	}
+}
+
+// failingFS fails every Create with err.
+type failingFS struct {
+	FileSystem
+	err   error
+	calls int
+}
+
+func (fs *failingFS) Create(name string) (File, error) {
+	fs.calls++
+	return nil, fs.err
+}
+
+// stuckFS blocks Create, and Writes to its Files, until unstuck is closed.
+type stuckFS struct {
+	FileSystem
+	unstuck chan struct{}
+}
+
+func (fs *stuckFS) Create(name string) (File, error) {
+	if name == "stuck" {
+		<-fs.unstuck
+	}
+	f, err := fs.FileSystem.Create(name)
+	return &stuckFile{File: f, unstuck: fs.unstuck}, err
+}
+
+type stuckFile struct {
+	File
+	unstuck chan struct{}
+}
+
+func (f *stuckFile) Write(p []byte) (int, error) {
+	if len(p) > 1 {
+		<-f.unstuck
+	}
+	return f.File.Write(p)
+}
+
+func TestTimeoutFS(t *testing.T) {
+	stuck := &stuckFS{FileSystem: NewMemFS(), unstuck: make(chan struct{})}
+	defer close(stuck.unstuck)
+	fs := NewTimeoutFS(stuck, 10*time.Millisecond)
+
+	var terr *TimeoutError
+	if _, err := NewStream("stuck", fs); !errors.As(err, &terr) || terr.Op != "create" {
+		t.Errorf("expected a create *TimeoutError, got %v", err)
+	}
+	f, err := NewStream("timeout", fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Remove()
+	if _, err := f.Write(testdata[:1]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write(testdata[1:]); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("expected the Write to time out, got %v", err)
+	}
+	if _, err := f.Write(testdata[:1]); !errors.As(err, &terr) || terr.Op != "write" {
+		t.Errorf("expected the File to keep failing with the write *TimeoutError, got %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Errorf("expected Close to close the File anyway, got %v", err)
+	}
+}
+
+// countingMetrics counts the calls and errors of each operation.
+type countingMetrics struct {
+	mu      sync.Mutex
+	calls   map[string]int
+	errs    map[string]int
+	written int
+}
+
+func (m *countingMetrics) Record(op, name string, n int, d time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls[op]++
+	if err != nil && err != io.EOF {
+		m.errs[op]++
+	}
+	if op == "write" {
+		m.written += n
+	}
+}
+
+func TestInstrumentedFS(t *testing.T) {
+	m := &countingMetrics{calls: make(map[string]int), errs: make(map[string]int)}
+	fs := NewInstrumentedFS(NewMemFS(), m)
+	f, err := NewStream("instrumented", fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := f.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(testdata)
+	f.Close()
+	if _, err := ioutil.ReadAll(r); err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	f.Remove()
+	fs.Open("missing")
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, op := range []string{"create", "open", "write", "read", "close", "remove"} {
+		if m.calls[op] == 0 {
+			t.Errorf("expected %s to be recorded", op)
+		}
+	}
+	if m.errs["open"] != 1 {
+		t.Errorf("expected 1 open error, got %d", m.errs["open"])
+	}
+	if m.written != len(testdata) {
+		t.Errorf("expected %d bytes written, got %d", len(testdata), m.written)
+	}
+}
+
+func TestQuotaFS(t *testing.T) {
+	fs := NewQuotaFS(NewMemFS(), 16)
+	f, err := NewStream("quota", fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := f.Write(testdata); err != nil || n != len(testdata) {
+		t.Fatalf("expected the Write to fit, got %d, %v", n, err)
+	}
+	g, err := NewStream("over", fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := g.Write(testdata)
+	if !errors.Is(err, ErrQuotaExceeded) || n != 16-len(testdata) {
+		t.Errorf("expected a short Write and ErrQuotaExceeded, got %d, %v", n, err)
+	}
+	if used, limit := fs.Usage(); used != 16 || limit != 16 {
+		t.Errorf("expected 16/16 bytes used, got %d/%d", used, limit)
+	}
+
+	f.Close()
+	f.Remove()
+	if used, _ := fs.Usage(); used != 16-int64(len(testdata)) {
+		t.Errorf("expected the Removed File's bytes to be returned, got %d used", used)
+	}
+	g.Close()
+	g.Remove()
+	if used, _ := fs.Usage(); used != 0 {
+		t.Errorf("expected no bytes used, got %d", used)
+	}
+}
+
+func TestOpenStream(t *testing.T) {
+	fs := NewReadOnlyFS(fstest.MapFS{"data": &fstest.MapFile{Data: testdata}})
+	if _, err := fs.Create("data"); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("expected Create to be unsupported, got %v", err)
+	}
+	if _, err := OpenStream("missing", fs); !errors.Is(err, iofs.ErrNotExist) {
+		t.Errorf("expected a missing File not to exist, got %v", err)
+	}
+
+	f, err := OpenStream("data", fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		r, err := f.NextReader()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if size, closed := r.Size(); size != int64(len(testdata)) || !closed {
+			t.Errorf("expected a Closed Stream of %d bytes, got %d, %v", len(testdata), size, closed)
+		}
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, testdata) {
+			t.Errorf("Want/got: %q/%q", testdata, data)
+		}
+		buf := make([]byte, 5)
+		if n, err := r.ReadAt(buf, 6); n != 5 || string(buf) != string(testdata[6:11]) {
+			t.Errorf("unexpected ReadAt %d, %v: %q", n, err, buf)
+		}
+		r.Close()
+	}
+	if _, err := f.Write(testdata); err == nil {
+		t.Error("expected Write to fail")
+	}
+}
+
+func TestOverlayFS(t *testing.T) {
+	base := NewReadOnlyFS(fstest.MapFS{"cold": &fstest.MapFile{Data: testdata}})
+	fs := NewOverlayFS(NewMemFS(), base)
+
+	f, err := NewStream("warm", fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(testdata)
+	f.Close()
+	defer f.Remove()
+
+	for _, name := range []string{"warm", "cold"} {
+		f, err := OpenStream(name, fs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := f.NextReader()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, testdata) {
+			t.Errorf("%s: Want/got: %q/%q", name, testdata, data)
+		}
+	}
+	if _, err := fs.Open("missing"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected a missing File not to exist, got %v", err)
+	}
+}
+
+// fakeSFTP is an SFTPClient backed by an in-memory FileSystem.
+type fakeSFTP struct{ fs FileSystem }
+
+func (c fakeSFTP) Create(path string) (File, error) { return c.fs.Create(path) }
+func (c fakeSFTP) Open(path string) (File, error)   { return c.fs.Open(path) }
+func (c fakeSFTP) Remove(path string) error         { return c.fs.Remove(path) }
+func (c fakeSFTP) Rename(oldpath, newpath string) error {
+	return c.fs.(Renamer).Rename(oldpath, newpath)
+}
+
+func TestSFTPFS(t *testing.T) {
+	fs := NewSFTPFS[File](fakeSFTP{NewMemFS()})
+	f, err := NewStream("sftp", fs, WithAtomicCreate())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testFile(f, t)
+}
+
+// davServer is a minimal WebDAV server, which stores Files in memory.
+type davServer struct {
+	mu    sync.Mutex
+	files map[string][]byte
+}
+
+func (s *davServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.files[r.URL.Path]
+	switch r.Method {
+	case http.MethodPut:
+		s.files[r.URL.Path], _ = ioutil.ReadAll(r.Body)
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodGet, http.MethodHead:
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeContent(w, r, r.URL.Path, time.Time{}, bytes.NewReader(data))
+	case http.MethodDelete:
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		delete(s.files, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	case "MOVE":
+		dst, err := url.Parse(r.Header.Get("Destination"))
+		if !ok || err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		delete(s.files, r.URL.Path)
+		s.files[dst.Path] = data
+		w.WriteHeader(http.StatusCreated)
+	}
+}
+
+func TestWebDAVFS(t *testing.T) {
+	dav := &davServer{files: make(map[string][]byte)}
+	srv := httptest.NewServer(dav)
+	defer srv.Close()
+	fs := NewWebDAVFS(srv.URL+"/cache", nil)
+
+	f, err := NewStream("dav", fs, WithAtomicCreate())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := f.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(testdata[:5])
+	if _, err := fs.Open("dav.tmp"); err != nil {
+		t.Errorf("expected the File to be readable while it's written, got %v", err)
+	}
+	f.Write(testdata[5:])
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ioutil.ReadAll(r); err != nil || !bytes.Equal(data, testdata) {
+		t.Errorf("Want/got: %q/%q, %v", testdata, data, err)
+	}
+	r.Close()
+	dav.mu.Lock()
+	uploaded := dav.files["/cache/dav"]
+	dav.mu.Unlock()
+	if !bytes.Equal(uploaded, testdata) {
+		t.Errorf("expected %q to be uploaded, got %q", testdata, uploaded)
+	}
+
+	g, err := OpenStream("dav", fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr, err := g.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 5)
+	if n, err := rr.ReadAt(buf, 6); n != 5 || string(buf) != "world" {
+		t.Errorf("unexpected ReadAt %d, %v: %q", n, err, buf)
+	}
+	if data, err := ioutil.ReadAll(rr); err != nil || !bytes.Equal(data, testdata) {
+		t.Errorf("Want/got: %q/%q, %v", testdata, data, err)
+	}
+	rr.Close()
+
+	if err := f.Remove(); err != nil {
+		t.Error(err)
+	}
+	if _, err := fs.Open("dav"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected the File to be removed, got %v", err)
+	}
+}
+
+func TestHTTPRangeFS(t *testing.T) {
+	var ranges int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/objects/a b" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("Range") != "" {
+			atomic.AddInt32(&ranges, 1)
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(testdata))
+	}))
+	defer srv.Close()
+	fs := NewHTTPRangeFS(srv.URL+"/objects/{name}", nil)
+
+	if _, err := OpenStream("missing", fs); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected a missing object not to exist, got %v", err)
+	}
+	f, err := OpenStream("a b", fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := f.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size, _ := r.Size(); size != int64(len(testdata)) {
+		t.Errorf("expected the size of the object, got %d", size)
+	}
+	buf := make([]byte, 5)
+	if n, err := r.ReadAt(buf, 6); n != 5 || string(buf) != "world" {
+		t.Errorf("unexpected ReadAt %d, %v: %q", n, err, buf)
+	}
+	if atomic.LoadInt32(&ranges) != 1 {
+		t.Errorf("expected a single Range request, got %d", ranges)
+	}
+	r.Close()
+	if _, err := r.ReadAt(buf, 0); err == nil {
+		t.Error("expected ReadAt after Close to fail")
+	}
+}
+
+type ctxKey struct{}
+
+// ctxFS is a FileSystemContext recording the value of ctxKey in the contexts of its calls.
+type ctxFS struct {
+	FileSystem
+	mu    sync.Mutex
+	calls []string
+}
+
+func (fs *ctxFS) record(op string, ctx context.Context) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.calls = append(fs.calls, fmt.Sprintf("%s %v", op, ctx.Value(ctxKey{})))
+}
+
+func (fs *ctxFS) CreateContext(ctx context.Context, name string) (File, error) {
+	fs.record("create", ctx)
+	f, err := fs.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	return &ctxFile{File: f, fs: fs}, nil
+}
+
+func (fs *ctxFS) OpenContext(ctx context.Context, name string) (File, error) {
+	fs.record("open", ctx)
+	return fs.Open(name)
+}
+
+func (fs *ctxFS) RemoveContext(ctx context.Context, name string) error {
+	fs.record("remove", ctx)
+	return fs.Remove(name)
+}
+
+// ctxFile is a WriterContext recording its WriteContexts in fs.
+type ctxFile struct {
+	File
+	fs *ctxFS
+}
+
+func (f *ctxFile) WriteContext(ctx context.Context, p []byte) (int, error) {
+	f.fs.record("write", ctx)
+	return f.File.Write(p)
+}
+
+func TestFileSystemContext(t *testing.T) {
+	fs := &ctxFS{FileSystem: NewMemFS()}
+	f, err := NewStreamContext(context.WithValue(context.Background(), ctxKey{}, "writer"), t.Name()+".txt", fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(testdata[:1])
+	f.WriteContext(context.WithValue(context.Background(), ctxKey{}, "write"), testdata[1:])
+	f.Close()
+
+	r, err := f.NextReaderContext(context.WithValue(context.Background(), ctxKey{}, "reader"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if data, _ := ioutil.ReadAll(r); !bytes.Equal(data, testdata) {
+		t.Errorf("read %q, expected %q", data, testdata)
+	}
+	r.Close()
+	if err := f.RemoveContext(context.WithValue(context.Background(), ctxKey{}, "remover")); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"create writer", "write write", "open reader", "remove remover"}; !reflect.DeepEqual(fs.calls, want) {
+		t.Errorf("expected calls %q, got %q", want, fs.calls)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(testdata))
+	}))
+	defer srv.Close()
+	remote, err := OpenStream("a", NewHTTPRangeFS(srv.URL+"/{name}", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := remote.NextReaderContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected a canceled Open, got %v", err)
+	}
+}
+
+func TestFileSystemContextWrappers(t *testing.T) {
+	key := make([]byte, 16)
+	metrics := &countingMetrics{calls: make(map[string]int), errs: make(map[string]int)}
+	wrappers := map[string]func(inner FileSystem) FileSystem{
+		"timeout":      func(inner FileSystem) FileSystem { return NewTimeoutFS(inner, time.Minute) },
+		"retry":        func(inner FileSystem) FileSystem { return NewRetryFS(inner, Backoff{Attempts: 2}) },
+		"instrumented": func(inner FileSystem) FileSystem { return NewInstrumentedFS(inner, metrics) },
+		"quota":        func(inner FileSystem) FileSystem { return NewQuotaFS(inner, 1<<20) },
+		"overlay":      func(inner FileSystem) FileSystem { return NewOverlayFS(inner, NewMemFS()) },
+		"segment":      func(inner FileSystem) FileSystem { return NewSegmentFS(inner, 4) },
+		"checksum":     func(inner FileSystem) FileSystem { return NewChecksumFS(inner, 4) },
+		"gzip":         func(inner FileSystem) FileSystem { return NewGzipFS(inner, 4) },
+		"aes-ctr": func(inner FileSystem) FileSystem {
+			fs, err := NewAESCTRFS(inner, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return fs
+		},
+	}
+	for name, wrap := range wrappers {
+		t.Run(name, func(t *testing.T) {
+			inner := &ctxFS{FileSystem: NewMemFS()}
+			ctx := context.WithValue(context.Background(), ctxKey{}, "ctx")
+			f, err := NewStreamContext(ctx, "a", wrap(inner))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := f.WriteContext(ctx, testdata); err != nil {
+				t.Fatal(err)
+			}
+			f.Close()
+			r, err := f.NextReaderContext(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if data, _ := ioutil.ReadAll(r); !bytes.Equal(data, testdata) {
+				t.Errorf("read %q, expected %q", data, testdata)
+			}
+			r.Close()
+			if err := f.RemoveContext(ctx); err != nil {
+				t.Fatal(err)
+			}
+
+			seen := make(map[string]bool)
+			for _, call := range inner.calls {
+				op := strings.Fields(call)[0]
+				// the writes of Close, which has no context, are the only ones expected without it
+				if call != op+" ctx" && op != "write" {
+					t.Errorf("expected the context to be passed on, got %q", call)
+				}
+				seen[call] = true
+			}
+			for _, want := range []string{"create ctx", "write ctx", "remove ctx"} {
+				if !seen[want] {
+					t.Errorf("expected %q among %q", want, inner.calls)
+				}
+			}
+		})
+	}
+}
+
+// fakeDB is a database/sql driver which only understands the statements of sqlFS.
+type fakeDB struct {
+	mu     sync.Mutex
+	chunks map[string]map[int64][]byte
+}
+
+var registerFakeDB sync.Once
+
+func (d *fakeDB) Open(string) (driver.Conn, error) { return d, nil }
+func (d *fakeDB) Prepare(query string) (driver.Stmt, error) {
+	return fakeStmt{d, query}, nil
+}
+func (d *fakeDB) Close() error              { return nil }
+func (d *fakeDB) Begin() (driver.Tx, error) { return d, nil }
+func (d *fakeDB) Commit() error             { return nil }
+func (d *fakeDB) Rollback() error           { return nil }
+
+type fakeStmt struct {
+	d     *fakeDB
+	query string
+}
+
+func (s fakeStmt) Close() error  { return nil }
+func (s fakeStmt) NumInput() int { return -1 }
+
+func (s fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+	switch q := s.query; {
+	case strings.HasPrefix(q, "CREATE"):
+	case strings.HasPrefix(q, "DELETE"):
+		n := len(s.d.chunks[args[0].(string)])
+		delete(s.d.chunks, args[0].(string))
+		return driver.RowsAffected(n), nil
+	case strings.HasPrefix(q, "INSERT") && len(args) == 2:
+		s.d.chunks[args[0].(string)] = map[int64][]byte{0: args[1].([]byte)}
+	case strings.HasPrefix(q, "INSERT"):
+		s.d.chunks[args[0].(string)][args[1].(int64)] = args[2].([]byte)
+	case strings.HasPrefix(q, "UPDATE"):
+		s.d.chunks[args[1].(string)][args[2].(int64)] = args[0].([]byte)
+	default:
+		return nil, fmt.Errorf("unexpected statement %q", q)
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+	chunks := s.d.chunks[args[0].(string)]
+	rows := &fakeRows{}
+	switch q := s.query; {
+	case strings.HasPrefix(q, "SELECT seq FROM"):
+		rows.cols = []string{"seq"}
+		if _, ok := chunks[0]; ok {
+			rows.rows = [][]driver.Value{{int64(0)}}
+		}
+	case strings.HasPrefix(q, "SELECT seq, data"):
+		rows.cols = []string{"seq", "data"}
+		for seq := args[1].(int64); seq <= args[2].(int64); seq++ {
+			if data, ok := chunks[seq]; ok {
+				rows.rows = append(rows.rows, []driver.Value{seq, data})
+			}
+		}
+	case strings.HasPrefix(q, "SELECT COALESCE"):
+		var size int64
+		for _, data := range chunks {
+			size += int64(len(data))
+		}
+		rows.cols, rows.rows = []string{"size"}, [][]driver.Value{{size}}
+	default:
+		return nil, fmt.Errorf("unexpected query %q", q)
+	}
+	return rows, nil
+}
+
+type fakeRows struct {
+	cols []string
+	rows [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.cols }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+func TestSQLFS(t *testing.T) {
+	registerFakeDB.Do(func() { sql.Register("streamfake", &fakeDB{chunks: make(map[string]map[int64][]byte)}) })
+	db, err := sql.Open("streamfake", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	fs, err := NewSQLFS(db, "chunks", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := NewStream("sql", fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testFile(f, t)
+
+	f, err = NewStream("sql", fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(testdata[:3])
+	f.Write(testdata[3:])
+	f.Close()
+	g, err := OpenStream("sql", fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := g.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ioutil.ReadAll(r); err != nil || !bytes.Equal(data, testdata) {
+		t.Errorf("Want/got: %q/%q, %v", testdata, data, err)
+	}
+	r.Close()
+	if err := f.Remove(); err != nil {
+		t.Error(err)
+	}
+	if _, err := fs.Open("sql"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected the File to be removed, got %v", err)
+	}
+}
+
+// fakeRedis is an in-memory RedisClient, which records the TTLs set.
+type fakeRedis struct {
+	mu   sync.Mutex
+	data map[string][]byte
+	ttls map[string]time.Duration
+}
+
+func (c *fakeRedis) Set(key string, value []byte, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.data[key], c.ttls[key] = value, ttl
+	return nil
+}
+
+func (c *fakeRedis) Append(key string, value []byte) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.data[key] = append(c.data[key], value...)
+	return int64(len(c.data[key])), nil
+}
+
+func (c *fakeRedis) GetRange(key string, start, end int64) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	data := c.data[key]
+	if start >= int64(len(data)) {
+		return nil, nil
+	}
+	if end >= int64(len(data)) {
+		end = int64(len(data)) - 1
+	}
+	return append([]byte(nil), data[start:end+1]...), nil
+}
+
+func (c *fakeRedis) StrLen(key string) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return int64(len(c.data[key])), nil
+}
+
+func (c *fakeRedis) Exists(key string) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.data[key]
+	return ok, nil
+}
+
+func (c *fakeRedis) Del(key string) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.data[key]
+	delete(c.data, key)
+	return ok, nil
+}
+
+func (c *fakeRedis) Expire(key string, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ttls[key] = ttl
+	return nil
+}
+
+func TestRedisFS(t *testing.T) {
+	c := &fakeRedis{data: make(map[string][]byte), ttls: make(map[string]time.Duration)}
+	fs := NewRedisFS(c, time.Minute)
+	f, err := NewStream("redis", fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.mu.Lock()
+	if c.ttls["redis"] != time.Minute {
+		t.Errorf("expected the File to expire, got ttl %v", c.ttls["redis"])
+	}
+	c.mu.Unlock()
+	testFile(f, t)
+	if _, err := fs.Open("redis"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected the File to be removed, got %v", err)
+	}
+}
+
+// xorCipher "encrypts" with a byte which depends on the nonce and the offset.
+type xorCipher struct{}
+
+func (xorCipher) NonceSize() int { return 1 }
+
+func (xorCipher) SealAt(dst, src, nonce []byte, off int64) error {
+	for i := range src {
+		dst[i] = src[i] ^ nonce[0] ^ byte(off+int64(i))
+	}
+	return nil
+}
+
+func (c xorCipher) OpenAt(dst, src, nonce []byte, off int64) error {
+	return c.SealAt(dst, src, nonce, off)
+}
+
+func TestCipherFS(t *testing.T) {
+	inner := NewMemFS()
+	fs := NewCipherFS(inner, xorCipher{})
+	f, err := NewStream("cipher", fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(testdata)
+	f.Close()
+
+	raw, err := inner.Open("cipher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, _ := ioutil.ReadAll(raw)
+	raw.Close()
+	if len(stored) != 1+len(testdata) || bytes.Equal(stored[1:], testdata) {
+		t.Errorf("expected a nonce and encrypted data, got %q", stored)
+	}
+
+	r, err := f.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 5)
+	if n, err := r.ReadAt(buf, 6); n != 5 || string(buf) != "world" {
+		t.Errorf("unexpected ReadAt %d, %v: %q", n, err, buf)
+	}
+	r.Close()
+	f.Remove()
+}
+
+// reverseCodec "compresses" blocks by reversing them.
+type reverseCodec struct{ name string }
+
+func (c reverseCodec) Name() string { return c.name }
+
+func (c reverseCodec) Compress(p []byte) ([]byte, error) {
+	out := make([]byte, len(p))
+	for i := range p {
+		out[len(p)-1-i] = p[i]
+	}
+	return out, nil
+}
+
+func (c reverseCodec) Decompress(p []byte) ([]byte, error) { return c.Compress(p) }
+
+func TestCodecFS(t *testing.T) {
+	inner := NewMemFS()
+	RegisterCodec(reverseCodec{"reverse"})
+	for _, name := range []string{"reverse", "unregistered"} {
+		f, err := NewStream(name, NewCodecFS(inner, 4, reverseCodec{name}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write(testdata)
+		f.Close()
+	}
+
+	// Opened through a FileSystem with another Codec, Files are decompressed by the Codec which compressed them.
+	fs := NewGzipFS(inner, 4)
+	f, err := OpenStream("reverse", fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := f.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ioutil.ReadAll(r); err != nil || !bytes.Equal(data, testdata) {
+		t.Errorf("Want/got: %q/%q, %v", testdata, data, err)
+	}
+	r.Close()
+	if _, err := fs.Open("unregistered"); !errors.Is(err, ErrUnknownCodec) {
+		t.Errorf("expected ErrUnknownCodec, got %v", err)
+	}
+}
+
+func TestChecksumFS(t *testing.T) {
+	inner := NewMemFS()
+	fs := NewChecksumFS(inner, 5)
+	f, err := NewStream("checksum", fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testFile(f, t)
+
+	f, err = NewStream("checksum", fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Remove()
+	f.Write(testdata)
+	f.Close()
+	cf, err := fs.Open("checksum")
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 20)
+	if n, err := cf.ReadAt(buf, 3); n != len(testdata)-3 || err != io.EOF || !bytes.Equal(buf[:n], testdata[3:]) {
+		t.Errorf("expected to read across chunks to the end, got %d, %v: %q", n, err, buf[:n])
+	}
+	cf.Close()
+
+	// flip a bit of the second chunk behind the back of fs
+	corrupt := append([]byte{}, testdata...)
+	corrupt[7] ^= 1
+	raw, err := inner.Create("checksum")
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw.Write(corrupt)
+	raw.Close()
+
+	s, err := OpenStream("checksum", fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := s.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	buf = make([]byte, 2)
+	if n, err := r.ReadAt(buf, 10); n != 2 || err != nil || string(buf) != "d\n" {
+		t.Errorf("expected to read an intact chunk, got %d, %v: %q", n, err, buf)
+	}
+	data, err := ioutil.ReadAll(r)
+	var cerr *CorruptError
+	if !errors.Is(err, ErrCorrupt) || !errors.As(err, &cerr) || cerr.Off != 5 || cerr.Len != 5 {
+		t.Fatalf("expected the chunk at offset 5 to be corrupt, got %v", err)
+	}
+	if string(data) != "hello" {
+		t.Errorf("expected the chunk before the corrupt one to be read, got %q", data)
+	}
+}
+
+func TestMerkleTree(t *testing.T) {
+	h := func(prefix byte, parts ...[]byte) []byte {
+		d := sha256.New()
+		d.Write([]byte{prefix})
+		for _, p := range parts {
+			d.Write(p)
+		}
+		return d.Sum(nil)
+	}
+	// chunks of 5: "hello", "\nworl", "d\n"
+	l0, l1, l2 := h(0, testdata[:5]), h(0, testdata[5:10]), h(0, testdata[10:])
+
+	f := NewMemStream(WithMerkleTree(5, sha256.New))
+	if root, size := f.MerkleRoot(); size != 0 || !bytes.Equal(root, sha256.New().Sum(nil)) {
+		t.Errorf("expected the root of an empty tree, got %x over %d bytes", root, size)
+	}
+	f.Write(testdata[:3])
+	f.Write(testdata[3:])
+	root, size := f.MerkleRoot()
+	if want := h(1, l0, l1); size != 10 || !bytes.Equal(root, want) {
+		t.Errorf("expected root %x over 10 bytes while open, got %x over %d", want, root, size)
+	}
+
+	// a client verifies the prefix it received
+	client := NewMerkleTree(5, sha256.New)
+	client.Write(testdata[:size])
+	client.Close()
+	if got, _ := client.Root(); !bytes.Equal(got, root) {
+		t.Errorf("expected the client to compute root %x, got %x", root, got)
+	}
+
+	f.Close()
+	root, size = f.MerkleRoot()
+	if want := h(1, h(1, l0, l1), l2); size != int64(len(testdata)) || !bytes.Equal(root, want) {
+		t.Errorf("expected root %x over %d bytes once Closed, got %x over %d", want, len(testdata), root, size)
+	}
+	if root, _ := NewMemStream().MerkleRoot(); root != nil {
+		t.Errorf("expected no root without WithMerkleTree, got %x", root)
+	}
+}
+
+func TestWriteTransform(t *testing.T) {
+	var order []string
+	compress := func(w io.Writer) io.WriteCloser {
+		zw, _ := flate.NewWriter(w, flate.BestSpeed)
+		return &closeRecorder{zw, func() { order = append(order, "compress") }}
+	}
+	passthrough := func(w io.Writer) io.WriteCloser {
+		return &closeRecorder{nopWriteCloser{w}, func() { order = append(order, "passthrough") }}
+	}
+	f := NewMemStream(WithWriteTransform(compress, passthrough))
+	r, err := f.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	for i := 0; i < 10; i++ {
+		f.Write(testdata)
+	}
+	f.Close()
+
+	stored, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size, _ := r.Size(); size != int64(len(stored)) {
+		t.Errorf("expected the size to be the %d bytes stored, got %d", len(stored), size)
+	}
+	data, err := ioutil.ReadAll(flate.NewReader(bytes.NewReader(stored)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, bytes.Repeat(testdata, 10)) {
+		t.Errorf("unexpected data %q", data)
+	}
+	if !reflect.DeepEqual(order, []string{"compress", "passthrough"}) {
+		t.Errorf("expected the transforms to Close in order, got %v", order)
+	}
+}
+
+type closeRecorder struct {
+	io.WriteCloser
+	closed func()
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed()
+	return c.WriteCloser.Close()
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+func TestReadTransform(t *testing.T) {
+	f := NewMemStream(
+		WithWriteTransform(func(w io.Writer) io.WriteCloser {
+			zw, _ := flate.NewWriter(w, flate.BestSpeed)
+			return zw
+		}),
+		WithReadTransform(func(r io.Reader) io.Reader { return flate.NewReader(r) }),
+	)
+	r, err := f.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	done := make(chan []byte)
+	go func() {
+		var buf bytes.Buffer
+		if _, err := io.Copy(&buf, r); err != nil {
+			t.Error(err)
+		}
+		done <- buf.Bytes()
+	}()
+	for i := 0; i < 10; i++ {
+		f.Write(testdata)
+	}
+	f.Close()
+	if data := <-done; !bytes.Equal(data, bytes.Repeat(testdata, 10)) {
+		t.Errorf("unexpected data %q", data)
+	}
+}
+
+func TestAudit(t *testing.T) {
+	var mu sync.Mutex
+	var events []AuditEvent
+	f, err := NewStream("audit", NewMemFS(), WithAudit(func(e AuditEvent) {
+		mu.Lock()
+		events = append(events, e)
+		mu.Unlock()
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(testdata[:6])
+	f.Write(testdata[6:])
+	r, err := f.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 5)
+	r.ReadAt(buf, 6)
+	r.ReadAt(buf[:2], 0)
+	r.Close()
+	f.Close()
+	f.Remove()
+
+	mu.Lock()
+	defer mu.Unlock()
+	var kinds []string
+	for _, e := range events {
+		kinds = append(kinds, e.Kind.String())
+		if e.Stream != "audit" || e.Time.IsZero() {
+			t.Errorf("expected the name and time of the Stream, got %+v", e)
+		}
+	}
+	want := []string{"write", "write", "reader opened", "reader closed", "close", "shutdown"}
+	if !reflect.DeepEqual(kinds, want) {
+		t.Fatalf("Want/got: %v/%v", want, kinds)
+	}
+	if e := events[1]; e.Off != 6 || e.Len != int64(len(testdata)-6) {
+		t.Errorf("unexpected write event %+v", e)
+	}
+	if e := events[3]; e.Reader != r || !reflect.DeepEqual(e.Read, []Extent{{0, 2}, {6, 5}}) {
+		t.Errorf("unexpected reader closed event %+v", e)
+	}
+	if e := events[5]; e.Err != ErrRemoving {
+		t.Errorf("expected the shutdown cause, got %v", e.Err)
+	}
+
+	events = nil
+	g := NewMemStream(WithAudit(func(e AuditEvent) { events = append(events, e) }))
+	g.Cancel()
+	if len(events) != 1 || events[0].Kind != AuditCancel || events[0].Err != ErrCanceled {
+		t.Errorf("expected a single cancel event, got %+v", events)
+	}
+}
+
+func TestPaced(t *testing.T) {
+	fs := NewMemFS()
+	f, err := NewStream("replay", fs, WithReplayIndex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(testdata[:6])
+	time.Sleep(40 * time.Millisecond)
+	f.Write(testdata[6:])
+	f.Close()
+	defer f.Remove()
+
+	r, err := f.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	p, err := r.Paced(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	buf := make([]byte, 64)
+	start := time.Now()
+	if n, err := p.Read(buf); err != nil || string(buf[:n]) != string(testdata[:6]) {
+		t.Errorf("expected the first Write, got %q, %v", buf[:n], err)
+	}
+	if n, err := p.Read(buf); err != nil || string(buf[:n]) != string(testdata[6:]) {
+		t.Errorf("expected the second Write, got %q, %v", buf[:n], err)
+	}
+	if elapsed := time.Since(start); elapsed < 15*time.Millisecond {
+		t.Errorf("expected the second Write to be released ~20ms in, got %v", elapsed)
+	}
+	if _, err := p.Read(buf); err != io.EOF {
+		t.Errorf("expected EOF, got %v", err)
+	}
+
+	g := NewMemStream()
+	gr, _ := g.NextReader()
+	defer gr.Close()
+	if _, err := gr.Paced(1); err == nil {
+		t.Error("expected a Stream with no replay index to fail")
+	}
+}
+
+func TestFill(t *testing.T) {
+	f := NewMemStream()
+	r, err := f.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if err := Fill(f, bytes.NewReader(testdata)); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ioutil.ReadAll(r); err != nil || !bytes.Equal(data, testdata) {
+		t.Errorf("Want/got: %q/%q, %v", testdata, data, err)
+	}
+
+	errBroken := errors.New("broken pipe")
+	f = NewMemStream()
+	r, err = f.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	src := io.MultiReader(bytes.NewReader(testdata), iotest.ErrReader(errBroken))
+	if err := Fill(f, src); err != errBroken {
+		t.Errorf("expected the read error, got %v", err)
+	}
+	if _, err := ioutil.ReadAll(r); !errors.Is(err, ErrCanceled) || !errors.Is(err, errBroken) {
+		t.Errorf("expected Reads to fail with the cause, got %v", err)
+	}
+}
@@ -0,0 +1,23 @@
+package stream
+
+import "io"
+
+// Streamer is the set of Stream methods used to Write and Read a Stream, implemented by *Stream.
+// Code which depends on a Streamer instead of a *Stream can be given a mock in its tests,
+// or an alternate implementation.
+type Streamer interface {
+	io.Writer
+	io.StringWriter
+	io.ReaderFrom
+	io.Closer
+
+	Name() string                   // The name of the File backing the Streamer
+	CloseWithError(err error) error // Close, but Readers get err instead of io.EOF at the end
+	Cancel() error                  // Forcibly end the Streamer, failing Reads and NextReader
+	ShutdownWithErr(err error)      // Make NextReader return err, and wait for all handles to Close
+	Remove() error                  // Wait for all handles to Close, then delete the File
+	Cause() error                   // Why the Streamer ended, nil while it's open
+	NextReader() (*Reader, error)   // A new Reader from the start of the Streamer
+}
+
+var _ Streamer = (*Stream)(nil)
@@ -0,0 +1,32 @@
+package stream
+
+import "io/fs"
+
+// NewStreamFS returns a read-only fs.FS of Streams, so that Streams can be consumed by anything
+// accepting an fs.FS (ex. http.FS or template.ParseFS). lookup returns the Stream for a name,
+// or false if there is none. Open returns a new Reader of the Stream, but only once the Stream
+// is Closed unless inFlight is true, in which case Reads block for Writes as usual.
+// Canceled Streams don't exist. The fs.FS has no directories, so it can't be walked.
+func NewStreamFS(lookup func(name string) (*Stream, bool), inFlight bool) fs.FS {
+	return &streamFS{lookup: lookup, inFlight: inFlight}
+}
+
+type streamFS struct {
+	lookup   func(name string) (*Stream, bool)
+	inFlight bool
+}
+
+func (sfs *streamFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	s, ok := sfs.lookup(name)
+	if !ok || s.b.Canceled() || (!sfs.inFlight && s.b.IsOpen()) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	r, err := s.NextReader()
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return r, nil
+}
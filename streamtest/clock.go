@@ -0,0 +1,75 @@
+package streamtest
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the time and sleeps, so the latency a FaultFS injects can be controlled by a FakeClock.
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+}
+
+// RealClock is the Clock of the time package.
+var RealClock Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time        { return time.Now() }
+func (realClock) Sleep(d time.Duration) { time.Sleep(d) }
+
+// FakeClock is a Clock whose time only moves when Advance is called.
+// Sleep blocks until the FakeClock has been Advanced past the end of the sleep.
+type FakeClock struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	now      time.Time
+	sleepers int // goroutines blocked in Sleep
+}
+
+// NewFakeClock returns a FakeClock set to start.
+func NewFakeClock(start time.Time) *FakeClock {
+	c := &FakeClock{now: start}
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+// Now returns the time of the FakeClock.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Sleep blocks until the FakeClock has been Advanced by d.
+func (c *FakeClock) Sleep(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	end := c.now.Add(d)
+	c.sleepers++
+	c.cond.Broadcast()
+	for c.now.Before(end) {
+		c.cond.Wait()
+	}
+	c.sleepers--
+	c.cond.Broadcast()
+}
+
+// Advance moves the FakeClock forward by d, waking the Sleeps which have ended.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	c.cond.Broadcast()
+}
+
+// BlockUntil waits until n goroutines are blocked in Sleep, so a test can Advance the
+// FakeClock once the operations it expects to sleep have started.
+func (c *FakeClock) BlockUntil(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for c.sleepers < n {
+		c.cond.Wait()
+	}
+}
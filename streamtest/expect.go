@@ -0,0 +1,37 @@
+package streamtest
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/djherbis/stream"
+)
+
+// ExpectNoLeakedHandles fails t if any File Created or Opened through fs hasn't been Closed.
+func ExpectNoLeakedHandles(t testing.TB, fs *FaultFS) {
+	t.Helper()
+	if open := fs.OpenFiles(); len(open) > 0 {
+		t.Errorf("%d leaked file handles: %q", len(open), open)
+	}
+}
+
+// ExpectContents fails t unless a new Reader of s reads want, up to the end of s.
+// It blocks until s is Closed.
+func ExpectContents(t testing.TB, s *stream.Stream, want []byte) {
+	t.Helper()
+	r, err := s.NextReader()
+	if err != nil {
+		t.Errorf("NextReader: %v", err)
+		return
+	}
+	defer r.Close()
+	got, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Errorf("reading %q: %v", s.Name(), err)
+		return
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("read %q from %q, expected %q", got, s.Name(), want)
+	}
+}
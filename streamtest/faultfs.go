@@ -0,0 +1,256 @@
+// Package streamtest provides a FileSystem that injects errors and latency, a fake Clock,
+// and assertions for testing code that uses the stream package.
+package streamtest
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/djherbis/stream"
+)
+
+// Op is an operation of a FileSystem or File a Fault can be injected into.
+type Op string
+
+// The Ops of a FaultFS and its Files.
+const (
+	OpCreate Op = "create"
+	OpOpen   Op = "open"
+	OpRemove Op = "remove"
+	OpRename Op = "rename"
+	OpRead   Op = "read"
+	OpReadAt Op = "readat"
+	OpWrite  Op = "write"
+	OpClose  Op = "close"
+)
+
+// Fault describes how a FaultFS fails an Op.
+type Fault struct {
+	Err     error         // returned instead of doing the Op, nil to do it anyway
+	Latency time.Duration // slept on the Clock of the FaultFS before the Op
+	Name    string        // only fault the File with this name, "" for every File
+	After   int           // let this many matching Ops succeed before faulting
+	Times   int           // fault this many Ops, 0 for every Op after the first After
+}
+
+type fault struct {
+	Fault
+	seen int // matching Ops so far
+}
+
+// apply reports whether the Op on name is faulted, f.seen is updated.
+func (f *fault) apply(name string) bool {
+	if f.Name != "" && f.Name != name {
+		return false
+	}
+	f.seen++
+	if f.seen <= f.After {
+		return false
+	}
+	return f.Times == 0 || f.seen <= f.After+f.Times
+}
+
+// FaultFS is a FileSystem which injects Faults into the Ops of an inner FileSystem and its Files,
+// and tracks the Files which are still open.
+type FaultFS struct {
+	inner stream.FileSystem
+	clock Clock
+
+	mu     sync.Mutex
+	faults map[Op][]*fault
+	open   map[*faultFile]struct{}
+}
+
+// NewFaultFS returns a FaultFS over inner, which sleeps on clock to inject latency.
+// If clock is nil, RealClock is used.
+func NewFaultFS(inner stream.FileSystem, clock Clock) *FaultFS {
+	if clock == nil {
+		clock = RealClock
+	}
+	return &FaultFS{
+		inner:  inner,
+		clock:  clock,
+		faults: make(map[Op][]*fault),
+		open:   make(map[*faultFile]struct{}),
+	}
+}
+
+// Inject adds a Fault to op. When several Faults match an Op, their Latency adds up and
+// the first Err injected is returned.
+func (fs *FaultFS) Inject(op Op, f Fault) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.faults[op] = append(fs.faults[op], &fault{Fault: f})
+}
+
+// Reset removes every injected Fault.
+func (fs *FaultFS) Reset() {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.faults = make(map[Op][]*fault)
+}
+
+// OpenFiles returns the sorted names of the Files which were Created or Opened, and not yet Closed.
+// A name appears once per open File.
+func (fs *FaultFS) OpenFiles() []string {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	names := make([]string, 0, len(fs.open))
+	for f := range fs.open {
+		names = append(names, f.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+// inject applies the Faults of op on name, and returns the error to fail the Op with.
+func (fs *FaultFS) inject(op Op, name string) error {
+	var latency time.Duration
+	var err error
+	fs.mu.Lock()
+	for _, f := range fs.faults[op] {
+		if !f.apply(name) {
+			continue
+		}
+		latency += f.Latency
+		if err == nil {
+			err = f.Err
+		}
+	}
+	fs.mu.Unlock()
+
+	if latency > 0 {
+		fs.clock.Sleep(latency)
+	}
+	return err
+}
+
+func (fs *FaultFS) track(f stream.File) stream.File {
+	ff := &faultFile{File: f, fs: fs}
+	fs.mu.Lock()
+	fs.open[ff] = struct{}{}
+	fs.mu.Unlock()
+	return ff
+}
+
+// Create Creates name in the inner FileSystem, unless OpCreate is faulted.
+func (fs *FaultFS) Create(name string) (stream.File, error) {
+	return fs.CreateContext(context.Background(), name)
+}
+
+// CreateContext is Create, passing ctx on to the inner FileSystem if it's a stream.FileSystemContext.
+func (fs *FaultFS) CreateContext(ctx context.Context, name string) (stream.File, error) {
+	if err := fs.inject(OpCreate, name); err != nil {
+		return nil, err
+	}
+	var f stream.File
+	var err error
+	if inner, ok := fs.inner.(stream.FileSystemContext); ok {
+		f, err = inner.CreateContext(ctx, name)
+	} else {
+		f, err = fs.inner.Create(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return fs.track(f), nil
+}
+
+// Open Opens name in the inner FileSystem, unless OpOpen is faulted.
+func (fs *FaultFS) Open(name string) (stream.File, error) {
+	return fs.OpenContext(context.Background(), name)
+}
+
+// OpenContext is Open, passing ctx on to the inner FileSystem if it's a stream.FileSystemContext.
+func (fs *FaultFS) OpenContext(ctx context.Context, name string) (stream.File, error) {
+	if err := fs.inject(OpOpen, name); err != nil {
+		return nil, err
+	}
+	var f stream.File
+	var err error
+	if inner, ok := fs.inner.(stream.FileSystemContext); ok {
+		f, err = inner.OpenContext(ctx, name)
+	} else {
+		f, err = fs.inner.Open(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return fs.track(f), nil
+}
+
+// Remove Removes name from the inner FileSystem, unless OpRemove is faulted.
+func (fs *FaultFS) Remove(name string) error {
+	return fs.RemoveContext(context.Background(), name)
+}
+
+// RemoveContext is Remove, passing ctx on to the inner FileSystem if it's a stream.FileSystemContext.
+func (fs *FaultFS) RemoveContext(ctx context.Context, name string) error {
+	if err := fs.inject(OpRemove, name); err != nil {
+		return err
+	}
+	if inner, ok := fs.inner.(stream.FileSystemContext); ok {
+		return inner.RemoveContext(ctx, name)
+	}
+	return fs.inner.Remove(name)
+}
+
+// Rename Renames oldname in the inner FileSystem, unless OpRename is faulted for oldname.
+// It returns stream.ErrUnsupported if the inner FileSystem isn't a stream.Renamer.
+func (fs *FaultFS) Rename(oldname, newname string) error {
+	inner, ok := fs.inner.(stream.Renamer)
+	if !ok {
+		return stream.ErrUnsupported
+	}
+	if err := fs.inject(OpRename, oldname); err != nil {
+		return err
+	}
+	return inner.Rename(oldname, newname)
+}
+
+type faultFile struct {
+	stream.File
+	fs *FaultFS
+}
+
+func (f *faultFile) Read(p []byte) (int, error) {
+	if err := f.fs.inject(OpRead, f.Name()); err != nil {
+		return 0, err
+	}
+	return f.File.Read(p)
+}
+
+func (f *faultFile) ReadAt(p []byte, off int64) (int, error) {
+	if err := f.fs.inject(OpReadAt, f.Name()); err != nil {
+		return 0, err
+	}
+	return f.File.ReadAt(p, off)
+}
+
+func (f *faultFile) Write(p []byte) (int, error) {
+	return f.WriteContext(context.Background(), p)
+}
+
+func (f *faultFile) WriteContext(ctx context.Context, p []byte) (int, error) {
+	if err := f.fs.inject(OpWrite, f.Name()); err != nil {
+		return 0, err
+	}
+	if w, ok := f.File.(stream.WriterContext); ok {
+		return w.WriteContext(ctx, p)
+	}
+	return f.File.Write(p)
+}
+
+// Close always Closes the File, so a faulted Close doesn't leak it, but returns the injected error.
+func (f *faultFile) Close() error {
+	ierr := f.fs.inject(OpClose, f.Name())
+	f.fs.mu.Lock()
+	delete(f.fs.open, f)
+	f.fs.mu.Unlock()
+	if err := f.File.Close(); err != nil {
+		return err
+	}
+	return ierr
+}
@@ -0,0 +1,84 @@
+package streamtest
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/djherbis/stream"
+)
+
+func TestFaultFS(t *testing.T) {
+	errWrite := errors.New("disk full")
+	fs := NewFaultFS(stream.NewMemFS(), nil)
+	fs.Inject(OpWrite, Fault{Err: errWrite, After: 1, Times: 1})
+
+	s, err := stream.NewStream("faulty", fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Write([]byte("hello\n")); err != nil {
+		t.Fatalf("first Write faulted: %v", err)
+	}
+	if _, err := s.Write([]byte("lost\n")); !errors.Is(err, errWrite) {
+		t.Fatalf("expected %v from the second Write, got %v", errWrite, err)
+	}
+	if _, err := s.Write([]byte("world\n")); err != nil {
+		t.Fatalf("third Write faulted: %v", err)
+	}
+	s.Close()
+	ExpectContents(t, s, []byte("hello\nworld\n"))
+
+	if err := s.Remove(); err != nil {
+		t.Fatal(err)
+	}
+	ExpectNoLeakedHandles(t, fs)
+}
+
+func TestFaultFSLatency(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	fs := NewFaultFS(stream.NewMemFS(), clock)
+	fs.Inject(OpOpen, Fault{Latency: time.Minute, Name: "slow"})
+
+	s, err := stream.NewStream("slow", fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Write([]byte("hello\n"))
+	s.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ExpectContents(t, s, []byte("hello\n"))
+	}()
+
+	clock.BlockUntil(1)
+	clock.Advance(30 * time.Second)
+	select {
+	case <-done:
+		t.Fatal("Open returned before its latency passed")
+	case <-time.After(10 * time.Millisecond):
+	}
+	clock.Advance(30 * time.Second)
+	<-done
+
+	if got := clock.Now(); !got.Equal(time.Unix(60, 0)) {
+		t.Errorf("expected the clock at 1m, got %v", got)
+	}
+	s.Remove()
+	ExpectNoLeakedHandles(t, fs)
+}
+
+func TestExpectNoLeakedHandles(t *testing.T) {
+	fs := NewFaultFS(stream.NewMemFS(), nil)
+	f, err := fs.Create("leaky")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if open := fs.OpenFiles(); len(open) != 1 || open[0] != "leaky" {
+		t.Errorf("expected leaky to be open, got %q", open)
+	}
+	f.Close()
+	ExpectNoLeakedHandles(t, fs)
+}
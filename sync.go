@@ -1,10 +1,14 @@
 package stream
 
 import (
+	"context"
 	"errors"
 	"io"
 	"os"
+	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // ErrRemoving is returned when requesting a Reader on a Stream which is being Removed.
@@ -13,6 +17,13 @@ var ErrRemoving = errors.New("cannot open a new reader while removing file")
 // ErrCanceled indicates that stream has been canceled.
 var ErrCanceled = errors.New("stream has been canceled")
 
+// cancelError is returned instead of ErrCanceled when a stream is canceled with a cause.
+type cancelError struct{ cause error }
+
+func (e *cancelError) Error() string        { return ErrCanceled.Error() + ": " + e.cause.Error() }
+func (e *cancelError) Is(target error) bool { return target == ErrCanceled }
+func (e *cancelError) Unwrap() error        { return e.cause }
+
 type streamState int
 
 const (
@@ -25,10 +36,25 @@ type broadcaster struct {
 	mu           sync.RWMutex
 	cond         *sync.Cond
 	state        streamState
+	cancelErr    error // ErrCanceled, or a *cancelError wrapping the cause
 	size         int64
 	newHandleErr error
 	rs           *readerSet
 	fileInUse    sync.WaitGroup
+	handles      int           // count of fileInUse
+	writerClosed bool          // the writer's handle has been dropped
+	onZero       func()        // called once the writer and all Readers are closed, nil if disabled
+	linger       time.Duration // how long there must be zero handles before calling onZero
+	lingerTimer  *time.Timer
+	lingerGen    int        // identifies the current lingerTimer
+	subs         []rangeSub // pending NotifyAvailable subscriptions, sorted by end
+	closed       bool       // the stream was Closed without being Canceled first
+	closeErr     error      // returned instead of io.EOF at the end of the stream, nil for io.EOF
+	onClose      []func()
+	onCancel     []func(err error)
+	window       int64 // max bytes the slowest Reader may fall behind before Writes block, 0 if unbounded
+	lagMark      int64 // bytes a Reader may fall behind before onLag is called
+	onLag        func(r *Reader, behind bool)
 }
 
 func newBroadcaster() *broadcaster {
@@ -39,18 +65,23 @@ func newBroadcaster() *broadcaster {
 	return &b
 }
 
-// Wait blocks until we've written past the given offset, or until closed.
-func (b *broadcaster) Wait(r *Reader, off int64) error {
+// Wait blocks until we've written past the given offset, or until closed, or ctx is done.
+func (b *broadcaster) Wait(ctx context.Context, r *Reader, off int64) error {
 	b.mu.RLock()
 	defer b.mu.RUnlock()
 
-	for b.state == openState && off >= b.size && b.rs.has(r) {
+	if b.state == openState && off >= b.size && b.rs.has(r) {
+		defer r.stats.block(off)()
+		defer b.watch(ctx)()
+	}
+	for b.state == openState && off >= b.size && b.rs.has(r) && ctx.Err() == nil {
 		b.cond.Wait()
+		r.stats.woke()
 	}
 
 	switch b.state {
 	case canceledState:
-		return ErrCanceled
+		return b.cancelErr
 
 	case closedState:
 		if off >= b.size {
@@ -62,41 +93,324 @@ func (b *broadcaster) Wait(r *Reader, off int64) error {
 		return os.ErrClosed
 	}
 
+	if off >= b.size {
+		return ctx.Err()
+	}
+	return nil
+}
+
+// watch wakes up waiters once ctx is done, until the returned func is called.
+func (b *broadcaster) watch(ctx context.Context) (stop func()) {
+	if ctx.Done() == nil {
+		return func() {}
+	}
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			// waiters check ctx under the lock, so this can't Broadcast between their check and Wait
+			b.mu.Lock()
+			b.mu.Unlock()
+			b.cond.Broadcast()
+		case <-done:
+		}
+	}()
+	return func() { close(done) }
+}
+
+// WaitForSize blocks until at least n bytes have been written, or until closed, or ctx is done.
+// If r is non-nil, it also stops waiting if r is closed.
+func (b *broadcaster) WaitForSize(ctx context.Context, r *Reader, n int64) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if b.state == openState && b.size < n && (r == nil || b.rs.has(r)) {
+		if r != nil {
+			defer r.stats.block(n)()
+		}
+		defer b.watch(ctx)()
+	}
+	for b.state == openState && b.size < n && (r == nil || b.rs.has(r)) && ctx.Err() == nil {
+		b.cond.Wait()
+		if r != nil {
+			r.stats.woke()
+		}
+	}
+
+	switch {
+	case b.state == canceledState:
+		return b.cancelErr
+
+	case r != nil && !b.rs.has(r):
+		return os.ErrClosed
+
+	case b.size >= n:
+		return nil
+
+	case b.state == openState:
+		return ctx.Err()
+	}
+	return io.ErrUnexpectedEOF
+}
+
+type rangeSub struct {
+	end int64
+	ch  chan error
+}
+
+// NotifyAvailable returns a channel which receives nil once end bytes have been written,
+// or the error that means they never will be.
+func (b *broadcaster) NotifyAvailable(end int64) <-chan error {
+	sub := rangeSub{end: end, ch: make(chan error, 1)}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	i := sort.Search(len(b.subs), func(i int) bool { return b.subs[i].end > end })
+	b.subs = append(b.subs, rangeSub{})
+	copy(b.subs[i+1:], b.subs[i:])
+	b.subs[i] = sub
+	b.notifySubs()
+	return sub.ch
+}
+
+// notifySubs delivers to subscriptions which are satisfied, or never will be. b.mu must be held.
+func (b *broadcaster) notifySubs() {
+	switch b.state {
+	case canceledState:
+		for _, sub := range b.subs {
+			sub.ch <- b.cancelErr
+		}
+		b.subs = nil
+
+	case closedState:
+		for _, sub := range b.subs {
+			if sub.end <= b.size {
+				sub.ch <- nil
+			} else {
+				sub.ch <- io.ErrUnexpectedEOF
+			}
+		}
+		b.subs = nil
+
+	default:
+		i := sort.Search(len(b.subs), func(i int) bool { return b.subs[i].end > b.size })
+		for _, sub := range b.subs[:i] {
+			sub.ch <- nil
+		}
+		b.subs = b.subs[i:]
+	}
+}
+
+// WaitForReaders blocks while the slowest Reader is more than window bytes behind, until closed,
+// or until ctx is done, returning ctx.Err().
+func (b *broadcaster) WaitForReaders(ctx context.Context) error {
+	if b.window <= 0 {
+		return nil
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if b.state == openState && b.lag() > b.window {
+		defer b.watch(ctx)()
+	}
+	for b.state == openState && b.lag() > b.window && ctx.Err() == nil {
+		b.cond.Wait()
+	}
+	if b.state == openState && b.lag() > b.window {
+		return ctx.Err()
+	}
 	return nil
 }
 
+// lag returns how many bytes the slowest Reader is behind, b.mu must be held.
+func (b *broadcaster) lag() (lag int64) {
+	for r := range *b.rs {
+		if l := b.readerLag(r); l > lag {
+			lag = l
+		}
+	}
+	return lag
+}
+
+// readerLag returns how many bytes r has yet to Read of what has been written, b.mu must be held.
+// A bounded Reader is never behind on bytes past its limit.
+func (b *broadcaster) readerLag(r *Reader) int64 {
+	end := b.size
+	if r.bounded && r.limit < end {
+		end = r.limit
+	}
+	return end - r.pos
+}
+
+// Advance records that r has Read up to off. Positions are only tracked for backpressure
+// and lag watermarks, so this is a no-op otherwise.
+func (b *broadcaster) Advance(r *Reader, off int64) {
+	atomic.StoreInt64(&r.stats.off, off)
+	if b.window <= 0 && b.onLag == nil {
+		return
+	}
+
+	b.mu.Lock()
+	r.pos = off
+	changed := b.updateLag(r)
+	behind := r.behind
+	b.mu.Unlock()
+
+	if b.window > 0 {
+		b.cond.Broadcast()
+	}
+	if changed {
+		b.onLag(r, behind)
+	}
+}
+
+// updateLag records whether r is past the lag watermark, and reports if that changed. b.mu must be held.
+func (b *broadcaster) updateLag(r *Reader) bool {
+	if b.onLag == nil {
+		return false
+	}
+	behind := b.readerLag(r) > b.lagMark
+	if behind == r.behind {
+		return false
+	}
+	r.behind = behind
+	return true
+}
+
 func (b *broadcaster) Wrote(n int) {
 	if n > 0 {
+		var fellBehind []*Reader
 		b.mu.Lock()
 		b.size += int64(n)
+		b.notifySubs()
+		for r := range *b.rs {
+			if b.updateLag(r) {
+				fellBehind = append(fellBehind, r)
+			}
+		}
 		b.mu.Unlock()
 		b.cond.Broadcast()
+
+		for _, r := range fellBehind {
+			b.onLag(r, true)
+		}
 	}
 }
 
 func (b *broadcaster) Close() (err error) {
 	b.mu.Lock()
 	b.setState(closedState)
+	b.notifySubs()
+	b.writerClosed = true
+	var onClose []func()
+	if b.state == closedState && !b.closed {
+		b.closed = true
+		onClose, b.onClose = b.onClose, nil
+	}
 	b.mu.Unlock()
 
+	for _, fn := range onClose {
+		fn()
+	}
+
 	b.dropHandle()
 	return nil
 }
 
-func (b *broadcaster) Cancel() (err error) {
+// Cancel cancels the stream, if cause is non-nil it's wrapped by the errors returned to Readers.
+func (b *broadcaster) Cancel(cause error) (err error) {
 	b.mu.Lock()
+	var onCancel []func(error)
+	if b.state != canceledState {
+		b.cancelErr = ErrCanceled
+		if cause != nil {
+			b.cancelErr = &cancelError{cause: cause}
+		}
+		onCancel, b.onCancel = b.onCancel, nil
+		b.onClose = nil
+	}
 	b.setState(canceledState)
-	b.preventNewHandles(ErrCanceled)
+	b.notifySubs()
+	b.preventNewHandles(b.cancelErr)
 	readersToClose := b.rs.dropAll()
 	b.mu.Unlock()
 
 	for _, r := range readersToClose {
 		r.Close()
 	}
+	for _, fn := range onCancel {
+		fn(b.cancelErr)
+	}
 
 	return nil
 }
 
+// Cause returns why the stream ended, see Stream.Cause.
+func (b *broadcaster) Cause() error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	switch {
+	case b.state == canceledState:
+		if ce, ok := b.cancelErr.(*cancelError); ok {
+			return ce.cause
+		}
+		return ErrCanceled
+
+	case b.state == closedState && b.closeErr != nil:
+		return b.closeErr
+	}
+	return b.newHandleErr
+}
+
+// SetCloseErr sets the error returned instead of io.EOF at the end of the stream, unless it's already Closed.
+func (b *broadcaster) SetCloseErr(err error) {
+	b.mu.Lock()
+	if b.state == openState {
+		b.closeErr = err
+	}
+	b.mu.Unlock()
+}
+
+// EOF returns the error for reading at the end of a Closed stream.
+func (b *broadcaster) EOF() error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closeErr != nil {
+		return b.closeErr
+	}
+	return io.EOF
+}
+
+// OnClose calls fn once the stream is Closed, or right away if it already has been.
+// fn is never called if the stream is Canceled before it's Closed.
+func (b *broadcaster) OnClose(fn func()) {
+	b.mu.Lock()
+	switch {
+	case b.closed:
+		b.mu.Unlock()
+		fn()
+	case b.state == canceledState:
+		b.mu.Unlock()
+	default:
+		b.onClose = append(b.onClose, fn)
+		b.mu.Unlock()
+	}
+}
+
+// OnCancel calls fn with the cancel error once the stream is Canceled, or right away if it already has been.
+func (b *broadcaster) OnCancel(fn func(err error)) {
+	b.mu.Lock()
+	if b.state == canceledState {
+		err := b.cancelErr
+		b.mu.Unlock()
+		fn(err)
+		return
+	}
+	b.onCancel = append(b.onCancel, fn)
+	b.mu.Unlock()
+}
+
 func (b *broadcaster) PreventNewHandles(err error) {
 	b.mu.Lock()
 	b.preventNewHandles(err)
@@ -117,8 +431,9 @@ func (b *broadcaster) UseHandle(do func() (int, error)) (int, error) {
 	b.mu.RLock()
 	switch b.state {
 	case canceledState:
+		err := b.cancelErr
 		b.mu.RUnlock()
-		return 0, ErrCanceled
+		return 0, err
 	}
 	b.mu.RUnlock()
 
@@ -138,6 +453,20 @@ func (b *broadcaster) setState(s streamState) {
 	}
 }
 
+// IsOpen reports whether the stream has been neither closed nor canceled.
+func (b *broadcaster) IsOpen() bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.state == openState
+}
+
+// Canceled reports whether the stream has been canceled.
+func (b *broadcaster) Canceled() bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.state == canceledState
+}
+
 func (b *broadcaster) Size() (size int64, isClosed bool) {
 	b.mu.RLock()
 	size = b.size
@@ -146,18 +475,91 @@ func (b *broadcaster) Size() (size int64, isClosed bool) {
 	return size, isClosed
 }
 
-func (b *broadcaster) addHandle() error {
+// Readers returns the open Readers.
+func (b *broadcaster) Readers() []*Reader {
 	b.mu.RLock()
 	defer b.mu.RUnlock()
+	readers := make([]*Reader, 0, len(*b.rs))
+	for r := range *b.rs {
+		readers = append(readers, r)
+	}
+	return readers
+}
+
+// State describes the state of the stream: "open", "closed" or "canceled".
+func (b *broadcaster) State() string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	switch b.state {
+	case closedState:
+		return "closed"
+	case canceledState:
+		return "canceled"
+	}
+	return "open"
+}
+
+// Handles returns the number of open Reader handles, and whether the writer's handle is still open.
+func (b *broadcaster) Handles() (readers int, writerOpen bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	readers = b.handles
+	if !b.writerClosed {
+		readers--
+	}
+	return readers, !b.writerClosed
+}
+
+func (b *broadcaster) addHandle() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
 	if b.newHandleErr != nil {
 		return b.newHandleErr
 	}
 
+	b.handles++
 	b.fileInUse.Add(1)
+	if b.lingerTimer != nil {
+		b.lingerTimer.Stop()
+		b.lingerTimer = nil
+	}
 	return nil
 }
 
-func (b *broadcaster) dropHandle() { b.fileInUse.Done() }
+func (b *broadcaster) dropHandle() {
+	b.mu.Lock()
+	b.handles--
+	zero := b.handles == 0 && b.onZero != nil
+	if zero && b.linger > 0 {
+		b.lingerGen++
+		gen := b.lingerGen
+		b.lingerTimer = time.AfterFunc(b.linger, func() { b.lingerExpired(gen) })
+		zero = false
+	} else if zero {
+		// once the last handle is gone, the File is going away
+		b.preventNewHandles(ErrRemoving)
+	}
+	b.mu.Unlock()
+
+	b.fileInUse.Done()
+	if zero {
+		b.onZero()
+	}
+}
+
+// lingerExpired calls onZero if there have been no handles since timer gen was started.
+func (b *broadcaster) lingerExpired(gen int) {
+	b.mu.Lock()
+	expired := gen == b.lingerGen && b.handles == 0 && b.newHandleErr == nil
+	if expired {
+		b.preventNewHandles(ErrRemoving)
+	}
+	b.mu.Unlock()
+
+	if expired {
+		b.onZero()
+	}
+}
 
 func (b *broadcaster) NewReader(createReader func() (*Reader, error)) (*Reader, error) {
 	if err := b.addHandle(); err != nil {
@@ -213,15 +615,17 @@ var (
 )
 
 type sizeOnce struct {
-	once sync.Once
-	size int64
-	err  error
+	once  sync.Once
+	size  int64
+	err   error
+	isSet int32 // 1 once size is set, see peek
 }
 
 func (s *sizeOnce) set(size int64) error {
 	err := errSeekEndAlreadySet
 	s.once.Do(func() {
 		s.size = size
+		atomic.StoreInt32(&s.isSet, 1)
 		err = nil
 	})
 	if s.err != nil {
@@ -230,6 +634,14 @@ func (s *sizeOnce) set(size int64) error {
 	return err
 }
 
+// peek returns the size if it has been set, or -1, without preventing it from being set later like read.
+func (s *sizeOnce) peek() int64 {
+	if atomic.LoadInt32(&s.isSet) == 0 {
+		return -1
+	}
+	return s.size
+}
+
 func (s *sizeOnce) read() int64 {
 	s.once.Do(func() {
 		s.err = errSetAfterSeek
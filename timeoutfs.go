@@ -0,0 +1,197 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// TimeoutError is returned by a FileSystem from NewTimeoutFS, and its Files, when a call on the
+// underlying FileSystem doesn't return in time.
+type TimeoutError struct {
+	Op    string        // the operation, ex. "create", "open", "remove", "read", "write" or "close"
+	Name  string        // the name of the File
+	Limit time.Duration // how long the operation was given
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("stream: %s %s: timed out after %v", e.Op, e.Name, e.Limit)
+}
+
+// Is reports os.ErrDeadlineExceeded as the cause of a TimeoutError, like *os.File deadlines do.
+func (e *TimeoutError) Is(target error) bool { return target == os.ErrDeadlineExceeded }
+
+// Timeout is always true, so a TimeoutError matches net.Error and similar interfaces.
+func (e *TimeoutError) Timeout() bool { return true }
+
+// NewTimeoutFS returns a FileSystem which bounds each call on inner, and on its Files, to timeout,
+// so one stuck call (ex. on a hung NFS mount) can't block a Stream forever. A call which times out
+// returns a *TimeoutError and is left to finish in the background, so a File is unusable after one
+// of its calls timed out, and returns the *TimeoutError from every later call but Close. The buffer
+// of a Read or Write which timed out may still be used by the call, so it shouldn't be reused.
+// If inner is a FileSystemContext, or its Files are WriterContexts, the context they're given is
+// bounded by timeout too, so the call can be canceled rather than left to finish.
+func NewTimeoutFS(inner FileSystem, timeout time.Duration) FileSystem {
+	return &timeoutFS{inner: inner, timeout: timeout}
+}
+
+type timeoutFS struct {
+	inner   FileSystem
+	timeout time.Duration
+}
+
+// withTimeout returns the result of op, or a *TimeoutError if it doesn't return within timeout.
+// If op returns late, late is called with its result so it can be cleaned up.
+func withTimeout[T any](timeout time.Duration, op, name string, call func() (T, error), late func(T)) (T, error) {
+	type result struct {
+		v   T
+		err error
+	}
+	done := make(chan result, 1)
+	var mu sync.Mutex
+	timedOut := false
+	go func() {
+		v, err := call()
+		mu.Lock()
+		defer mu.Unlock()
+		if timedOut {
+			if late != nil && err == nil {
+				late(v)
+			}
+			return
+		}
+		done <- result{v, err}
+	}()
+
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+	select {
+	case res := <-done:
+		return res.v, res.err
+	case <-t.C:
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	select {
+	case res := <-done:
+		return res.v, res.err
+	default:
+	}
+	timedOut = true
+	var zero T
+	return zero, &TimeoutError{Op: op, Name: name, Limit: timeout}
+}
+
+func closeLate(f File) { f.Close() }
+
+func (fs *timeoutFS) Create(name string) (File, error) {
+	return fs.CreateContext(context.Background(), name)
+}
+
+func (fs *timeoutFS) CreateContext(ctx context.Context, name string) (File, error) {
+	ctx, cancel := context.WithTimeout(ctx, fs.timeout)
+	defer cancel()
+	f, err := withTimeout(fs.timeout, "create", name, func() (File, error) { return createContext(ctx, fs.inner, name) }, closeLate)
+	if err != nil {
+		return nil, err
+	}
+	return &timeoutFile{File: f, name: name, timeout: fs.timeout}, nil
+}
+
+func (fs *timeoutFS) Open(name string) (File, error) {
+	return fs.OpenContext(context.Background(), name)
+}
+
+func (fs *timeoutFS) OpenContext(ctx context.Context, name string) (File, error) {
+	ctx, cancel := context.WithTimeout(ctx, fs.timeout)
+	defer cancel()
+	f, err := withTimeout(fs.timeout, "open", name, func() (File, error) { return openContext(ctx, fs.inner, name) }, closeLate)
+	if err != nil {
+		return nil, err
+	}
+	return &timeoutFile{File: f, name: name, timeout: fs.timeout}, nil
+}
+
+func (fs *timeoutFS) Remove(name string) error {
+	return fs.RemoveContext(context.Background(), name)
+}
+
+func (fs *timeoutFS) RemoveContext(ctx context.Context, name string) error {
+	ctx, cancel := context.WithTimeout(ctx, fs.timeout)
+	defer cancel()
+	_, err := withTimeout(fs.timeout, "remove", name, func() (struct{}, error) { return struct{}{}, removeContext(ctx, fs.inner, name) }, nil)
+	return err
+}
+
+func (fs *timeoutFS) Rename(oldname, newname string) error {
+	inner, ok := fs.inner.(Renamer)
+	if !ok {
+		return ErrUnsupported
+	}
+	_, err := withTimeout(fs.timeout, "rename", oldname, func() (struct{}, error) { return struct{}{}, inner.Rename(oldname, newname) }, nil)
+	return err
+}
+
+func (fs *timeoutFS) canRename() bool { return canRename(fs.inner) }
+
+func (fs *timeoutFS) syncDir(name string) error {
+	_, err := withTimeout(fs.timeout, "sync", name, func() (struct{}, error) { return struct{}{}, syncDir(fs.inner, name) }, nil)
+	return err
+}
+
+type timeoutFile struct {
+	File
+	name    string
+	timeout time.Duration
+
+	mu     sync.Mutex
+	broken error // the *TimeoutError of a call which timed out
+}
+
+// do runs call with the timeout of the File, unless an earlier call timed out.
+func (f *timeoutFile) do(op string, call func() (int, error)) (int, error) {
+	f.mu.Lock()
+	err := f.broken
+	f.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+	n, err := withTimeout(f.timeout, op, f.name, call, nil)
+	if _, ok := err.(*TimeoutError); ok {
+		f.mu.Lock()
+		f.broken = err
+		f.mu.Unlock()
+	}
+	return n, err
+}
+
+func (f *timeoutFile) Read(p []byte) (int, error) {
+	return f.do("read", func() (int, error) { return f.File.Read(p) })
+}
+
+func (f *timeoutFile) ReadAt(p []byte, off int64) (int, error) {
+	return f.do("read", func() (int, error) { return f.File.ReadAt(p, off) })
+}
+
+func (f *timeoutFile) Write(p []byte) (int, error) {
+	return f.do("write", func() (int, error) { return f.File.Write(p) })
+}
+
+func (f *timeoutFile) WriteContext(ctx context.Context, p []byte) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, f.timeout)
+	defer cancel()
+	return f.do("write", func() (int, error) { return writeContext(ctx, f.File, p) })
+}
+
+// Close closes the File even if an earlier call timed out, so it isn't leaked once that call returns.
+func (f *timeoutFile) Close() error {
+	_, err := withTimeout(f.timeout, "close", f.name, func() (struct{}, error) { return struct{}{}, f.File.Close() }, nil)
+	return err
+}
+
+func (f *timeoutFile) Sync() error {
+	_, err := f.do("sync", func() (int, error) { return 0, syncFile(f.File) })
+	return err
+}
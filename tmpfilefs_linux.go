@@ -0,0 +1,86 @@
+//go:build linux && (386 || amd64 || arm64 || riscv64)
+// +build linux
+// +build 386 amd64 arm64 riscv64
+
+package stream
+
+import (
+	"os"
+	"strconv"
+	"sync"
+	"syscall"
+)
+
+// oTmpFile is O_TMPFILE: __O_TMPFILE is 0x400000 on the architectures this file is built for,
+// while O_DIRECTORY differs between them (ex. 0x10000 on amd64, 0x4000 on arm64).
+const oTmpFile = 0x400000 | syscall.O_DIRECTORY
+
+// NewTmpFileFS returns a FileSystem which creates anonymous Files in dir with O_TMPFILE (Linux 3.11+,
+// on filesystems which support it), so the data of a Stream never appears in the directory,
+// and is reclaimed automatically once it's Removed and its Readers are Closed, or if the process dies.
+// Names only identify Files within the FileSystem.
+func NewTmpFileFS(dir string) FileSystem {
+	return &tmpFileFS{dir: dir, files: make(map[string]*os.File)}
+}
+
+type tmpFileFS struct {
+	dir string
+
+	mu    sync.Mutex
+	files map[string]*os.File // keeps each File alive, to Open it after its writer is Closed
+}
+
+func (fs *tmpFileFS) Create(name string) (File, error) {
+	fd, err := syscall.Open(fs.dir, oTmpFile|syscall.O_RDWR|syscall.O_CLOEXEC, 0600)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: fs.dir, Err: err}
+	}
+	anchor, err := syscall.Dup(fd)
+	if err != nil {
+		syscall.Close(fd)
+		return nil, &os.PathError{Op: "dup", Path: fs.dir, Err: err}
+	}
+	syscall.CloseOnExec(anchor)
+
+	fs.mu.Lock()
+	if old, ok := fs.files[name]; ok {
+		old.Close()
+	}
+	fs.files[name] = os.NewFile(uintptr(anchor), name)
+	fs.mu.Unlock()
+	return os.NewFile(uintptr(fd), name), nil
+}
+
+func (fs *tmpFileFS) Open(name string) (File, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	anchor, ok := fs.files[name]
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	// reopening through /proc gives the Reader its own file offset
+	f, err := os.Open("/proc/self/fd/" + strconv.Itoa(int(anchor.Fd())))
+	if err != nil {
+		return nil, err
+	}
+	return &namedFile{File: f, name: name}, nil
+}
+
+func (fs *tmpFileFS) Remove(name string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	anchor, ok := fs.files[name]
+	if !ok {
+		return &os.PathError{Op: "remove", Path: name, Err: os.ErrNotExist}
+	}
+	delete(fs.files, name)
+	return anchor.Close()
+}
+
+// namedFile is an *os.File which reports a different Name.
+type namedFile struct {
+	*os.File
+	name string
+}
+
+func (f *namedFile) Name() string { return f.name }
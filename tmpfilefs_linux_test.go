@@ -0,0 +1,84 @@
+//go:build linux && (386 || amd64 || arm64 || riscv64)
+// +build linux
+// +build 386 amd64 arm64 riscv64
+
+package stream
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestTmpFileFSCreate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	f, err := NewTmpFileFS(dir).Create(t.Name())
+	switch {
+	// filesystems without O_TMPFILE support fail with EOPNOTSUPP, kernels before 3.11 with EISDIR
+	case errors.Is(err, syscall.EOPNOTSUPP) || errors.Is(err, syscall.EISDIR):
+		t.Skipf("O_TMPFILE unsupported: %v", err)
+
+	case err != nil:
+		t.Fatalf("expected Create to succeed, got %v", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(testdata); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTmpFileFS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fs := NewTmpFileFS(dir)
+	f, err := NewStream(t.Name(), fs)
+	if err != nil {
+		t.Skipf("O_TMPFILE unsupported: %v", err)
+	}
+	r, err := f.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	f.Write(testdata)
+	f.Close()
+
+	if entries, _ := ioutil.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("expected no Files in the directory, got %d", len(entries))
+	}
+
+	r2, err := f.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r2.Close()
+	for _, r := range []*Reader{r, r2} {
+		if data, _ := ioutil.ReadAll(r); !bytes.Equal(data, testdata) {
+			t.Errorf("Want/got: %q/%q", testdata, data)
+		}
+	}
+	if name := r2.Name(); name != t.Name() {
+		t.Errorf("Want/got: %s/%s", t.Name(), name)
+	}
+
+	r.Close()
+	r2.Close()
+	if err := f.Remove(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Open(t.Name()); err == nil {
+		t.Error("expected the File to be gone once Removed")
+	}
+}
@@ -0,0 +1,72 @@
+package stream
+
+import "io"
+
+// transformFile is the File of a Stream with WithWriteTransform, Writes pass through the transforms.
+type transformFile struct {
+	File
+	top     io.Writer        // the Writer of the first transform
+	closers []io.WriteCloser // the transforms, in order
+	pending int              // bytes which reached the File since the last call to flushed
+}
+
+func newTransformFile(f File, fns []func(io.Writer) io.WriteCloser) *transformFile {
+	t := &transformFile{File: f}
+	t.closers = make([]io.WriteCloser, len(fns))
+	var w io.Writer = fileCounter{t}
+	for i := len(fns) - 1; i >= 0; i-- {
+		t.closers[i] = fns[i](w)
+		w = t.closers[i]
+	}
+	t.top = w
+	return t
+}
+
+// fileCounter counts the bytes written to the File.
+type fileCounter struct{ t *transformFile }
+
+func (c fileCounter) Write(p []byte) (int, error) {
+	n, err := c.t.File.Write(p)
+	c.t.pending += n
+	return n, err
+}
+
+func (t *transformFile) Write(p []byte) (int, error) { return t.top.Write(p) }
+
+// Close Closes the transforms in order, so each flushes into the next, and then the File.
+func (t *transformFile) Close() error {
+	var err error
+	for _, c := range t.closers {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if cerr := t.File.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// flushed returns the bytes which reached the File since it was last called.
+func (t *transformFile) flushed() int {
+	n := t.pending
+	t.pending = 0
+	return n
+}
+
+// transform passes Reads of r through fns, see WithReadTransform.
+func (r *Reader) transform(fns []func(io.Reader) io.Reader) {
+	var src io.Reader = rawReader{r}
+	for _, fn := range fns {
+		src = fn(src)
+		if c, ok := src.(io.Closer); ok {
+			r.xclosers = append(r.xclosers, c)
+		}
+	}
+	r.xform = src
+}
+
+// rawReader Reads the bytes of the File from a Reader with WithReadTransform, r.readMu must be held.
+type rawReader struct{ r *Reader }
+
+func (raw rawReader) Read(p []byte) (int, error) { return raw.r.readRaw(p) }
@@ -0,0 +1,90 @@
+package stream
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// RecordCodec encodes and decodes the values of a Typed Stream.
+// An encoder may be stateful (ex. encoding/gob sends type information once), as each Typed Stream
+// has a single encoder, and each TypedReader its own decoder reading the Stream from the start.
+type RecordCodec[T any] interface {
+	NewEncoder(w io.Writer) RecordEncoder[T]
+	NewDecoder(r io.Reader) RecordDecoder[T]
+}
+
+// RecordEncoder writes encoded values, see RecordCodec.
+type RecordEncoder[T any] interface {
+	Encode(v T) error
+}
+
+// RecordDecoder reads encoded values, see RecordCodec. It returns io.EOF once there are no more values.
+type RecordDecoder[T any] interface {
+	Decode(v *T) error
+}
+
+// Typed is a Stream of values of type T, encoded with a RecordCodec, so producers and consumers
+// can exchange structured values with the same multi-reader, file-backed semantics as a Stream.
+type Typed[T any] struct {
+	s     *Stream
+	codec RecordCodec[T]
+
+	mu  sync.Mutex
+	buf bytes.Buffer
+	enc RecordEncoder[T]
+}
+
+// NewTyped returns a Typed Stream which Writes its values to s using codec.
+// s shouldn't be written to other than through the Typed Stream.
+func NewTyped[T any](s *Stream, codec RecordCodec[T]) *Typed[T] {
+	t := &Typed[T]{s: s, codec: codec}
+	t.enc = codec.NewEncoder(&t.buf)
+	return t
+}
+
+// Stream returns the underlying Stream.
+func (t *Typed[T]) Stream() *Stream { return t.s }
+
+// Write encodes v and Writes it to the Stream in a single Write, so Readers never wait on half a value.
+func (t *Typed[T]) Write(v T) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.buf.Reset()
+	if err := t.enc.Encode(v); err != nil {
+		return err
+	}
+	_, err := t.s.Write(t.buf.Bytes())
+	return err
+}
+
+// Close Closes the underlying Stream, so TypedReaders return io.EOF once they've read every value.
+func (t *Typed[T]) Close() error { return t.s.Close() }
+
+// NextReader returns a new TypedReader of every value Written to the Stream, see Stream.NextReader.
+func (t *Typed[T]) NextReader() (*TypedReader[T], error) {
+	r, err := t.s.NextReader()
+	if err != nil {
+		return nil, err
+	}
+	return &TypedReader[T]{r: r, dec: t.codec.NewDecoder(r)}, nil
+}
+
+// TypedReader reads the values of a Typed Stream.
+type TypedReader[T any] struct {
+	r   *Reader
+	dec RecordDecoder[T]
+}
+
+// Next returns the next value of the Stream. It blocks until the value is written, and returns
+// io.EOF once the Stream is Closed and every value has been read.
+func (tr *TypedReader[T]) Next() (v T, err error) {
+	err = tr.dec.Decode(&v)
+	return v, err
+}
+
+// Reader returns the underlying Reader.
+func (tr *TypedReader[T]) Reader() *Reader { return tr.r }
+
+// Close Closes the underlying Reader.
+func (tr *TypedReader[T]) Close() error { return tr.r.Close() }
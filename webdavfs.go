@@ -0,0 +1,183 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+)
+
+// NewWebDAVFS returns a FileSystem of the Files under the WebDAV collection at base (ex.
+// "https://dav.example.com/cache"), using client (http.DefaultClient if nil), so Streams can cache
+// through to WebDAV storage.
+//
+// WebDAV can't append to a File, so a File is kept in memory while it's written, where Readers Open
+// it from, and uploaded with a single PUT when it's Closed. Once uploaded, Files are read with Range
+// requests.
+func NewWebDAVFS(base string, client *http.Client) FileSystem {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &webdavFS{
+		base:    strings.TrimSuffix(base, "/"),
+		client:  client,
+		pending: make(map[string]*memFile),
+	}
+}
+
+type webdavFS struct {
+	base   string
+	client *http.Client
+
+	mu      sync.Mutex
+	pending map[string]*memFile // Files being written, by name
+}
+
+func (fs *webdavFS) url(name string) string {
+	segs := strings.Split(strings.TrimPrefix(name, "/"), "/")
+	for i, seg := range segs {
+		segs[i] = url.PathEscape(seg)
+	}
+	return fs.base + "/" + strings.Join(segs, "/")
+}
+
+// do sends a request for name, and returns an error for a response which isn't a success.
+func (fs *webdavFS) do(ctx context.Context, op, method, name string, body io.Reader, size int64, header http.Header) error {
+	req, err := http.NewRequestWithContext(ctx, method, fs.url(name), body)
+	if err != nil {
+		return &os.PathError{Op: op, Path: name, Err: err}
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := fs.client.Do(req)
+	if err != nil {
+		return &os.PathError{Op: op, Path: name, Err: err}
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	return statusErr(op, name, resp)
+}
+
+// statusErr returns an error for resp, if it isn't a success.
+func statusErr(op, name string, resp *http.Response) error {
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusNotFound:
+		return &os.PathError{Op: op, Path: name, Err: os.ErrNotExist}
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return &os.PathError{Op: op, Path: name, Err: os.ErrPermission}
+	}
+	return &os.PathError{Op: op, Path: name, Err: fmt.Errorf("unexpected status %q", resp.Status)}
+}
+
+func (fs *webdavFS) Create(name string) (File, error) {
+	f := newMemFile(name)
+	fs.mu.Lock()
+	if old, ok := fs.pending[name]; ok {
+		old.release()
+	}
+	fs.pending[name] = f
+	fs.mu.Unlock()
+	return &webdavFile{memFile: f, fs: fs}, nil
+}
+
+// CreateContext is Create, the File is only uploaded when it's Closed.
+func (fs *webdavFS) CreateContext(ctx context.Context, name string) (File, error) {
+	return fs.Create(name)
+}
+
+func (fs *webdavFS) Open(name string) (File, error) {
+	return fs.OpenContext(context.Background(), name)
+}
+
+func (fs *webdavFS) OpenContext(ctx context.Context, name string) (File, error) {
+	fs.mu.Lock()
+	f, ok := fs.pending[name]
+	fs.mu.Unlock()
+	if ok {
+		return f.open(), nil
+	}
+	if err := fs.do(ctx, "open", http.MethodHead, name, nil, 0, nil); err != nil {
+		return nil, err
+	}
+	return &httpFile{client: fs.client, url: fs.url(name), name: name}, nil
+}
+
+func (fs *webdavFS) Remove(name string) error {
+	return fs.RemoveContext(context.Background(), name)
+}
+
+func (fs *webdavFS) RemoveContext(ctx context.Context, name string) error {
+	fs.mu.Lock()
+	f, ok := fs.pending[name]
+	if ok {
+		delete(fs.pending, name)
+		f.release()
+	}
+	fs.mu.Unlock()
+	if err := fs.do(ctx, "remove", http.MethodDelete, name, nil, 0, nil); err != nil && !(ok && notExist(err)) {
+		return err
+	}
+	return nil
+}
+
+func (fs *webdavFS) Rename(oldname, newname string) error {
+	fs.mu.Lock()
+	if f, ok := fs.pending[oldname]; ok {
+		delete(fs.pending, oldname)
+		if old, ok := fs.pending[newname]; ok {
+			old.release()
+		}
+		fs.pending[newname] = f
+		f.rename(newname)
+		fs.mu.Unlock()
+		return nil
+	}
+	fs.mu.Unlock()
+	return fs.do(context.Background(), "rename", "MOVE", oldname, nil, 0, http.Header{
+		"Destination": {fs.url(newname)},
+		"Overwrite":   {"T"},
+	})
+}
+
+// webdavFile is a File being written to a webdavFS, which is uploaded when it's Closed.
+type webdavFile struct {
+	*memFile
+	fs *webdavFS
+}
+
+func (f *webdavFile) Close() error {
+	if err := f.memFile.Close(); err != nil {
+		return err
+	}
+
+	f.fs.mu.Lock()
+	name := f.Name()
+	if f.fs.pending[name] != f.memFile {
+		f.fs.mu.Unlock()
+		return nil // Removed, or Created over
+	}
+	r := f.open()
+	f.fs.mu.Unlock()
+
+	err := f.fs.do(context.Background(), "create", http.MethodPut, name, r, f.snapshot().size, nil)
+	r.Close()
+
+	f.fs.mu.Lock()
+	if f.fs.pending[name] == f.memFile {
+		delete(f.fs.pending, name)
+		f.release()
+	}
+	f.fs.mu.Unlock()
+	return err
+}
@@ -0,0 +1,119 @@
+package stream
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// ZstdEncoder compresses src into a complete zstd frame appended to dst.
+// *zstd.Encoder from github.com/klauspost/compress/zstd implements it.
+type ZstdEncoder interface {
+	EncodeAll(src, dst []byte) []byte
+}
+
+// ZstdDecoder decompresses zstd frames in input, appending them to dst.
+// *zstd.Decoder from github.com/klauspost/compress/zstd implements it.
+type ZstdDecoder interface {
+	DecodeAll(input, dst []byte) ([]byte, error)
+}
+
+// NewZstdFS returns a FileSystem which stores Files in inner in the zstd seekable format:
+// independent zstd frames of frameSize uncompressed bytes, followed on Close by a seek table
+// in a skippable frame. ReadAt (and so Reader.Seek) on the uncompressed content only has to
+// decompress the frames it covers, and any zstd decoder can still read the whole File.
+// Bytes which have been written but not yet compressed into a frame are readable from memory
+// by Files Opened through the same FileSystem.
+func NewZstdFS(inner FileSystem, frameSize int, enc ZstdEncoder, dec ZstdDecoder) FileSystem {
+	return &blockFS{
+		inner:     inner,
+		blockSize: frameSize,
+		codec:     zstdCodec{enc: enc, dec: dec},
+		seekTable: true,
+		indexes:   make(map[string]*blockIndex),
+	}
+}
+
+type zstdCodec struct {
+	enc ZstdEncoder
+	dec ZstdDecoder
+}
+
+func (c zstdCodec) Name() string                        { return "zstd" }
+func (c zstdCodec) Compress(p []byte) ([]byte, error)   { return c.enc.EncodeAll(p, nil), nil }
+func (c zstdCodec) Decompress(p []byte) ([]byte, error) { return c.dec.DecodeAll(p, nil) }
+
+// ErrNoSeekTable is returned when opening a File with no zstd seek table.
+var ErrNoSeekTable = errors.New("zstd seek table not found")
+
+const (
+	skippableMagic    = 0x184D2A5E
+	seekableMagic     = 0x8F92EAB1
+	seekTableFooter   = 9 // Number_Of_Frames, Seek_Table_Descriptor, Seekable_Magic_Number
+	seekTableEntry    = 8 // Compressed_Size, Decompressed_Size
+	seekTableChecksum = 1 << 7
+)
+
+func (idx *blockIndex) writeSeekTable(w io.Writer) error {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	n := len(idx.blocks)
+	table := make([]byte, 8+n*seekTableEntry+seekTableFooter)
+	binary.LittleEndian.PutUint32(table[0:], skippableMagic)
+	binary.LittleEndian.PutUint32(table[4:], uint32(len(table)-8))
+	for i, b := range idx.blocks {
+		entry := table[8+i*seekTableEntry:]
+		binary.LittleEndian.PutUint32(entry[0:], uint32(b.clen))
+		binary.LittleEndian.PutUint32(entry[4:], uint32(b.n))
+	}
+	footer := table[len(table)-seekTableFooter:]
+	binary.LittleEndian.PutUint32(footer[0:], uint32(n))
+	footer[4] = 0 // no checksums
+	binary.LittleEndian.PutUint32(footer[5:], seekableMagic)
+
+	_, err := w.Write(table)
+	return err
+}
+
+func readSeekTable(f File) (*blockIndex, error) {
+	size, err := fileSize(f)
+	if err != nil {
+		return nil, err
+	}
+	if size < 8+seekTableFooter {
+		return nil, ErrNoSeekTable
+	}
+
+	footer := make([]byte, seekTableFooter)
+	if _, err := f.ReadAt(footer, size-seekTableFooter); err != nil {
+		return nil, err
+	}
+	if binary.LittleEndian.Uint32(footer[5:]) != seekableMagic {
+		return nil, ErrNoSeekTable
+	}
+	entrySize := int64(seekTableEntry)
+	if footer[4]&seekTableChecksum != 0 {
+		entrySize += 4
+	}
+	n := int64(binary.LittleEndian.Uint32(footer[0:]))
+
+	tableSize := 8 + n*entrySize + seekTableFooter
+	if tableSize > size {
+		return nil, ErrNoSeekTable
+	}
+	table := make([]byte, tableSize-seekTableFooter)
+	if _, err := f.ReadAt(table, size-tableSize); err != nil {
+		return nil, err
+	}
+	if binary.LittleEndian.Uint32(table[0:]) != skippableMagic {
+		return nil, ErrNoSeekTable
+	}
+
+	idx := &blockIndex{}
+	for i := int64(0); i < n; i++ {
+		entry := table[8+i*entrySize:]
+		idx.add(int64(binary.LittleEndian.Uint32(entry[4:])), int64(binary.LittleEndian.Uint32(entry[0:])))
+	}
+	return idx, nil
+}